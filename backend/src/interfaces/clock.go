@@ -0,0 +1,209 @@
+package interfaces
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// RealClock implements Clock using the wall clock. This is what
+// the DarkKitchen uses when it is serving real traffic.
+type RealClock struct{}
+
+func CreateRealClock() *RealClock {
+	return &RealClock{}
+}
+
+func (c *RealClock) Now() time.Time {
+	return time.Now()
+}
+
+func (c *RealClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (c *RealClock) Go(fn func()) {
+	go fn()
+}
+
+// FakeClock implements Clock with a clock that only moves forward when
+// Advance is called. Every goroutine that sleeps on a FakeClock must be
+// started with its Go method so the clock knows when all of them are
+// parked. Sleeping goroutines are woken one at a time, ordered by their
+// wake up time and then by the order they went to sleep in, and each one
+// has to park again (or exit) before the next one is woken. This makes a
+// simulation driven by a FakeClock deterministic.
+type FakeClock struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	now  time.Time
+	// number of goroutines started with Go that are not parked in Sleep
+	running  int
+	sleepers []*fakeSleeper
+	seq      int
+	// run after every woken goroutine has parked again so components
+	// that process work asynchronously can catch up
+	wakeHooks []func()
+}
+
+type fakeSleeper struct {
+	wakeAt time.Time
+	seq    int
+	wake   chan struct{}
+}
+
+func CreateFakeClock(start time.Time) *FakeClock {
+	c := &FakeClock{
+		now: start,
+	}
+	c.cond = sync.NewCond(&c.mu)
+
+	return c
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Sleep parks the calling goroutine until the clock has been
+// advanced by at least d
+func (c *FakeClock) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	sleeper := &fakeSleeper{
+		wakeAt: c.now.Add(d),
+		seq:    c.seq,
+		wake:   make(chan struct{}),
+	}
+	c.seq++
+	c.sleepers = append(c.sleepers, sleeper)
+	c.running--
+	c.cond.Broadcast()
+	c.mu.Unlock()
+
+	<-sleeper.wake
+}
+
+// Go starts fn in a new goroutine and only returns once fn has parked in
+// Sleep or returned, so goroutines go to sleep in the order they are started
+func (c *FakeClock) Go(fn func()) {
+	c.mu.Lock()
+	before := c.running
+	c.running++
+	c.mu.Unlock()
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			c.running--
+			c.cond.Broadcast()
+			c.mu.Unlock()
+		}()
+
+		fn()
+	}()
+
+	c.mu.Lock()
+	for c.running > before {
+		c.cond.Wait()
+	}
+	c.mu.Unlock()
+}
+
+// OnWake registers fn to be called every time a woken
+// goroutine has parked again or exited
+func (c *FakeClock) OnWake(fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.wakeHooks = append(c.wakeHooks, fn)
+}
+
+// BlockUntil blocks until at least n goroutines are parked in Sleep
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.sleepers) < n {
+		c.cond.Wait()
+	}
+}
+
+// Advance moves the clock forward by d, waking every goroutine
+// whose sleep ends within that window
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+	c.waitForParked()
+
+	for {
+		sleeper := c.popSleeper(target)
+		if sleeper == nil {
+			break
+		}
+
+		c.now = sleeper.wakeAt
+		c.running++
+		close(sleeper.wake)
+		c.waitForParked()
+
+		hooks := c.wakeHooks
+		c.mu.Unlock()
+		for _, hook := range hooks {
+			hook()
+		}
+		c.mu.Lock()
+		c.waitForParked()
+	}
+
+	c.now = target
+	c.mu.Unlock()
+}
+
+// waitForParked must be called while holding c.mu
+func (c *FakeClock) waitForParked() {
+	for c.running > 0 {
+		c.cond.Wait()
+	}
+}
+
+// popSleeper removes and returns the next sleeper due at or before target.
+// must be called while holding c.mu
+func (c *FakeClock) popSleeper(target time.Time) *fakeSleeper {
+	if len(c.sleepers) == 0 {
+		return nil
+	}
+
+	sort.Sort(bySleeperWakeAt(c.sleepers))
+	next := c.sleepers[0]
+	if next.wakeAt.After(target) {
+		return nil
+	}
+
+	c.sleepers = c.sleepers[1:]
+	return next
+}
+
+type bySleeperWakeAt []*fakeSleeper
+
+func (s bySleeperWakeAt) Len() int {
+	return len(s)
+}
+
+func (s bySleeperWakeAt) Less(i, j int) bool {
+	if s[i].wakeAt.Equal(s[j].wakeAt) {
+		return s[i].seq < s[j].seq
+	}
+
+	return s[i].wakeAt.Before(s[j].wakeAt)
+}
+
+func (s bySleeperWakeAt) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
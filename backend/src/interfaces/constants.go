@@ -6,15 +6,130 @@ const (
 	// in milliseconds
 	DEFAULT_SLEEP_TIME                   = 1000 * time.Millisecond
 	OVERFLOW_PREMIUM                     = 2
+	DEFAULT_TEMPERATURE_SHELF_SIZE       = 15
+	DEFAULT_OVERFLOW_SHELF_SIZE          = 20
 	OVERFLOW_LABEL                       = "overflow"
 	HOT_TEMPERATURE_LABEL                = "hot"
 	COLD_TEMPERATURE_LABEL               = "cold"
 	FROZEN_TEMPERATURE_LABEL             = "frozen"
-	CARRIER_FACILITY_LABEL               = "carrierfacility"
 	ORDER_DEATH_NOTIFICATIONS_SIZE       = 10000
 	DEFAULT_DRIVER_MIN_DELAY             = 2
 	DEFAULT_DRIVER_MAX_DELAY             = 8
+	DEFAULT_ORDERS_PER_TICK              = 3.25
 	SHELFSET_WASTED_ORDERS_DECAY_LABEL   = "wastedOrdersDecay"
 	SHELFSET_WASTED_ORDERS_NOSPACE_LABEL = "wastedOrdersNoSpace"
+	SHELFSET_CANCELLED_ORDERS_LABEL      = "cancelledOrders"
+	SHELFSET_FLEET_LABEL                 = "fleet"
+	SHELFSET_DISPATCH_LABEL              = "dispatch"
 	DRIVER_RECEIVED_MSG                  = "received"
+	DRIVER_RECALLED_MSG                  = "recalled"
+	GOROUTINE_ENGINE_LABEL               = "goroutine"
+	EVENT_ENGINE_LABEL                   = "event"
+	SIMULATION_RUNNING_STATE             = "running"
+	SIMULATION_STOPPED_STATE             = "stopped"
+	// the states a driver in a Fleet can be in
+	AVAILABLE_DRIVER_STATE = "available"
+	EN_ROUTE_DRIVER_STATE  = "enRoute"
+	RETURNING_DRIVER_STATE = "returning"
+	// simulations nobody has used for this long are stopped and forgotten
+	DEFAULT_SIMULATION_IDLE_TIMEOUT = 30 * time.Minute
+	SIMULATION_GC_INTERVAL          = time.Minute
+	// how often the shelves are snapshotted when there's an event log
+	DEFAULT_SNAPSHOT_INTERVAL = time.Minute
+	// what a Subscription to a Hub does when its buffer is full. drop
+	// throws the new message away, coalesce folds it into a pending
+	// message with the same key or else throws the oldest one away
+	DROP_SUBSCRIPTION_POLICY     = "drop"
+	COALESCE_SUBSCRIPTION_POLICY = "coalesce"
+	// how many messages a websocket can fall behind by
+	WEBSOCKET_BUFFER_SIZE = 64
+	// how many messages a server-sent event stream can fall behind by
+	SSE_BUFFER_SIZE = 64
+	// the Prometheus metrics are named darkkitchen_*, with orders
+	// wasted labelled by reason, the shelf metrics by shelf and
+	// the waits at pickup by dispatch strategy
+	METRICS_NAMESPACE     = "darkkitchen"
+	SHELF_METRIC_LABEL    = "shelf"
+	REASON_METRIC_LABEL   = "reason"
+	STRATEGY_METRIC_LABEL = "strategy"
+	DECAY_WASTE_REASON    = "decay"
+	NO_SPACE_WASTE_REASON = "no_space"
+	// how many of the latest Events an EventStream keeps for subscribers to catch up on
+	EVENT_HISTORY_SIZE = 10000
+	// the websocket protocols. full sends the whole GetState every time the
+	// shelves change, diff sends a snapshot and then only the spaces that changed
+	FULL_STATE_PROTOCOL   = "full"
+	DIFF_STATE_PROTOCOL   = "diff"
+	SNAPSHOT_MESSAGE_TYPE = "snapshot"
+	DIFF_MESSAGE_TYPE     = "diff"
+	// labels of the PlacementPolicies the ShelfSet can use
+	HIGHEST_HEALTH_TO_OVERFLOW_POLICY_LABEL = "highest-health-to-overflow"
+	EARLIEST_PICKUP_FIRST_POLICY_LABEL      = "earliest-pickup-first"
+	LOWEST_VALUE_AT_RISK_FIRST_POLICY_LABEL = "lowest-value-at-risk-first"
+	REJECT_NEWEST_POLICY_LABEL              = "reject-newest"
+	// labels of the DispatchStrategies the Dispatcher can use
+	MATCHED_DISPATCH_STRATEGY_LABEL      = "matched"
+	FIFO_DISPATCH_STRATEGY_LABEL         = "fifo"
+	HEALTH_FIRST_DISPATCH_STRATEGY_LABEL = "health-first"
+	// simulates the same orders with every DispatchStrategy to compare them
+	ALL_DISPATCH_STRATEGIES_LABEL = "all"
+	// where a partner's courier is with an Order, see CourierStatus
+	COURIER_REQUESTED_STATE = "requested"
+	COURIER_ASSIGNED_STATE  = "assigned"
+	COURIER_ARRIVING_STATE  = "arriving"
+	COURIER_PICKED_UP_STATE = "pickedUp"
+	COURIER_CANCELLED_STATE = "cancelled"
+	// a courier couldn't be requested from the partner, so a simulated driver was sent
+	COURIER_FAILED_STATE = "failed"
+	// the header a partner signs its CourierWebhooks with, see SignCourierWebhook
+	COURIER_SIGNATURE_HEADER = "X-Courier-Signature"
+	// how long the HTTPCourierProvider waits on the partner's API
+	COURIER_PROVIDER_TIMEOUT = 5 * time.Second
+	// the types of TravelTimeDistribution drivers take to get to the kitchen
+	UNIFORM_TRAVEL_TIME     = "uniform"
+	NORMAL_TRAVEL_TIME      = "normal"
+	LOG_NORMAL_TRAVEL_TIME  = "lognormal"
+	EXPONENTIAL_TRAVEL_TIME = "exponential"
+	EMPIRICAL_TRAVEL_TIME   = "empirical"
+)
+
+// the lifecycle of an Order, see orderstate.go for how they connect
+const (
+	QUEUED_ORDER_STATE            OrderState = "queued"
+	COOKING_ORDER_STATE           OrderState = "cooking"
+	DISPATCHING_ORDER_STATE       OrderState = "dispatching"
+	ON_SHELF_ORDER_STATE          OrderState = "onShelf"
+	IN_OVERFLOW_ORDER_STATE       OrderState = "inOverflow"
+	PICKED_UP_ORDER_STATE         OrderState = "pickedUp"
+	DELIVERED_ORDER_STATE         OrderState = "delivered"
+	WASTED_DECAY_ORDER_STATE      OrderState = "wastedDecay"
+	REJECTED_NO_SPACE_ORDER_STATE OrderState = "rejectedNoSpace"
+	CANCELLED_ORDER_STATE         OrderState = "cancelled"
+)
+
+// the kinds of Events published on a DarkKitchen's EventStream
+const (
+	ORDER_RECEIVED_EVENT_TYPE              EventType = "OrderReceived"
+	ORDER_PLACED_EVENT_TYPE                EventType = "OrderPlaced"
+	ORDER_MOVED_TO_OVERFLOW_EVENT_TYPE     EventType = "OrderMovedToOverflow"
+	ORDER_RESCUED_FROM_OVERFLOW_EVENT_TYPE EventType = "OrderRescuedFromOverflow"
+	ORDER_DECAYED_EVENT_TYPE               EventType = "OrderDecayed"
+	ORDER_REJECTED_NO_SPACE_EVENT_TYPE     EventType = "OrderRejectedNoSpace"
+	ORDER_CANCELLED_EVENT_TYPE             EventType = "OrderCancelled"
+	DRIVER_DISPATCHED_EVENT_TYPE           EventType = "DriverDispatched"
+	DRIVER_RECALLED_EVENT_TYPE             EventType = "DriverRecalled"
+	DRIVER_ARRIVED_EVENT_TYPE              EventType = "DriverArrived"
+	ORDER_PICKED_UP_EVENT_TYPE             EventType = "OrderPickedUp"
+	ORDER_DELIVERED_EVENT_TYPE             EventType = "OrderDelivered"
+	// published when a Simulation starts over with a fresh DarkKitchen
+	SIMULATION_RESET_EVENT_TYPE EventType = "SimulationReset"
+)
+
+// kinds of events handled by the EventEngine, in the
+// order they are handled when they happen on the same tick
+const (
+	ORDER_DECAY_EVENT = iota
+	DRIVER_ARRIVAL_EVENT
+	DRIVER_RETURN_EVENT
+	ORDER_ARRIVAL_EVENT
 )
@@ -0,0 +1,178 @@
+package interfaces
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// CourierStatus is where a partner's courier is with an Order
+type CourierStatus struct {
+	OrderID   string `json:"orderId"`
+	CourierID string `json:"courierId,omitempty"`
+	// one of the COURIER_*_STATE labels
+	State string `json:"state"`
+	// when the courier is expected to pick up the Order, once one is assigned
+	PickupAt *time.Time `json:"pickupAt,omitempty"`
+	// why the partner couldn't be reached, if it couldn't
+	Error string `json:"error,omitempty"`
+	// whether the partner is being asked for or about the courier
+	tracking bool
+}
+
+// the states a partner's courier can move to from each state. A courier
+// who has picked up their Order, or was called off, is done for good
+var validCourierTransitions = map[string][]string{
+	COURIER_REQUESTED_STATE: {COURIER_ASSIGNED_STATE},
+	COURIER_ASSIGNED_STATE:  {COURIER_ARRIVING_STATE},
+	COURIER_ARRIVING_STATE:  {COURIER_PICKED_UP_STATE},
+}
+
+// canCourierTransition reports whether a courier can move from one state to the other
+func canCourierTransition(from string, to string) bool {
+	for _, state := range validCourierTransitions[from] {
+		if state == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// courierStatesBetween returns the states a courier goes through to get from one
+// state to the other, the other included. nil if they can't get there
+func courierStatesBetween(from string, to string) []string {
+	states := []string{}
+	for from != to {
+		next := validCourierTransitions[from]
+		if len(next) == 0 {
+			return nil
+		}
+		from = next[0]
+		states = append(states, from)
+	}
+
+	return states
+}
+
+// CourierRequest is what the HTTPCourierProvider sends a partner to ask for a courier
+type CourierRequest struct {
+	OrderID     string    `json:"orderId"`
+	Name        string    `json:"name"`
+	Temperature string    `json:"temp"`
+	ReadyAt     time.Time `json:"readyAt"`
+	// where the partner POSTs a CourierWebhook whenever the courier moves on
+	CallbackURL string `json:"callbackUrl"`
+}
+
+// CourierWebhook is what a partner POSTs back to the kitchen whenever its
+// courier for an Order is assigned, is arriving or has picked the Order up
+type CourierWebhook struct {
+	OrderID   string `json:"orderId"`
+	CourierID string `json:"courierId"`
+	// one of COURIER_ASSIGNED_STATE, COURIER_ARRIVING_STATE or COURIER_PICKED_UP_STATE
+	Event    string     `json:"event"`
+	PickupAt *time.Time `json:"pickupAt,omitempty"`
+}
+
+// SignCourierWebhook signs the body of a CourierWebhook with the secret the
+// kitchen shares with the partner, for the COURIER_SIGNATURE_HEADER
+func SignCourierWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyCourierWebhook reports whether the body was signed with the secret.
+// Nothing verifies without a secret, so webhooks can't be forged by leaving it out
+func VerifyCourierWebhook(secret string, body []byte, signature string) bool {
+	if secret == "" {
+		return false
+	}
+
+	return hmac.Equal([]byte(SignCourierWebhook(secret, body)), []byte(signature))
+}
+
+// HTTPCourierProvider implements CourierProvider by calling a partner's courier API
+// at endpoint: POST /couriers asks for a courier, GET /couriers/{orderId} tracks
+// them and DELETE /couriers/{orderId} calls them off. The partner reports back
+// by POSTing CourierWebhooks to callbackURL
+type HTTPCourierProvider struct {
+	endpoint    string
+	callbackURL string
+	client      *http.Client
+}
+
+func CreateHTTPCourierProvider(endpoint string, callbackURL string) *HTTPCourierProvider {
+	return &HTTPCourierProvider{
+		endpoint:    endpoint,
+		callbackURL: callbackURL,
+		client:      &http.Client{Timeout: COURIER_PROVIDER_TIMEOUT},
+	}
+}
+
+func (p *HTTPCourierProvider) RequestCourier(order Order) (CourierStatus, error) {
+	snapshot := order.Snapshot()
+	request := CourierRequest{
+		OrderID:     order.GetID(),
+		Name:        snapshot.Name,
+		Temperature: snapshot.Temperature,
+		ReadyAt:     readyAt(order),
+		CallbackURL: p.callbackURL,
+	}
+
+	status := CourierStatus{}
+	err := p.do(http.MethodPost, p.endpoint+"/couriers", request, &status)
+	return status, err
+}
+
+func (p *HTTPCourierProvider) TrackCourier(orderID string) (CourierStatus, error) {
+	status := CourierStatus{}
+	err := p.do(http.MethodGet, p.courierURL(orderID), nil, &status)
+	return status, err
+}
+
+func (p *HTTPCourierProvider) CancelCourier(orderID string) error {
+	return p.do(http.MethodDelete, p.courierURL(orderID), nil, nil)
+}
+
+func (p *HTTPCourierProvider) courierURL(orderID string) string {
+	return p.endpoint + "/couriers/" + url.PathEscape(orderID)
+}
+
+// do sends the request body, if any, as JSON and reads the JSON response into out
+func (p *HTTPCourierProvider) do(method string, url string, body interface{}, out interface{}) error {
+	var requestBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&requestBody).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	request, err := http.NewRequest(method, url, &requestBody)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf(CourierProviderErr, method, url, response.StatusCode)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(out)
+}
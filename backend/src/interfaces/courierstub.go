@@ -0,0 +1,169 @@
+package interfaces
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StubCourierService stands in for a delivery partner's courier API, so the
+// HTTPCourierProvider can be tried out offline. Every courier it is asked for
+// is assigned after AssignDelay, arrives TravelTime later and picks up the Order
+// PickupDelay after that, with a CourierWebhook signed with secret POSTed to the
+// request's callback URL at every step. Couriers that are cancelled stop where they are
+type StubCourierService struct {
+	AssignDelay time.Duration
+	TravelTime  time.Duration
+	PickupDelay time.Duration
+	secret      string
+	mu          sync.Mutex
+	couriers    map[string]*CourierStatus
+	nextID      int
+	// the couriers still on their way
+	wg     sync.WaitGroup
+	client *http.Client
+}
+
+func CreateStubCourierService(assignDelay time.Duration, travelTime time.Duration, pickupDelay time.Duration, secret string) *StubCourierService {
+	return &StubCourierService{
+		AssignDelay: assignDelay,
+		TravelTime:  travelTime,
+		PickupDelay: pickupDelay,
+		secret:      secret,
+		couriers:    map[string]*CourierStatus{},
+		client:      &http.Client{Timeout: COURIER_PROVIDER_TIMEOUT},
+	}
+}
+
+// ServeHTTP serves the same API the HTTPCourierProvider calls
+func (s *StubCourierService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	orderID := strings.TrimPrefix(r.URL.Path, "/couriers/")
+	switch {
+	case r.URL.Path == "/couriers" && r.Method == http.MethodPost:
+		request := CourierRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.OrderID == "" {
+			http.Error(w, "a courier request needs an orderId", http.StatusBadRequest)
+			return
+		}
+		s.writeStatus(w, s.requestCourier(request))
+	case strings.HasPrefix(r.URL.Path, "/couriers/") && r.Method == http.MethodGet:
+		status, ok := s.getStatus(orderID)
+		if !ok {
+			http.Error(w, fmt.Sprintf(CourierNotFoundErr, orderID), http.StatusNotFound)
+			return
+		}
+		s.writeStatus(w, status)
+	case strings.HasPrefix(r.URL.Path, "/couriers/") && r.Method == http.MethodDelete:
+		status, ok := s.cancelCourier(orderID)
+		if !ok {
+			http.Error(w, fmt.Sprintf(CourierNotFoundErr, orderID), http.StatusNotFound)
+			return
+		}
+		s.writeStatus(w, status)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Wait blocks until every courier has picked up their Order or been cancelled
+func (s *StubCourierService) Wait() {
+	s.wg.Wait()
+}
+
+func (s *StubCourierService) requestCourier(request CourierRequest) CourierStatus {
+	s.mu.Lock()
+	s.nextID++
+	status := &CourierStatus{
+		OrderID:   request.OrderID,
+		CourierID: fmt.Sprintf("courier-%d", s.nextID),
+		State:     COURIER_REQUESTED_STATE,
+	}
+	s.couriers[request.OrderID] = status
+	response := *status
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.deliver(request.CallbackURL, status)
+
+	return response
+}
+
+// deliver walks the courier through being assigned, arriving and picking up
+// the Order, and tells the kitchen at every step
+func (s *StubCourierService) deliver(callbackURL string, status *CourierStatus) {
+	defer s.wg.Done()
+
+	steps := []struct {
+		event string
+		delay time.Duration
+	}{
+		{COURIER_ASSIGNED_STATE, s.AssignDelay},
+		{COURIER_ARRIVING_STATE, s.TravelTime},
+		{COURIER_PICKED_UP_STATE, s.PickupDelay},
+	}
+	for _, step := range steps {
+		time.Sleep(step.delay)
+
+		s.mu.Lock()
+		if status.State == COURIER_CANCELLED_STATE {
+			s.mu.Unlock()
+			return
+		}
+		status.State = step.event
+		if step.event == COURIER_ASSIGNED_STATE {
+			pickupAt := time.Now().Add(s.TravelTime + s.PickupDelay)
+			status.PickupAt = &pickupAt
+		}
+		webhook := CourierWebhook{OrderID: status.OrderID, CourierID: status.CourierID, Event: step.event, PickupAt: status.PickupAt}
+		s.mu.Unlock()
+
+		body, _ := json.Marshal(webhook)
+		request, err := http.NewRequest(http.MethodPost, callbackURL, bytes.NewReader(body))
+		if err != nil {
+			return
+		}
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set(COURIER_SIGNATURE_HEADER, SignCourierWebhook(s.secret, body))
+
+		response, err := s.client.Do(request)
+		if err != nil {
+			// a partner would retry, but the stub just carries on
+			continue
+		}
+		response.Body.Close()
+	}
+}
+
+func (s *StubCourierService) getStatus(orderID string) (CourierStatus, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, ok := s.couriers[orderID]
+	if !ok {
+		return CourierStatus{}, false
+	}
+	return *status, true
+}
+
+func (s *StubCourierService) cancelCourier(orderID string) (CourierStatus, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, ok := s.couriers[orderID]
+	if !ok {
+		return CourierStatus{}, false
+	}
+	if status.State != COURIER_PICKED_UP_STATE {
+		status.State = COURIER_CANCELLED_STATE
+	}
+	return *status, true
+}
+
+func (s *StubCourierService) writeStatus(w http.ResponseWriter, status CourierStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
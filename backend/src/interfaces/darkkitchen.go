@@ -1,7 +1,10 @@
 package interfaces
 
 import (
+	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // implements ProcessingCenter
@@ -10,48 +13,77 @@ type DarkKitchen struct {
 	Kitchen         *Kitchen
 	Dispatcher      *Dispatcher
 	CarrierFacility CarrierFacility
+	// Engine runs the Order decay and driver processes
+	Engine Engine
 	// used for managing driver threads and shelfset decay process thread
 	// this is so the program does not exit until all goroutines have completed execution
-	WG           *sync.WaitGroup
-	WastedOrders int
-	// Used for sending notifications to the websocket handler
-	// to return the most updated state of the shelves to the client
-	// where the notification is the name of the CK component
-	// currently only supports "carrierfacility"
-	UpdatedStateNotifications chan string
+	WG *sync.WaitGroup
+	// Events is where the OrderHandlers, shelves and drivers publish what
+	// happens to each Order, e.g. for the websocket handlers to send the
+	// most updated state of the shelves to the client
+	Events *EventStream
 
 	// simulation config stores the configuration information
 	// for simulating any parts of the order request process
 	// that requires simulating e.g. the driver min and max delay times
 	simulationConfig *SimulationConfig
+	// seeded from the simulation config and shared by every driver
+	random *LockedRand
+
+	// every Order the DarkKitchen has received, so their status
+	// can still be looked up once they have left the shelves
+	ordersMu sync.RWMutex
+	orders   map[string]Order
+	orderIDs []string
+
+	// held for reading while an Order is received, so
+	// no Order gets in after the DarkKitchen is stopped
+	stopMu  sync.RWMutex
+	stopped bool
+	// set once the DarkKitchen should stop publishing Events
+	silenced int32
 }
 
 // CreateDarkKitchen creates a base DarkKitchen instance. If it is being used
 // for simulation purposes, allow the user to pass in the simulation config as a valid parameter
 func CreateDarkKitchen(simulationConfig *SimulationConfig) *DarkKitchen {
 
-	darkKitchen := &DarkKitchen{}
+	darkKitchen := &DarkKitchen{
+		simulationConfig: simulationConfig,
+		orders:           map[string]Order{},
+	}
 
 	orderBroker := CreateOrderBroker()
 	kitchen := CreateKitchen()
 	dispatcher := CreateDispatcher(darkKitchen)
 	carrierFacility := CreateShelfSet(darkKitchen)
 
-	updatedStateNotifications := make(chan string, 10000)
-
 	darkKitchen.OrderBroker = orderBroker
 	darkKitchen.Kitchen = kitchen
 	darkKitchen.Dispatcher = dispatcher
 	darkKitchen.CarrierFacility = carrierFacility
 	darkKitchen.WG = &sync.WaitGroup{}
-	darkKitchen.WastedOrders = 0
-	darkKitchen.UpdatedStateNotifications = updatedStateNotifications
-	darkKitchen.simulationConfig = simulationConfig
+	darkKitchen.Events = CreateEventStream()
+	darkKitchen.Engine = CreateGoroutineEngine(darkKitchen)
+	if simulationConfig != nil {
+		darkKitchen.random = CreateLockedRand(simulationConfig.Seed)
+		if simulationConfig.Engine == EVENT_ENGINE_LABEL {
+			darkKitchen.Engine = CreateEventEngine(darkKitchen)
+		}
+	}
 
 	// start any running processes for the carrier facility e.g.
 	// process for handling decayed Orders
 	carrierFacility.Start()
 
+	// when the simulation is stepped manually, let the shelves handle every
+	// decayed order before the next goroutine wakes up so each step is deterministic
+	if _, ok := darkKitchen.Engine.(*GoroutineEngine); ok && simulationConfig != nil {
+		if fakeClock, ok := simulationConfig.Clock.(*FakeClock); ok {
+			fakeClock.OnWake(carrierFacility.Sync)
+		}
+	}
+
 	darkKitchen.OrderBroker.SetNextOrderHandler(darkKitchen.Kitchen)
 	darkKitchen.Kitchen.SetNextOrderHandler(darkKitchen.Dispatcher)
 	darkKitchen.Dispatcher.SetNextOrderHandler(darkKitchen.CarrierFacility)
@@ -60,6 +92,29 @@ func CreateDarkKitchen(simulationConfig *SimulationConfig) *DarkKitchen {
 }
 
 func (ck *DarkKitchen) ReceiveOrder(order Order) error {
+	ck.stopMu.RLock()
+	defer ck.stopMu.RUnlock()
+	if ck.stopped {
+		return fmt.Errorf(DarkKitchenStoppedErr)
+	}
+
+	ck.ordersMu.Lock()
+	_, received := ck.orders[order.GetID()]
+	if !received {
+		ck.orders[order.GetID()] = order
+		ck.orderIDs = append(ck.orderIDs, order.GetID())
+	}
+	ck.ordersMu.Unlock()
+
+	if !received {
+		ck.metrics().orderReceived()
+		snapshot := order.Snapshot()
+		// an Order that can't be logged couldn't be recovered after a crash
+		if err := ck.publishEvent(Event{Type: ORDER_RECEIVED_EVENT_TYPE, OrderID: order.GetID(), Order: &snapshot}); err != nil {
+			return err
+		}
+	}
+
 	err := ck.OrderBroker.HandleOrder(order)
 	if err != nil {
 		return err
@@ -68,6 +123,112 @@ func (ck *DarkKitchen) ReceiveOrder(order Order) error {
 	return nil
 }
 
-func (ck *DarkKitchen) CarrierFacilityHasBeenUpdated() {
-	ck.UpdatedStateNotifications <- CARRIER_FACILITY_LABEL
+// GetOrder returns the Order the DarkKitchen received with the given ID
+func (ck *DarkKitchen) GetOrder(orderID string) (Order, error) {
+	ck.ordersMu.RLock()
+	defer ck.ordersMu.RUnlock()
+
+	order, ok := ck.orders[orderID]
+	if !ok {
+		return nil, fmt.Errorf(OrderNotFoundErr, orderID)
+	}
+
+	return order, nil
+}
+
+// CancelOrder withdraws an order the DarkKitchen has received
+// by passing it down the same chain of OrderHandlers
+func (ck *DarkKitchen) CancelOrder(orderID string) error {
+	order, err := ck.GetOrder(orderID)
+	if err != nil {
+		return err
+	}
+
+	return ck.OrderBroker.CancelOrder(order)
+}
+
+// HandleCourierWebhook moves the Order along with what the
+// partner its courier came from reported about them
+func (ck *DarkKitchen) HandleCourierWebhook(webhook CourierWebhook) error {
+	return ck.Dispatcher.courierUpdate(webhook)
+}
+
+// Stop turns away any new Orders. The Orders already on the shelves play
+// out, and the shelves stop watching for decay once every one of them is gone
+func (ck *DarkKitchen) Stop() {
+	ck.stopMu.Lock()
+	defer ck.stopMu.Unlock()
+
+	if ck.stopped {
+		return
+	}
+	ck.stopped = true
+
+	go func() {
+		ck.WG.Wait()
+		ck.CarrierFacility.Sync()
+		ck.CarrierFacility.Shutdown()
+	}()
+}
+
+// silence stops the DarkKitchen from publishing any more Events, e.g. once
+// a Simulation has moved on to a fresh DarkKitchen on the same EventStream
+func (ck *DarkKitchen) silence() {
+	atomic.StoreInt32(&ck.silenced, 1)
+}
+
+// IsStopped reports whether Stop has been called
+func (ck *DarkKitchen) IsStopped() bool {
+	ck.stopMu.RLock()
+	defer ck.stopMu.RUnlock()
+
+	return ck.stopped
+}
+
+// now is the time on the simulation clock, or the wall
+// clock if the DarkKitchen isn't being simulated
+func (ck *DarkKitchen) now() time.Time {
+	if ck == nil || ck.simulationConfig == nil || ck.simulationConfig.Clock == nil {
+		return time.Now()
+	}
+
+	return ck.simulationConfig.Clock.Now()
+}
+
+// metrics is where the DarkKitchen reports to, or nil if it doesn't
+func (ck *DarkKitchen) metrics() *Metrics {
+	if ck == nil || ck.simulationConfig == nil {
+		return nil
+	}
+
+	return ck.simulationConfig.Metrics
+}
+
+// dispatchStrategy decides which Orders the DarkKitchen's
+// drivers pick up, matching them to their own by default
+func (ck *DarkKitchen) dispatchStrategy() DispatchStrategy {
+	if ck.simulationConfig == nil || ck.simulationConfig.DispatchStrategy == nil {
+		return MatchedDispatchStrategy{}
+	}
+
+	return ck.simulationConfig.DispatchStrategy
+}
+
+// Step moves a simulation that is driven by a FakeClock forward
+// by n ticks, where a tick is the simulation config's SleepTime
+func (ck *DarkKitchen) Step(n int) error {
+	if ck.simulationConfig == nil {
+		return fmt.Errorf(NoSimulationConfigErr)
+	}
+
+	fakeClock, ok := ck.simulationConfig.Clock.(*FakeClock)
+	if !ok {
+		return fmt.Errorf(NoFakeClockErr)
+	}
+
+	for i := 0; i < n; i++ {
+		fakeClock.Advance(ck.simulationConfig.SleepTime)
+	}
+
+	return nil
 }
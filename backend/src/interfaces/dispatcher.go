@@ -1,24 +1,77 @@
 package interfaces
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
 
 type Dispatcher struct {
 	BaseOrderHandler
 	darkKitchen *DarkKitchen
+	// Fleet is the pool of drivers Orders are sent with
+	Fleet *Fleet
+	// the driver on their way to pick up each Order, by Order ID
+	mu      sync.Mutex
+	drivers map[string]*Driver
+	// drivers on their way, in the order they were sent
+	enRoute []*Driver
+	// drivers at the carrier facility waiting for an Order, longest waiting first
+	waiting []*Driver
+	// the waits at every pickup so far, see GetWaitStats
+	ordersPickedUp  int
+	totalFoodWait   time.Duration
+	longestFoodWait time.Duration
+	pickups         int
+	totalWait       time.Duration
+	// the partner's courier for each Order, when there's a CourierProvider
+	couriers map[string]*CourierStatus
+	// webhooks are applied one at a time, so a repeated one
+	// sees the state the first one left the courier in
+	courierMu sync.Mutex
+}
+
+// WaitStats are how long Orders waited on the shelves for a driver and
+// drivers waited at the carrier facility for Orders, averaged over every
+// pickup so far. The waits are in ticks
+type WaitStats struct {
+	Strategy          string  `json:"strategy"`
+	OrdersPickedUp    int     `json:"ordersPickedUp"`
+	AverageFoodWait   float64 `json:"averageFoodWait"`
+	LongestFoodWait   float64 `json:"longestFoodWait"`
+	Pickups           int     `json:"pickups"`
+	AverageDriverWait float64 `json:"averageDriverWait"`
+	// drivers at the carrier facility with nothing to pick up yet
+	DriversWaiting int `json:"driversWaiting"`
 }
 
 func CreateDispatcher(darkKitchen *DarkKitchen) *Dispatcher {
+	fleetSize := 0
+	if darkKitchen.simulationConfig != nil {
+		fleetSize = darkKitchen.simulationConfig.FleetSize
+	}
+
 	return &Dispatcher{
 		darkKitchen: darkKitchen,
+		Fleet:       CreateFleet(darkKitchen, fleetSize),
+		drivers:     map[string]*Driver{},
+		couriers:    map[string]*CourierStatus{},
 	}
 }
 
 func (d *Dispatcher) HandleOrder(order Order) error {
 	if d.nextOrderHandler != nil {
+		// the Dispatcher takes the Order on before it goes on the
+		// shelves, and sends a driver for it once it's there
+		if err := order.TransitionTo(DISPATCHING_ORDER_STATE); err != nil {
+			return err
+		}
+
 		err := d.nextOrderHandler.HandleOrder(order)
 		if err != nil {
 			return err
-		} else {
+		} else if !d.handToWaitingDriver() {
 			d.dispatchDriver(order)
 		}
 	} else {
@@ -28,11 +81,472 @@ func (d *Dispatcher) HandleOrder(order Order) error {
 	return nil
 }
 
-// emulating driver response
+// dispatchDriver asks the CourierProvider for a courier for the Order if there is one,
+// or else sends a simulated driver for it
 func (d *Dispatcher) dispatchDriver(order Order) {
+	if d.requestCourier(order) {
+		return
+	}
+	d.dispatchSimulatedDriver(order)
+}
+
+// dispatchSimulatedDriver adds the Order to the batch of a driver who is already on
+// their way, or asks the Fleet for a driver, who is sent as soon as one is available
+func (d *Dispatcher) dispatchSimulatedDriver(order Order) {
+	if d.joinBatch(order) {
+		return
+	}
+	d.Fleet.request(order)
+}
+
+// joinBatch has a driver who is on their way pick up the Order too, if they are due
+// within the batching window and have room for it. The driver due soonest takes it
+func (d *Dispatcher) joinBatch(order Order) bool {
+	simulationConfig := d.darkKitchen.simulationConfig
+	if simulationConfig == nil || simulationConfig.BatchSize <= 1 {
+		return false
+	}
+
+	now := d.darkKitchen.now()
+	latest := now.Add(time.Duration(simulationConfig.BatchWindow) * simulationConfig.SleepTime)
+
+	d.mu.Lock()
+	candidates := []*Driver{}
+	for _, driver := range d.enRoute {
+		pickupAt := driver.OrderRequest.GetExpectedPickupTime()
+		if pickupAt.After(now) && !pickupAt.After(latest) {
+			candidates = append(candidates, driver)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].OrderRequest.GetExpectedPickupTime().Before(candidates[j].OrderRequest.GetExpectedPickupTime())
+	})
+
+	var batched *Driver
+	for _, driver := range candidates {
+		if driver.addToBatch(order, simulationConfig.BatchSize) {
+			batched = driver
+			break
+		}
+	}
+	if batched == nil {
+		d.mu.Unlock()
+		return false
+	}
+
+	pickupAt := batched.OrderRequest.GetExpectedPickupTime()
+	order.SetExpectedPickupTime(pickupAt)
+	d.drivers[order.GetID()] = batched
+	d.mu.Unlock()
+
+	d.darkKitchen.publishEvent(Event{Type: DRIVER_DISPATCHED_EVENT_TYPE, OrderID: order.GetID(), PickupAt: &pickupAt})
+	return true
+}
+
+// emulating driver response
+func (d *Dispatcher) sendDriver(order Order) {
 	// in a production system, we would create a request for a driver
 	// from one of our partner systems e.g. UberEATS, DoorDash that would then find a driver and
-	// send us a "driver found" response. For simplicity, we'll directly create the driver that should receive the order
-	driver := CreateDriver(d.darkKitchen)
-	driver.ReceiveOrderRequest(order)
+	// send us a "driver found" response. For simplicity, we'll have the engine directly create the driver that should receive the order
+	driver := d.darkKitchen.Engine.DispatchDriver(order)
+	pickupAt := order.GetExpectedPickupTime()
+	d.darkKitchen.publishEvent(Event{Type: DRIVER_DISPATCHED_EVENT_TYPE, OrderID: order.GetID(), PickupAt: &pickupAt})
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// the EventEngine's driver can't have arrived yet, but a GoroutineEngine
+	// driver with no travel time may already be done with the Order
+	if !driver.IsDone() {
+		d.drivers[order.GetID()] = driver
+		d.enRoute = append(d.enRoute, driver)
+	}
+}
+
+// resumeDriver sends a driver for an Order whose driver was already on their
+// way when the DarkKitchen was recovered. They arrive at the Order's expected pickup time
+func (d *Dispatcher) resumeDriver(order Order) {
+	d.Fleet.resume(order)
+	driver := d.darkKitchen.Engine.DispatchDriver(order)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !driver.IsDone() {
+		d.drivers[order.GetID()] = driver
+		d.enRoute = append(d.enRoute, driver)
+	}
+}
+
+// CancelOrder recalls the Order's driver once the
+// rest of the chain has agreed to cancel the Order
+func (d *Dispatcher) CancelOrder(order Order) error {
+	if d.nextOrderHandler == nil {
+		return fmt.Errorf("nextOrderHandler is nil")
+	}
+
+	err := d.nextOrderHandler.CancelOrder(order)
+	if err != nil {
+		return err
+	}
+
+	if d.cancelCourier(order) {
+		return nil
+	}
+
+	// the driver only turns around once every Order in their batch is cancelled
+	done := order
+	d.mu.Lock()
+	if driver, ok := d.drivers[order.GetID()]; ok {
+		delete(d.drivers, order.GetID())
+		if driver.dropFromBatch(order.GetID()) == 0 {
+			driver.Recall()
+			d.darkKitchen.publishEvent(Event{Type: DRIVER_RECALLED_EVENT_TYPE, OrderID: order.GetID()})
+			d.removeEnRoute(driver)
+			done = driver.OrderRequest
+		} else {
+			done = nil
+		}
+	}
+	d.mu.Unlock()
+
+	d.Fleet.dequeue(order)
+	if done != nil {
+		d.Fleet.driverDone(done)
+	}
+	return nil
+}
+
+// releaseDriver forgets the driver once they're done with
+// their Orders and sends them back to the Fleet
+func (d *Dispatcher) releaseDriver(driver *Driver) {
+	d.mu.Lock()
+	for orderID, orderDriver := range d.drivers {
+		if orderDriver == driver {
+			delete(d.drivers, orderID)
+		}
+	}
+	d.removeEnRoute(driver)
+	d.mu.Unlock()
+
+	d.Fleet.driverDone(driver.OrderRequest)
+}
+
+// waitForOrder has a driver who found nothing to pick up wait
+// at the carrier facility for the next Order that is ready
+func (d *Dispatcher) waitForOrder(driver *Driver) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for orderID, orderDriver := range d.drivers {
+		if orderDriver == driver {
+			delete(d.drivers, orderID)
+		}
+	}
+	d.removeEnRoute(driver)
+	d.waiting = append(d.waiting, driver)
+}
+
+// handToWaitingDriver has the driver who has waited longest pick up now that an
+// Order is ready, in place of sending a new driver for it. false if no driver is waiting
+func (d *Dispatcher) handToWaitingDriver() bool {
+	d.mu.Lock()
+	if len(d.waiting) == 0 {
+		d.mu.Unlock()
+		return false
+	}
+	driver := d.waiting[0]
+	d.waiting = d.waiting[1:]
+	d.mu.Unlock()
+
+	pickedUp, err := driver.pickUp()
+	if err == nil && !pickedUp {
+		// someone else got to the Order first
+		d.mu.Lock()
+		d.waiting = append([]*Driver{driver}, d.waiting...)
+		d.mu.Unlock()
+		return false
+	}
+
+	if pickedUp {
+		err = driver.DeliverOrder()
+	}
+	driver.finish()
+	driver.report(err)
+	return pickedUp
+}
+
+// recordPickup adds the waits at a driver's pickup to the WaitStats
+func (d *Dispatcher) recordPickup(foodWaits []time.Duration, driverWait time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, foodWait := range foodWaits {
+		d.ordersPickedUp++
+		d.totalFoodWait += foodWait
+		if foodWait > d.longestFoodWait {
+			d.longestFoodWait = foodWait
+		}
+	}
+	d.pickups++
+	d.totalWait += driverWait
+}
+
+// GetWaitStats averages the waits at every pickup so far
+func (d *Dispatcher) GetWaitStats() WaitStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stats := WaitStats{
+		Strategy:       d.darkKitchen.dispatchStrategy().Label(),
+		OrdersPickedUp: d.ordersPickedUp,
+		Pickups:        d.pickups,
+		DriversWaiting: len(d.waiting),
+	}
+	if d.darkKitchen.simulationConfig == nil {
+		return stats
+	}
+
+	tick := float64(d.darkKitchen.simulationConfig.SleepTime)
+	stats.LongestFoodWait = float64(d.longestFoodWait) / tick
+	if d.ordersPickedUp > 0 {
+		stats.AverageFoodWait = float64(d.totalFoodWait) / tick / float64(d.ordersPickedUp)
+	}
+	if d.pickups > 0 {
+		stats.AverageDriverWait = float64(d.totalWait) / tick / float64(d.pickups)
+	}
+
+	return stats
+}
+
+// courierProvider finds couriers for Orders in place of the simulated drivers, if set
+func (d *Dispatcher) courierProvider() CourierProvider {
+	if d.darkKitchen.simulationConfig == nil {
+		return nil
+	}
+
+	return d.darkKitchen.simulationConfig.CourierProvider
+}
+
+// requestCourier asks the CourierProvider for a courier for the Order. false if
+// there isn't one. The partner is asked without holding up the Order, and if it
+// can't be reached a simulated driver goes instead
+func (d *Dispatcher) requestCourier(order Order) bool {
+	provider := d.courierProvider()
+	if provider == nil {
+		return false
+	}
+
+	// the courier counts as requested straight away, so
+	// webhooks that beat the partner's answer aren't turned away
+	status := &CourierStatus{OrderID: order.GetID(), State: COURIER_REQUESTED_STATE, tracking: true}
+	d.mu.Lock()
+	d.couriers[order.GetID()] = status
+	d.mu.Unlock()
+
+	d.darkKitchen.WG.Add(1)
+	d.darkKitchen.simulationConfig.Clock.Go(func() {
+		defer d.darkKitchen.WG.Done()
+
+		requested, err := provider.RequestCourier(order)
+
+		d.mu.Lock()
+		status.tracking = false
+		state := status.State
+		switch {
+		case err != nil && state == COURIER_REQUESTED_STATE:
+			status.State = COURIER_FAILED_STATE
+			status.Error = err.Error()
+		case err == nil:
+			if status.CourierID == "" {
+				status.CourierID = requested.CourierID
+			}
+			if status.PickupAt == nil {
+				status.PickupAt = requested.PickupAt
+			}
+		}
+		d.mu.Unlock()
+
+		switch {
+		case err != nil && state == COURIER_REQUESTED_STATE:
+			d.dispatchSimulatedDriver(order)
+		case err == nil && state == COURIER_CANCELLED_STATE:
+			// the Order was cancelled before the partner had a courier to call off
+			provider.CancelCourier(order.GetID())
+		}
+	})
+
+	return true
+}
+
+// cancelCourier calls off the partner's courier for a cancelled Order.
+// false if the Order doesn't have one
+func (d *Dispatcher) cancelCourier(order Order) bool {
+	d.mu.Lock()
+	status, ok := d.couriers[order.GetID()]
+	if !ok || status.State == COURIER_FAILED_STATE {
+		d.mu.Unlock()
+		return false
+	}
+	status.State = COURIER_CANCELLED_STATE
+	d.mu.Unlock()
+
+	if err := d.courierProvider().CancelCourier(order.GetID()); err != nil {
+		d.mu.Lock()
+		status.Error = err.Error()
+		d.mu.Unlock()
+	}
+
+	return true
+}
+
+// TrackCourier returns what the partner last said about the courier for the Order,
+// without waiting on the partner. A courier who is still on their way is looked up
+// with the partner in the background, so a webhook that never came in is caught up
+// on. false if the Order doesn't have a courier from a partner
+func (d *Dispatcher) TrackCourier(orderID string) (CourierStatus, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	status, ok := d.couriers[orderID]
+	if !ok {
+		return CourierStatus{}, false
+	}
+
+	if !status.tracking && len(validCourierTransitions[status.State]) > 0 {
+		status.tracking = true
+		go d.refreshCourier(status)
+	}
+
+	return *status, true
+}
+
+// lastCourierStatus returns what the partner last said about the courier
+// for the Order. false if the Order doesn't have a courier from a partner
+func (d *Dispatcher) lastCourierStatus(orderID string) (CourierStatus, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	status, ok := d.couriers[orderID]
+	if !ok {
+		return CourierStatus{}, false
+	}
+
+	return *status, true
+}
+
+// refreshCourier asks the partner where the courier is and moves them along to
+// that state, as if the webhooks for the states in between had come in
+func (d *Dispatcher) refreshCourier(status *CourierStatus) {
+	tracked, err := d.courierProvider().TrackCourier(status.OrderID)
+
+	d.mu.Lock()
+	status.tracking = false
+	from := status.State
+	d.mu.Unlock()
+
+	if err != nil {
+		return
+	}
+
+	for _, state := range courierStatesBetween(from, tracked.State) {
+		webhook := CourierWebhook{OrderID: status.OrderID, CourierID: tracked.CourierID, Event: state, PickupAt: tracked.PickupAt}
+		if err := d.courierUpdate(webhook); err != nil {
+			return
+		}
+	}
+}
+
+// courierUpdate moves the Order along with what the partner reported about its
+// courier. A courier who picks up the Order takes it off the shelves, and since
+// the partner delivers it, the Order is delivered as far as the kitchen is concerned.
+// The courier only takes on the reported state once the Order has moved along with
+// it, and a webhook the partner sends again is let through without doing anything
+func (d *Dispatcher) courierUpdate(webhook CourierWebhook) error {
+	switch webhook.Event {
+	case COURIER_ASSIGNED_STATE, COURIER_ARRIVING_STATE, COURIER_PICKED_UP_STATE:
+	default:
+		return fmt.Errorf(CourierEventNotFoundErr, webhook.Event)
+	}
+
+	d.courierMu.Lock()
+	defer d.courierMu.Unlock()
+
+	order, err := d.darkKitchen.GetOrder(webhook.OrderID)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	status, ok := d.couriers[webhook.OrderID]
+	from := ""
+	if ok {
+		from = status.State
+	}
+	d.mu.Unlock()
+
+	if !ok || from == COURIER_CANCELLED_STATE || from == COURIER_FAILED_STATE {
+		return fmt.Errorf(CourierNotFoundErr, webhook.OrderID)
+	}
+	if from == webhook.Event {
+		return nil
+	}
+	if !canCourierTransition(from, webhook.Event) {
+		return fmt.Errorf(InvalidCourierTransitionErr, webhook.OrderID, from, webhook.Event)
+	}
+
+	if err := d.applyCourierUpdate(order, webhook); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// the courier may have been called off in the meantime
+	if status.State != from {
+		return nil
+	}
+	if webhook.CourierID != "" {
+		status.CourierID = webhook.CourierID
+	}
+	if webhook.PickupAt != nil {
+		status.PickupAt = webhook.PickupAt
+	}
+	status.State = webhook.Event
+
+	return nil
+}
+
+// applyCourierUpdate moves the Order along with the courier's new state
+func (d *Dispatcher) applyCourierUpdate(order Order, webhook CourierWebhook) error {
+	switch webhook.Event {
+	case COURIER_ASSIGNED_STATE:
+		if webhook.PickupAt != nil {
+			order.SetExpectedPickupTime(*webhook.PickupAt)
+		}
+		d.darkKitchen.publishEvent(Event{Type: DRIVER_DISPATCHED_EVENT_TYPE, OrderID: order.GetID(), PickupAt: webhook.PickupAt})
+	case COURIER_ARRIVING_STATE:
+		d.darkKitchen.publishEvent(Event{Type: DRIVER_ARRIVED_EVENT_TYPE, OrderID: order.GetID()})
+	case COURIER_PICKED_UP_STATE:
+		if d.darkKitchen.CarrierFacility == nil {
+			return fmt.Errorf(NilCarrierFacilityErr)
+		}
+		if _, err := d.darkKitchen.CarrierFacility.GiveOrder(order.GetID()); err != nil {
+			return err
+		}
+		if err := order.TransitionTo(DELIVERED_ORDER_STATE); err != nil {
+			return err
+		}
+		d.darkKitchen.publishEvent(Event{Type: ORDER_DELIVERED_EVENT_TYPE, OrderID: order.GetID()})
+	}
+
+	return nil
+}
+
+// must be called while holding d.mu
+func (d *Dispatcher) removeEnRoute(driver *Driver) {
+	for idx := range d.enRoute {
+		if d.enRoute[idx] == driver {
+			d.enRoute = append(d.enRoute[:idx], d.enRoute[idx+1:]...)
+			return
+		}
+	}
 }
@@ -0,0 +1,102 @@
+package interfaces
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MatchedDispatchStrategy implements DispatchStrategy by binding every driver
+// to the Orders they were sent for. A driver whose Orders are gone by the time
+// they arrive leaves empty handed.
+type MatchedDispatchStrategy struct{}
+
+func (s MatchedDispatchStrategy) Label() string {
+	return MATCHED_DISPATCH_STRATEGY_LABEL
+}
+
+func (s MatchedDispatchStrategy) ChooseOrders(sentFor []Order, ready []ShelfOrder) []Order {
+	return sentFor
+}
+
+func (s MatchedDispatchStrategy) WaitsForOrders() bool {
+	return false
+}
+
+// FIFODispatchStrategy implements DispatchStrategy by giving whichever driver
+// arrives first the Orders that have been ready the longest, no matter which
+// Orders they were sent for. A driver who finds nothing ready waits for the next Order.
+type FIFODispatchStrategy struct{}
+
+func (s FIFODispatchStrategy) Label() string {
+	return FIFO_DISPATCH_STRATEGY_LABEL
+}
+
+func (s FIFODispatchStrategy) ChooseOrders(sentFor []Order, ready []ShelfOrder) []Order {
+	return firstOrders(ready, len(sentFor), func(a ShelfOrder, b ShelfOrder) bool {
+		return readyAt(a).Before(readyAt(b))
+	})
+}
+
+func (s FIFODispatchStrategy) WaitsForOrders() bool {
+	return true
+}
+
+// HealthFirstDispatchStrategy implements DispatchStrategy by giving whichever
+// driver arrives first the Orders with the least life left, no matter which Orders
+// they were sent for. A driver who finds nothing ready waits for the next Order.
+type HealthFirstDispatchStrategy struct{}
+
+func (s HealthFirstDispatchStrategy) Label() string {
+	return HEALTH_FIRST_DISPATCH_STRATEGY_LABEL
+}
+
+func (s HealthFirstDispatchStrategy) ChooseOrders(sentFor []Order, ready []ShelfOrder) []Order {
+	return firstOrders(ready, len(sentFor), func(a ShelfOrder, b ShelfOrder) bool {
+		return a.Snapshot().Health < b.Snapshot().Health
+	})
+}
+
+func (s HealthFirstDispatchStrategy) WaitsForOrders() bool {
+	return true
+}
+
+// CreateDispatchStrategy returns the DispatchStrategy with the given label
+func CreateDispatchStrategy(label string) (DispatchStrategy, error) {
+	switch label {
+	case MATCHED_DISPATCH_STRATEGY_LABEL:
+		return MatchedDispatchStrategy{}, nil
+	case FIFO_DISPATCH_STRATEGY_LABEL:
+		return FIFODispatchStrategy{}, nil
+	case HEALTH_FIRST_DISPATCH_STRATEGY_LABEL:
+		return HealthFirstDispatchStrategy{}, nil
+	default:
+		return nil, fmt.Errorf(DispatchStrategyNotFoundErr, label)
+	}
+}
+
+// firstOrders returns up to count of the ready Orders, ordered by less
+func firstOrders(ready []ShelfOrder, count int, less func(ShelfOrder, ShelfOrder) bool) []Order {
+	sorted := append([]ShelfOrder{}, ready...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return less(sorted[i], sorted[j])
+	})
+
+	orders := []Order{}
+	for idx := 0; idx < len(sorted) && idx < count; idx++ {
+		orders = append(orders, sorted[idx].Order)
+	}
+
+	return orders
+}
+
+// readyAt is when the Order came out of the kitchen onto the shelves
+func readyAt(order Order) time.Time {
+	for _, transition := range order.GetTransitions() {
+		if transition.State.OnShelves() {
+			return transition.At
+		}
+	}
+
+	return time.Time{}
+}
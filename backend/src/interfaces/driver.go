@@ -2,7 +2,8 @@ package interfaces
 
 import (
 	"fmt"
-	"math/rand"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,6 +14,19 @@ type Driver struct {
 	hasPickedUpOrder     bool
 	OrderRequest         Order
 	darkKitchen          *DarkKitchen
+	random               *LockedRand
+	// when the driver was sent for their order, and when they got there
+	dispatchedAt time.Time
+	arrivedAt    time.Time
+	// set once the driver has been turned around, and once they are done
+	// with their order. read and written atomically from any goroutine
+	recalled int32
+	done     int32
+	// every Order the driver is picking up, starting with OrderRequest. Orders
+	// can join the batch until the driver arrives at the carrier facility
+	batchMu sync.Mutex
+	batch   []Order
+	arrived bool
 }
 
 func CreateDriver(darkKitchen *DarkKitchen) Driver {
@@ -20,62 +34,251 @@ func CreateDriver(darkKitchen *DarkKitchen) Driver {
 	return Driver{
 		messages:    messagesChan,
 		darkKitchen: darkKitchen,
+		random:      darkKitchen.random,
 	}
 }
 
-// ReceiveOrder receives the order
+// ReceiveOrder receives the orders
 // from the carrier facility that is housing
-// the order the driver wishes to pick up
-func (d *Driver) ReceiveOrder() error {
+// the orders the driver wishes to pick up. The DispatchStrategy
+// decides which orders they leave with, and whether they wait
+// for one if there's nothing for them to pick up. true if the
+// driver is waiting, in which case they haven't received anything yet
+func (d *Driver) ReceiveOrder() (bool, error) {
+	d.batchMu.Lock()
+	d.arrived = true
+	d.batchMu.Unlock()
+
+	d.arrivedAt = d.darkKitchen.now()
+	d.darkKitchen.metrics().driverArrived(d.arrivedAt.Sub(d.dispatchedAt))
+	for _, order := range d.Orders() {
+		d.darkKitchen.publishEvent(Event{Type: DRIVER_ARRIVED_EVENT_TYPE, OrderID: order.GetID()})
+	}
+
 	if d.darkKitchen.CarrierFacility == nil {
-		return fmt.Errorf(NilCarrierFacilityErr)
+		d.finish()
+		return false, fmt.Errorf(NilCarrierFacilityErr)
 	}
 
-	order, err := d.darkKitchen.CarrierFacility.GiveOrder(d.OrderRequest.GetID())
+	pickedUp, err := d.pickUp()
+	if err == nil && !pickedUp && d.darkKitchen.dispatchStrategy().WaitsForOrders() && d.darkKitchen.Dispatcher != nil {
+		// the driver is done once they pick up the next order that is ready
+		d.darkKitchen.Dispatcher.waitForOrder(d)
+		return true, nil
+	}
+
+	defer d.finish()
 	if err != nil {
-		return err
+		return false, err
 	}
+	if !pickedUp {
+		return false, fmt.Errorf(NoOrdersReadyErr)
+	}
+
+	return false, d.DeliverOrder()
+}
 
-	if order != nil && order.GetID() == d.OrderRequest.GetID() {
+// pickUp has the driver leave with the orders the DispatchStrategy chooses for
+// them, which become their batch. false if there's nothing for them to pick up
+func (d *Driver) pickUp() (bool, error) {
+	strategy := d.darkKitchen.dispatchStrategy()
+	for {
+		chosen := strategy.ChooseOrders(d.Orders(), d.darkKitchen.CarrierFacility.GetOrders())
+		if len(chosen) == 0 {
+			return false, nil
+		}
+
+		orderIDs := []string{}
+		for _, order := range chosen {
+			orderIDs = append(orderIDs, order.GetID())
+		}
+
+		orders, missing, err := d.darkKitchen.CarrierFacility.GiveOrders(orderIDs)
+		if err != nil {
+			if len(missing) == 0 {
+				return false, err
+			}
+			// try again without the orders that are gone, if there are any left
+			for _, orderID := range missing {
+				d.dropFromBatch(orderID)
+			}
+			if !strategy.WaitsForOrders() && len(d.Orders()) == 0 {
+				return false, err
+			}
+			continue
+		}
+
+		if len(orders) != len(orderIDs) {
+			return false, fmt.Errorf("Given orders are not the same as requested")
+		}
+		for idx, order := range orders {
+			if order == nil || order.GetID() != orderIDs[idx] {
+				return false, fmt.Errorf("Given order is not the same as requested")
+			}
+		}
+
+		d.batchMu.Lock()
+		d.batch = orders
+		d.batchMu.Unlock()
 		d.hasPickedUpOrder = true
-		d.DeliverOrder()
-	} else {
-		return fmt.Errorf("Given order is not the same as requested")
+		d.recordPickup(orders)
+		return true, nil
 	}
+}
 
-	return nil
+// recordPickup reports how long the orders were ready
+// for and how long the driver waited for them
+func (d *Driver) recordPickup(orders []Order) {
+	now := d.darkKitchen.now()
+	foodWaits := []time.Duration{}
+	for _, order := range orders {
+		foodWaits = append(foodWaits, now.Sub(readyAt(order)))
+	}
+	driverWait := now.Sub(d.arrivedAt)
+
+	d.darkKitchen.metrics().pickedUp(d.darkKitchen.dispatchStrategy().Label(), foodWaits, driverWait)
+	if d.darkKitchen.Dispatcher != nil {
+		d.darkKitchen.Dispatcher.recordPickup(foodWaits, driverWait)
+	}
 }
 
-func (d *Driver) ReceiveOrderRequest(request Order) error {
-	d.OrderRequest = request
+// Orders returns every Order the driver is picking up
+func (d *Driver) Orders() []Order {
+	d.batchMu.Lock()
+	defer d.batchMu.Unlock()
 
-	d.darkKitchen.WG.Add(1)
-	go d.startDriverJourney()
+	return append([]Order{}, d.batch...)
+}
 
-	msg := ""
-	for {
-		select {
-		case driverResolution := <-d.messages:
-			msg = driverResolution
-			break
-		}
+// addToBatch has the driver pick up the Order along with the ones they were
+// sent for. false if they have already arrived or have no room left for it
+func (d *Driver) addToBatch(order Order, batchSize int) bool {
+	d.batchMu.Lock()
+	defer d.batchMu.Unlock()
 
-		if d.etaToCarrierFacility <= 0 {
+	if d.arrived || d.IsRecalled() || len(d.batch) >= batchSize {
+		return false
+	}
+	d.batch = append(d.batch, order)
+	return true
+}
+
+// dropFromBatch takes the Order out of the driver's batch
+// and returns how many Orders they are still picking up
+func (d *Driver) dropFromBatch(orderID string) int {
+	d.batchMu.Lock()
+	defer d.batchMu.Unlock()
+
+	for idx, order := range d.batch {
+		if order.GetID() == orderID {
+			d.batch = append(d.batch[:idx], d.batch[idx+1:]...)
 			break
 		}
 	}
+	return len(d.batch)
+}
 
-	if msg != "received" {
+// setOrderRequest makes the Order the first one in the driver's batch
+func (d *Driver) setOrderRequest(request Order) {
+	d.batchMu.Lock()
+	defer d.batchMu.Unlock()
+
+	d.OrderRequest = request
+	d.batch = []Order{request}
+}
+
+// ReceiveOrderRequest sends the driver off to pick up the request and blocks
+// until they have tried to pick it up. A driver who waits at the carrier
+// facility under the DispatchStrategy has only tried once they're handed an order
+func (d *Driver) ReceiveOrderRequest(request Order) error {
+	err := d.StartJourney(request)
+	if err != nil {
+		return err
+	}
+
+	// the driver reports exactly once, from their journey or once they're handed
+	// an order they waited for, so there's no need to read their eta here
+	msg := <-d.messages
+	if msg != DRIVER_RECEIVED_MSG {
 		return fmt.Errorf("%s", msg)
 	}
 
 	return nil
 }
 
-// DeliverOrder has no actual logic implemented in this case
-// but necessary for implementing the Courier interface
-func (d *Driver) DeliverOrder() {
-	return
+// StartJourney sends the driver off to pick up the request
+// without waiting for them to arrive at the carrier facility
+func (d *Driver) StartJourney(request Order) error {
+	d.setOrderRequest(request)
+
+	if d.darkKitchen.simulationConfig == nil {
+		return fmt.Errorf(NoSimulationConfigErr)
+	}
+
+	// draw the travel time when the request is received rather than once the
+	// journey has started, so drivers draw from the seed in the order they were dispatched
+	d.etaToCarrierFacility = d.planJourney()
+
+	d.darkKitchen.WG.Add(1)
+	d.darkKitchen.simulationConfig.Clock.Go(d.startDriverJourney)
+
+	return nil
+}
+
+// planJourney picks how many ticks it takes the driver to travel to the
+// carrier facility and lets the order know when it will be picked up
+func (d *Driver) planJourney() int {
+	simulationConfig := d.darkKitchen.simulationConfig
+	d.dispatchedAt = simulationConfig.Clock.Now()
+	if pickupAt := d.OrderRequest.GetExpectedPickupTime(); !pickupAt.IsZero() {
+		// the driver was already on their way when the DarkKitchen was
+		// recovered, so they keep to the pickup time they were given
+		eta := int((pickupAt.Sub(simulationConfig.Clock.Now()) + simulationConfig.SleepTime - 1) / simulationConfig.SleepTime)
+		if eta < 1 {
+			eta = 1
+		}
+		return eta
+	}
+
+	eta := simulationConfig.travelTime().Draw(d.random)
+	d.OrderRequest.SetExpectedPickupTime(simulationConfig.Clock.Now().Add(time.Duration(eta) * simulationConfig.SleepTime))
+
+	return eta
+}
+
+// Recall turns the driver around before they pick up their order
+func (d *Driver) Recall() {
+	atomic.StoreInt32(&d.recalled, 1)
+}
+
+func (d *Driver) IsRecalled() bool {
+	return atomic.LoadInt32(&d.recalled) == 1
+}
+
+// IsDone is true once the driver has tried to
+// pick up their order or has been recalled
+func (d *Driver) IsDone() bool {
+	return atomic.LoadInt32(&d.done) == 1
+}
+
+func (d *Driver) finish() {
+	atomic.StoreInt32(&d.done, 1)
+	if d.darkKitchen.Dispatcher != nil {
+		d.darkKitchen.Dispatcher.releaseDriver(d)
+	}
+}
+
+// DeliverOrder hands the orders over to the customers. There's no travel
+// simulated for the delivery, so the orders are delivered as soon as they are picked up
+func (d *Driver) DeliverOrder() error {
+	for _, order := range d.Orders() {
+		if err := order.TransitionTo(DELIVERED_ORDER_STATE); err != nil {
+			return err
+		}
+
+		d.darkKitchen.publishEvent(Event{Type: ORDER_DELIVERED_EVENT_TYPE, OrderID: order.GetID()})
+	}
+	return nil
 }
 
 // simulate driver journey by sleeping
@@ -89,19 +292,34 @@ func (d *Driver) startDriverJourney() {
 		return
 	}
 
-	d.etaToCarrierFacility = d.darkKitchen.simulationConfig.DriverMinDelay + rand.Intn(d.darkKitchen.simulationConfig.DriverMaxDelay)
 	for {
-		time.Sleep(d.darkKitchen.simulationConfig.SleepTime)
+		d.darkKitchen.simulationConfig.Clock.Sleep(d.darkKitchen.simulationConfig.SleepTime)
+		if d.IsRecalled() {
+			d.finish()
+			d.messages <- DRIVER_RECALLED_MSG
+			return
+		}
+
 		d.etaToCarrierFacility--
-		if d.etaToCarrierFacility == 0 {
+		// an eta that was never positive still ends the journey
+		if d.etaToCarrierFacility <= 0 {
 			break
 		}
 	}
 
-	err := d.ReceiveOrder()
+	// a driver who is waiting reports back once the
+	// Dispatcher hands them the next order that is ready
+	if waiting, err := d.ReceiveOrder(); !waiting {
+		d.report(err)
+	}
+}
+
+// report lets ReceiveOrderRequest know how the driver's pickup went
+func (d *Driver) report(err error) {
 	if err != nil {
 		d.messages <- err.Error()
-	} else {
-		d.messages <- DRIVER_RECEIVED_MSG
+		return
 	}
+
+	d.messages <- DRIVER_RECEIVED_MSG
 }
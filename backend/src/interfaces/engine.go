@@ -0,0 +1,54 @@
+package interfaces
+
+import "time"
+
+// GoroutineEngine implements Engine by giving every Order and every
+// Driver its own goroutine that sleeps on the simulation clock for each tick.
+// This is how the DarkKitchen runs when it is handling real traffic.
+type GoroutineEngine struct {
+	darkKitchen *DarkKitchen
+}
+
+func CreateGoroutineEngine(darkKitchen *DarkKitchen) *GoroutineEngine {
+	return &GoroutineEngine{
+		darkKitchen: darkKitchen,
+	}
+}
+
+func (e *GoroutineEngine) StartDecay(order Order, wasted chan Order, decayValueFn func(float32, float32, float32) float32) {
+	e.darkKitchen.WG.Add(1)
+	e.darkKitchen.simulationConfig.Clock.Go(func() {
+		order.Decay(wasted, decayValueFn)
+	})
+}
+
+// DecayRateChanged has nothing to do since the Order's
+// decay goroutine reads the current decay rate on every tick
+func (e *GoroutineEngine) DecayRateChanged(order Order) {
+	return
+}
+
+// StopDecay has nothing to do since the Order's decay goroutine
+// stops on its own once the Order is no longer on the shelves
+func (e *GoroutineEngine) StopDecay(order Order) {
+	return
+}
+
+// DispatchDriver sends a driver on its way without waiting for them to arrive,
+// so whoever handed the Order to the DarkKitchen gets control back straight away
+func (e *GoroutineEngine) DispatchDriver(order Order) *Driver {
+	driver := CreateDriver(e.darkKitchen)
+	driver.StartJourney(order)
+
+	return &driver
+}
+
+func (e *GoroutineEngine) ReturnDriver(order Order, ticks int) {
+	clock := e.darkKitchen.simulationConfig.Clock
+	e.darkKitchen.WG.Add(1)
+	clock.Go(func() {
+		defer e.darkKitchen.WG.Done()
+		clock.Sleep(time.Duration(ticks) * e.darkKitchen.simulationConfig.SleepTime)
+		e.darkKitchen.Dispatcher.Fleet.driverReturned(order.GetID())
+	})
+}
@@ -1,9 +1,44 @@
 package interfaces
 
 const (
-	NoSimulationConfigErr     = "No simulation config found"
-	NoSpaceLeftErr            = "No space left in shelves"
-	NoSpaceLeftOnShelfErr     = "No space left on particular shelf"
-	NilCarrierFacilityErr     = "Carrier facility is nil"
-	ShelfWithLabelNotFoundErr = "Can't find supported shelf that corresponds to label %s"
+	NoSimulationConfigErr            = "No simulation config found"
+	NoSpaceLeftErr                   = "No space left in shelves"
+	NoSpaceLeftOnShelfErr            = "No space left on particular shelf"
+	NilCarrierFacilityErr            = "Carrier facility is nil"
+	ShelfWithLabelNotFoundErr        = "Can't find supported shelf that corresponds to label %s"
+	NoShelvesErr                     = "A kitchen needs at least one shelf"
+	InvalidShelfLabelErr             = "Shelf label %q is empty or used more than once"
+	InvalidShelfCapacityErr          = "Shelf %s needs a capacity greater than 0"
+	InvalidShelfDecayMultiplierErr   = "Shelf %s can't have a negative decay multiplier"
+	NoShelfTemperaturesErr           = "Shelf %s doesn't accept any temperatures"
+	PlacementPolicyNotFoundErr       = "Can't find placement policy %s"
+	DispatchStrategyNotFoundErr      = "Can't find dispatch strategy %s"
+	NoOrdersReadyErr                 = "No orders are ready to be picked up"
+	NoFakeClockErr                   = "Simulation is not driven by a FakeClock"
+	InvalidOrderTransitionErr        = "Order %s can't go from %s to %s"
+	OrderNotFoundErr                 = "No order found for id: %s"
+	OrdersNotFoundErr                = "No orders found for ids: %s"
+	DuplicateOrderIDsErr             = "Orders asked for more than once: %s"
+	OrderNotCancellableErr           = "Order %s can't be cancelled once it is %s"
+	DarkKitchenStoppedErr            = "Dark kitchen has been stopped and isn't taking orders"
+	InvalidSimulationRequestErr      = "Invalid simulation request: %s"
+	SimulationNotFoundErr            = "No simulation found for id: %s"
+	InvalidSubscriptionBufferSizeErr = "Subscription buffer size has to be at least 1, got %d"
+	SubscriptionPolicyNotFoundErr    = "Can't find subscription policy %s"
+	EventTypeNotFoundErr             = "Can't find event type %s"
+	CorruptEventLogErr               = "Event log entry %d is corrupt: %s"
+	EventLogClosedErr                = "Event log %s has been closed"
+	EventLogRecoveryErr              = "Can't recover event %d from the event log: %s"
+	ShelfSpaceNotFreeErr             = "Space %d on shelf %s doesn't exist or isn't empty"
+	CorruptSnapshotErr               = "Snapshot %d is corrupt: %s"
+	StateInFutureErr                 = "Can't tell what the shelves will look like at %s"
+	CarrierFacilityNotRecoverableErr = "Carrier facility can't be recovered from an event log"
+	CorruptRecordingErr              = "Recorded order %d is corrupt: %s"
+	CourierProviderErr               = "Courier provider answered %s %s with status %d"
+	CourierNotFoundErr               = "No courier is on their way for order %s"
+	CourierEventNotFoundErr          = "Can't find courier event %s"
+	InvalidCourierTransitionErr      = "Courier for order %s can't go from %s to %s"
+	InvalidCourierSignatureErr       = "Courier update isn't signed with the secret shared with the delivery partner"
+	InvalidTravelTimeErr             = "Invalid travel time distribution: %s"
+	InvalidReplaySpeedErr            = "Replay speed has to be more than 0, got %v"
 )
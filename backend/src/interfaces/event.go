@@ -0,0 +1,231 @@
+package interfaces
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventType is the kind of thing that happened in the DarkKitchen
+type EventType string
+
+// Event is something that happened to an Order or its driver. Only the
+// fields that make sense for the Event's type are set
+type Event struct {
+	// Seq goes up by one with every Event published on the same EventStream
+	Seq     uint64    `json:"seq"`
+	Type    EventType `json:"type"`
+	At      time.Time `json:"at"`
+	OrderID string    `json:"orderId"`
+	// the shelf space the Order ended up in, or left
+	Shelf string `json:"shelf,omitempty"`
+	Slot  *int   `json:"slot,omitempty"`
+	// the shelf space an Order that moved came from
+	FromShelf string `json:"fromShelf,omitempty"`
+	FromSlot  *int   `json:"fromSlot,omitempty"`
+	// the Order as it was received, for OrderReceived
+	Order *OrderSnapshot `json:"order,omitempty"`
+	// when the driver is expected to pick the Order up, for DriverDispatched
+	PickupAt *time.Time `json:"pickupAt,omitempty"`
+}
+
+// EventFilter picks out the Events a subscriber is interested in.
+// An empty filter lets every Event through
+type EventFilter struct {
+	Types   map[EventType]bool
+	Shelves map[string]bool
+}
+
+// CreateEventFilter makes an EventFilter for Events of any of the given types
+// that put an Order in, or took it out of, any of the given shelves
+func CreateEventFilter(types []string, shelves []string) (EventFilter, error) {
+	filter := EventFilter{}
+
+	for _, eventType := range types {
+		if !knownEventType(EventType(eventType)) {
+			return filter, fmt.Errorf(EventTypeNotFoundErr, eventType)
+		}
+
+		if filter.Types == nil {
+			filter.Types = map[EventType]bool{}
+		}
+		filter.Types[EventType(eventType)] = true
+	}
+
+	for _, shelfLabel := range shelves {
+		if filter.Shelves == nil {
+			filter.Shelves = map[string]bool{}
+		}
+		filter.Shelves[shelfLabel] = true
+	}
+
+	return filter, nil
+}
+
+// Matches returns true if the Event gets through the filter
+func (f EventFilter) Matches(event Event) bool {
+	if f.Types != nil && !f.Types[event.Type] {
+		return false
+	}
+
+	if f.Shelves != nil && !f.Shelves[event.Shelf] && !f.Shelves[event.FromShelf] {
+		return false
+	}
+
+	return true
+}
+
+// FilterState leaves only the filter's shelves in the state
+func (f EventFilter) FilterState(state ShelfSetState) ShelfSetState {
+	if f.Shelves == nil {
+		return state
+	}
+
+	shelves := map[string][]*ViewableOrder{}
+	for label, shelf := range state.Shelves {
+		if f.Shelves[label] {
+			shelves[label] = shelf
+		}
+	}
+	state.Shelves = shelves
+
+	return state
+}
+
+func knownEventType(eventType EventType) bool {
+	switch eventType {
+	case ORDER_RECEIVED_EVENT_TYPE, ORDER_PLACED_EVENT_TYPE, ORDER_MOVED_TO_OVERFLOW_EVENT_TYPE,
+		ORDER_RESCUED_FROM_OVERFLOW_EVENT_TYPE, ORDER_DECAYED_EVENT_TYPE, ORDER_REJECTED_NO_SPACE_EVENT_TYPE,
+		ORDER_CANCELLED_EVENT_TYPE, DRIVER_DISPATCHED_EVENT_TYPE, DRIVER_RECALLED_EVENT_TYPE, DRIVER_ARRIVED_EVENT_TYPE,
+		ORDER_PICKED_UP_EVENT_TYPE, ORDER_DELIVERED_EVENT_TYPE, SIMULATION_RESET_EVENT_TYPE:
+		return true
+	}
+
+	return false
+}
+
+// EventStream numbers Events in the order they are published and fans
+// them out to its Subscriptions. The most recent Events are kept around
+// so subscribers that fell behind can pick up where they left off
+type EventStream struct {
+	hub *Hub
+
+	mu      sync.Mutex
+	seq     uint64
+	history []Event
+	// every Event is appended here before it is handed to the subscribers.
+	// Appends are synced to disk while holding mu, and the shelves publish
+	// while holding their own lock, so with a log the shelves can only change
+	// as fast as the disk syncs. Batching the syncs would hand out Events
+	// that could still be lost
+	log *EventLog
+}
+
+func CreateEventStream() *EventStream {
+	return &EventStream{
+		hub: CreateHub(),
+	}
+}
+
+// Publish stamps the Event with the next sequence number and hands
+// it to every Subscription without blocking. It returns the stamped Event.
+// An Event that can't be appended to the log isn't handed to anyone
+func (s *EventStream) Publish(event Event) (Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// publishing while holding the lock means subscribers
+	// see the Events in the order they were numbered
+	event.Seq = s.seq + 1
+	if s.log != nil {
+		if err := s.log.Append(event); err != nil {
+			return event, err
+		}
+	}
+	s.seq = event.Seq
+	s.hub.Publish(event)
+
+	s.history = append(s.history, event)
+	if len(s.history) > EVENT_HISTORY_SIZE {
+		s.history = s.history[len(s.history)-EVENT_HISTORY_SIZE:]
+	}
+
+	return event, nil
+}
+
+// Subscribe adds a Subscription that receives every Event published from now on
+func (s *EventStream) Subscribe(bufferSize int, policy string) (*Subscription, error) {
+	return s.hub.Subscribe(bufferSize, policy)
+}
+
+// SubscribeSince adds a Subscription like Subscribe, and also returns every
+// Event published after seq. It returns false if seq is too old to be
+// in the history, or hasn't been published yet, in which case no Events are returned
+func (s *EventStream) SubscribeSince(seq uint64, bufferSize int, policy string) (*Subscription, []Event, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// subscribing while holding the lock means no Event is
+	// left out of, or in both, the backlog and the Subscription
+	subscription, err := s.hub.Subscribe(bufferSize, policy)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	oldest := s.seq + 1
+	if len(s.history) > 0 {
+		oldest = s.history[0].Seq
+	}
+	if seq > s.seq || seq+1 < oldest {
+		return subscription, nil, false, nil
+	}
+
+	backlog := make([]Event, s.seq-seq)
+	copy(backlog, s.history[len(s.history)-len(backlog):])
+
+	return subscription, backlog, true, nil
+}
+
+// attachLog appends every Event published from now on to the log. Sequence
+// numbers carry on from seq, the last one in the log
+func (s *EventStream) attachLog(log *EventLog, seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.log = log
+	if seq > s.seq {
+		s.seq = seq
+	}
+}
+
+// LastSeq returns the sequence number of the last Event published
+func (s *EventStream) LastSeq() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.seq
+}
+
+// publishEvent timestamps the Event with the simulation clock and publishes it
+// The error only needs checking where the change is acknowledged to whoever
+// asked for it. Once the log fails every publish after it does too, see EventLog.Failed
+func (ck *DarkKitchen) publishEvent(event Event) error {
+	if ck == nil || ck.Events == nil || atomic.LoadInt32(&ck.silenced) == 1 {
+		return nil
+	}
+
+	event.At = ck.now()
+	_, err := ck.Events.Publish(event)
+	return err
+}
+
+// publishShelfEvent publishes an Event about an Order in a shelf space
+func (ck *DarkKitchen) publishShelfEvent(eventType EventType, order Order, shelfLabel string, shelfIndex int) {
+	ck.publishEvent(Event{
+		Type:    eventType,
+		OrderID: order.GetID(),
+		Shelf:   shelfLabel,
+		Slot:    &shelfIndex,
+	})
+}
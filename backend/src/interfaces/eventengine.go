@@ -0,0 +1,316 @@
+package interfaces
+
+import (
+	"container/heap"
+	"time"
+)
+
+// EventEngine implements Engine with a single discrete-event loop. Rather than
+// sleeping for every tick, order arrivals, orders decaying to nothing and
+// driver arrivals are pushed onto a priority queue ordered by the tick they happen at,
+// and the loop jumps straight from one event to the next. Placement and pickup
+// still go through the DarkKitchen's OrderHandlers and ShelfSet, so a run gives
+// the same results as the GoroutineEngine without waiting on the wall clock.
+// The loop and everything it calls run on one goroutine, so the EventEngine
+// is not safe for concurrent use.
+type EventEngine struct {
+	darkKitchen *DarkKitchen
+	// the simulated clock that is moved forward to each event,
+	// so anything reading the time sees the simulated time
+	clock  *FakeClock
+	events simulationEvents
+	now    int
+	seq    int
+	// Orders that are decaying on the shelves
+	decaying map[string]*decayingOrder
+}
+
+type decayingOrder struct {
+	order        Order
+	wasted       chan Order
+	decayValueFn func(float32, float32, float32) float32
+	// the tick the Order was last aged to
+	agedTo int
+	// bumped whenever the Order's decay rate changes so stale decay events are skipped
+	version int
+}
+
+type simulationEvent struct {
+	tick    int
+	kind    int
+	seq     int
+	order   Order
+	driver  *Driver
+	version int
+}
+
+func CreateEventEngine(darkKitchen *DarkKitchen) *EventEngine {
+	clock, ok := darkKitchen.simulationConfig.Clock.(*FakeClock)
+	if !ok {
+		// nothing may sleep on the wall clock in an event driven simulation
+		clock = CreateFakeClock(time.Now())
+		darkKitchen.simulationConfig.Clock = clock
+	}
+
+	return &EventEngine{
+		darkKitchen: darkKitchen,
+		clock:       clock,
+		decaying:    map[string]*decayingOrder{},
+	}
+}
+
+// Now returns the current tick of the simulation
+func (e *EventEngine) Now() int {
+	return e.now
+}
+
+// ScheduleOrder has the order arrive at the DarkKitchen at the given tick
+func (e *EventEngine) ScheduleOrder(order Order, tick int) {
+	e.push(&simulationEvent{
+		tick:  tick,
+		kind:  ORDER_ARRIVAL_EVENT,
+		order: order,
+	})
+}
+
+// ScheduleOrders creates an Order for every input and schedules them to arrive
+// one after the other as a poisson process with the given rate of orders per tick
+func (e *EventEngine) ScheduleOrders(inputs []FoodOrderInput, ordersPerTick float64) []Order {
+	orders := []Order{}
+	arrivalTime := float64(e.now)
+	for _, input := range inputs {
+		arrivalTime += e.darkKitchen.random.ExpFloat64() / ordersPerTick
+
+		newOrder := CreateFoodOrder(input.Name, input.DecayRate, input.ShelfLife, input.Temperature, e.darkKitchen)
+		e.ScheduleOrder(&newOrder, int(arrivalTime))
+		orders = append(orders, &newOrder)
+	}
+
+	return orders
+}
+
+// EventSimulationResult sums up a simulation run by RunEventSimulation
+type EventSimulationResult struct {
+	Orders        int
+	Ticks         int
+	Seed          int64
+	PickedUp      int
+	WastedDecay   int
+	WastedNoSpace int
+	Waits         WaitStats
+}
+
+// RunEventSimulation feeds the inputs through a DarkKitchen driven by the EventEngine,
+// arriving at ordersPerTick, and runs it until every Order is done with. The same
+// config and seed always give the same result
+func RunEventSimulation(inputs []FoodOrderInput, ordersPerTick float64, simulationConfig *SimulationConfig) EventSimulationResult {
+	simulationConfig.Engine = EVENT_ENGINE_LABEL
+	darkKitchen := CreateDarkKitchen(simulationConfig)
+	engine := darkKitchen.Engine.(*EventEngine)
+
+	orders := engine.ScheduleOrders(inputs, ordersPerTick)
+	engine.Run()
+
+	result := EventSimulationResult{
+		Orders: len(orders),
+		Ticks:  engine.Now(),
+		Seed:   simulationConfig.Seed,
+		Waits:  darkKitchen.Dispatcher.GetWaitStats(),
+	}
+	for _, order := range orders {
+		if order.GetPickedUp() {
+			result.PickedUp++
+		}
+	}
+
+	state := darkKitchen.CarrierFacility.GetState().(map[string]interface{})
+	result.WastedDecay, _ = state[SHELFSET_WASTED_ORDERS_DECAY_LABEL].(int)
+	result.WastedNoSpace, _ = state[SHELFSET_WASTED_ORDERS_NOSPACE_LABEL].(int)
+
+	return result
+}
+
+// Run handles events until there are none left
+func (e *EventEngine) Run() {
+	for e.events.Len() > 0 {
+		e.handleEvent(heap.Pop(&e.events).(*simulationEvent))
+	}
+}
+
+// RunUntil handles every event up to and including the given tick
+func (e *EventEngine) RunUntil(tick int) {
+	for e.events.Len() > 0 && e.events[0].tick <= tick {
+		e.handleEvent(heap.Pop(&e.events).(*simulationEvent))
+	}
+
+	e.advanceTo(tick)
+}
+
+func (e *EventEngine) StartDecay(order Order, wasted chan Order, decayValueFn func(float32, float32, float32) float32) {
+	decaying := &decayingOrder{
+		order:        order,
+		wasted:       wasted,
+		decayValueFn: decayValueFn,
+		agedTo:       e.now,
+	}
+	e.decaying[order.GetID()] = decaying
+	e.scheduleDecay(decaying)
+}
+
+// DecayRateChanged reschedules when the Order decays
+// to nothing using its new decay rate
+func (e *EventEngine) DecayRateChanged(order Order) {
+	decaying, ok := e.decaying[order.GetID()]
+	if !ok {
+		// the Order is being placed for the first time and hasn't started decaying yet
+		return
+	}
+
+	decaying.version++
+	e.scheduleDecay(decaying)
+}
+
+func (e *EventEngine) StopDecay(order Order) {
+	delete(e.decaying, order.GetID())
+}
+
+func (e *EventEngine) DispatchDriver(order Order) *Driver {
+	driver := CreateDriver(e.darkKitchen)
+	driver.setOrderRequest(order)
+
+	e.push(&simulationEvent{
+		tick:   e.now + driver.planJourney(),
+		kind:   DRIVER_ARRIVAL_EVENT,
+		order:  order,
+		driver: &driver,
+	})
+
+	return &driver
+}
+
+func (e *EventEngine) ReturnDriver(order Order, ticks int) {
+	e.push(&simulationEvent{
+		tick:  e.now + ticks,
+		kind:  DRIVER_RETURN_EVENT,
+		order: order,
+	})
+}
+
+func (e *EventEngine) handleEvent(event *simulationEvent) {
+	if event.kind == ORDER_DECAY_EVENT {
+		// skip decay events for Orders that have been picked up
+		// or whose decay rate has changed since it was scheduled
+		decaying, ok := e.decaying[event.order.GetID()]
+		if !ok || decaying.version != event.version {
+			return
+		}
+	}
+
+	if event.kind == DRIVER_ARRIVAL_EVENT && event.driver.IsRecalled() {
+		// the driver turned around before they got here
+		return
+	}
+
+	e.advanceTo(event.tick)
+
+	switch event.kind {
+	case ORDER_DECAY_EVENT:
+		decaying := e.decaying[event.order.GetID()]
+		delete(e.decaying, event.order.GetID())
+		decaying.wasted <- decaying.order
+		// wait for the shelves to remove the Order before handling the next event
+		e.darkKitchen.CarrierFacility.Sync()
+	case DRIVER_ARRIVAL_EVENT:
+		// the shelves stop the decay of every Order the driver picks up
+		event.driver.ReceiveOrder()
+	case DRIVER_RETURN_EVENT:
+		e.darkKitchen.Dispatcher.Fleet.driverReturned(event.order.GetID())
+	case ORDER_ARRIVAL_EVENT:
+		e.darkKitchen.ReceiveOrder(event.order)
+	}
+}
+
+// advanceTo moves the simulation to the given tick and
+// ages every Order on the shelves to match
+func (e *EventEngine) advanceTo(tick int) {
+	if tick <= e.now {
+		return
+	}
+
+	e.clock.Advance(time.Duration(tick-e.now) * e.darkKitchen.simulationConfig.SleepTime)
+	e.now = tick
+
+	for _, decaying := range e.decaying {
+		decaying.order.AgeBy(float32(tick-decaying.agedTo), decaying.decayValueFn)
+		decaying.agedTo = tick
+	}
+}
+
+// scheduleDecay pushes an event for the first tick
+// the Order's health is at or below 0
+func (e *EventEngine) scheduleDecay(decaying *decayingOrder) {
+	order := decaying.order
+	snapshot := order.Snapshot()
+	lastHealth := decaying.decayValueFn(snapshot.ShelfLife, snapshot.OrderAge, snapshot.CurrentDecayRate)
+	for ticks := 1; ; ticks++ {
+		health := decaying.decayValueFn(snapshot.ShelfLife, snapshot.OrderAge+float32(ticks), snapshot.CurrentDecayRate)
+		if health <= 0 {
+			e.push(&simulationEvent{
+				tick:    e.now + ticks,
+				kind:    ORDER_DECAY_EVENT,
+				order:   order,
+				version: decaying.version,
+			})
+			return
+		}
+
+		if health >= lastHealth {
+			// the Order never decays
+			return
+		}
+		lastHealth = health
+	}
+}
+
+func (e *EventEngine) push(event *simulationEvent) {
+	event.seq = e.seq
+	e.seq++
+	heap.Push(&e.events, event)
+}
+
+// Implement heap interface to use simulationEvents as a priority queue - https://golang.org/pkg/container/heap/#Interface
+// Events are ordered by tick, then by kind so that orders decay before drivers pick them up
+// on the same tick, then by the order they were scheduled in
+type simulationEvents []*simulationEvent
+
+func (s simulationEvents) Len() int {
+	return len(s)
+}
+
+func (s simulationEvents) Less(i, j int) bool {
+	if s[i].tick != s[j].tick {
+		return s[i].tick < s[j].tick
+	}
+
+	if s[i].kind != s[j].kind {
+		return s[i].kind < s[j].kind
+	}
+
+	return s[i].seq < s[j].seq
+}
+
+func (s simulationEvents) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s *simulationEvents) Push(event interface{}) {
+	*s = append(*s, event.(*simulationEvent))
+}
+
+func (s *simulationEvents) Pop() interface{} {
+	old := *s
+	event := old[len(old)-1]
+	*s = old[:len(old)-1]
+
+	return event
+}
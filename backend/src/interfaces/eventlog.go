@@ -0,0 +1,204 @@
+package interfaces
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// EventLog is an append-only file of every Event a DarkKitchen publishes, one
+// JSON object per line. Events are appended and synced to disk as they are
+// published, before the change they describe is acknowledged to whoever asked
+// for it, so a DarkKitchen can be rebuilt from the log after a crash
+type EventLog struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	// the Events that were in the file when it was opened
+	events []Event
+	// where the next Event is appended
+	end int64
+	// once an append fails nothing more is appended,
+	// since a log with a gap in it can't be recovered
+	err error
+	// closed once err is set
+	failed chan struct{}
+}
+
+// CreateEventLog opens the log at path, creating it if it doesn't exist. An
+// entry that was only partly written when the backend went down is cut off
+func CreateEventLog(path string) (*EventLog, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	events, end, err := readEventLog(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if err := file.Truncate(end); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if _, err := file.Seek(end, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &EventLog{
+		path:   path,
+		file:   file,
+		events: events,
+		end:    end,
+		failed: make(chan struct{}),
+	}, nil
+}
+
+// readEventLog reads every complete entry in the file and
+// returns them along with the offset the last one ends at
+func readEventLog(file *os.File) ([]Event, int64, error) {
+	events := []Event{}
+	reader := bufio.NewReader(file)
+	var end int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// anything left over is an entry that never finished being written
+			return events, end, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var event Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			return nil, 0, fmt.Errorf(CorruptEventLogErr, len(events)+1, err.Error())
+		}
+
+		events = append(events, event)
+		end += int64(len(line))
+	}
+}
+
+// Events returns the Events that were in the log when it was opened
+func (l *EventLog) Events() []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	events := make([]Event, len(l.events))
+	copy(events, l.events)
+	return events
+}
+
+// Size returns how much of the file has been appended to, for ReadFrom
+func (l *EventLog) Size() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.end
+}
+
+// ReadFrom reads the Events in the log from offset, one Size returned,
+// up to the last one published at or before until. The ones appended
+// since the log was opened are included
+func (l *EventLog) ReadFrom(offset int64, until time.Time) ([]Event, error) {
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	events := []Event{}
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		// an entry that is still being appended is left out like a torn one
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var event Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			return nil, err
+		}
+		if event.At.After(until) {
+			return events, nil
+		}
+
+		events = append(events, event)
+	}
+}
+
+// Append writes the Event to the end of the log and waits for it to reach the disk
+func (l *EventLog) Append(event Event) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.err != nil {
+		return l.err
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return l.fail(err)
+	}
+
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return l.fail(err)
+	}
+
+	if err := l.file.Sync(); err != nil {
+		return l.fail(err)
+	}
+	l.end += int64(len(line)) + 1
+
+	return nil
+}
+
+// fail stops anything more from being appended. must be called while holding l.mu
+func (l *EventLog) fail(err error) error {
+	l.err = err
+	close(l.failed)
+	return err
+}
+
+// Err returns the error that stopped the log from being appended to, if any
+func (l *EventLog) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.err
+}
+
+// Failed is closed as soon as an append fails, e.g. so the backend can
+// stop before it acknowledges any more changes it won't be able to recover
+func (l *EventLog) Failed() <-chan struct{} {
+	return l.failed
+}
+
+// Close closes the file. Nothing can be appended afterwards
+func (l *EventLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.err == nil {
+		l.err = fmt.Errorf(EventLogClosedErr, l.path)
+	}
+
+	return l.file.Close()
+}
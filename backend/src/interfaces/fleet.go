@@ -0,0 +1,224 @@
+package interfaces
+
+import (
+	"sync"
+	"time"
+)
+
+// Fleet is the pool of drivers the Dispatcher sends for Orders. Each driver is
+// available, en route to pick up an Order, or returning once they are done with
+// it, which takes as long as their trip out did. Orders that are ready while every
+// driver is busy queue up and get the next driver to come back, oldest first.
+// A Fleet of size 0 has as many drivers as there are Orders
+type Fleet struct {
+	mu          sync.Mutex
+	darkKitchen *DarkKitchen
+	size        int
+	couriers    []*courier
+	// Orders waiting for a driver, oldest first
+	queue []Order
+}
+
+// courier is a driver in the Fleet, and the Order they were last sent for
+type courier struct {
+	state        string
+	orderID      string
+	dispatchedAt time.Time
+}
+
+// FleetState is how busy the Fleet is
+type FleetState struct {
+	// 0 for a Fleet with a driver for every Order
+	Size      int `json:"size"`
+	Available int `json:"available"`
+	EnRoute   int `json:"enRoute"`
+	Returning int `json:"returning"`
+	// Orders on the shelves waiting for a driver
+	Queued int `json:"queued"`
+	// the fraction of drivers that aren't available
+	Utilization float32 `json:"utilization"`
+}
+
+func CreateFleet(darkKitchen *DarkKitchen, size int) *Fleet {
+	fleet := &Fleet{
+		darkKitchen: darkKitchen,
+		size:        size,
+	}
+
+	for i := 0; i < size; i++ {
+		fleet.couriers = append(fleet.couriers, &courier{state: AVAILABLE_DRIVER_STATE})
+	}
+
+	return fleet
+}
+
+// request sends an available driver for the Order, or queues it until one is free
+func (f *Fleet) request(order Order) {
+	f.mu.Lock()
+	courier := f.availableCourier()
+	if courier == nil {
+		f.queue = append(f.queue, order)
+		f.mu.Unlock()
+		return
+	}
+	f.assign(courier, order)
+	f.mu.Unlock()
+
+	f.darkKitchen.Dispatcher.sendDriver(order)
+}
+
+// resume takes a driver for an Order whose driver was already on their way
+// when the DarkKitchen was recovered. Drivers keep their pickup times, so the
+// Order isn't queued, even if that means sending more drivers than the Fleet has
+func (f *Fleet) resume(order Order) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if courier := f.availableCourier(); courier != nil {
+		f.assign(courier, order)
+	}
+}
+
+// driverDone sends the Order's driver back once they have tried to pick it up
+func (f *Fleet) driverDone(order Order) {
+	f.mu.Lock()
+	courier := f.courierFor(order.GetID(), EN_ROUTE_DRIVER_STATE)
+	if courier == nil {
+		f.mu.Unlock()
+		return
+	}
+
+	if f.size == 0 {
+		f.remove(courier)
+		f.mu.Unlock()
+		return
+	}
+
+	courier.state = RETURNING_DRIVER_STATE
+	ticks := int(ticksBetween(courier.dispatchedAt, f.darkKitchen.now(), f.darkKitchen.simulationConfig.SleepTime))
+	f.mu.Unlock()
+
+	if ticks == 0 {
+		f.driverReturned(order.GetID())
+		return
+	}
+	f.darkKitchen.Engine.ReturnDriver(order, ticks)
+}
+
+// dequeue takes a cancelled Order out of the queue, if it is waiting for a driver
+func (f *Fleet) dequeue(order Order) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for idx, queued := range f.queue {
+		if queued.GetID() == order.GetID() {
+			f.queue = append(f.queue[:idx], f.queue[idx+1:]...)
+			return
+		}
+	}
+}
+
+// driverReturned makes the driver who went for the Order available
+// again, and sends them for the oldest Order that is waiting, if any
+func (f *Fleet) driverReturned(orderID string) {
+	f.mu.Lock()
+	courier := f.courierFor(orderID, RETURNING_DRIVER_STATE)
+	if courier == nil {
+		f.mu.Unlock()
+		return
+	}
+	courier.state = AVAILABLE_DRIVER_STATE
+	courier.orderID = ""
+
+	var next Order
+	for len(f.queue) > 0 && next == nil {
+		// Orders that left the shelves while they waited don't need a driver anymore
+		if f.queue[0].GetState().OnShelves() {
+			next = f.queue[0]
+			f.assign(courier, next)
+		}
+		f.queue = f.queue[1:]
+	}
+	f.mu.Unlock()
+
+	if next != nil {
+		f.darkKitchen.Dispatcher.sendDriver(next)
+	}
+}
+
+// GetState counts the drivers in each state and the Orders waiting for one
+func (f *Fleet) GetState() FleetState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	state := FleetState{Size: f.size}
+	for _, courier := range f.couriers {
+		switch courier.state {
+		case AVAILABLE_DRIVER_STATE:
+			state.Available++
+		case EN_ROUTE_DRIVER_STATE:
+			state.EnRoute++
+		case RETURNING_DRIVER_STATE:
+			state.Returning++
+		}
+	}
+
+	for _, order := range f.queue {
+		if order.GetState().OnShelves() {
+			state.Queued++
+		}
+	}
+
+	if f.size > 0 {
+		state.Utilization = float32(state.EnRoute+state.Returning) / float32(f.size)
+	}
+
+	return state
+}
+
+// availableCourier returns a driver who is free to be sent for an Order, or
+// nil if every driver is busy. must be called while holding f.mu
+func (f *Fleet) availableCourier() *courier {
+	for _, courier := range f.couriers {
+		if courier.state == AVAILABLE_DRIVER_STATE {
+			return courier
+		}
+	}
+
+	if f.size == 0 {
+		courier := &courier{state: AVAILABLE_DRIVER_STATE}
+		f.couriers = append(f.couriers, courier)
+		return courier
+	}
+
+	return nil
+}
+
+// must be called while holding f.mu
+func (f *Fleet) assign(courier *courier, order Order) {
+	courier.state = EN_ROUTE_DRIVER_STATE
+	courier.orderID = order.GetID()
+	courier.dispatchedAt = f.darkKitchen.now()
+}
+
+// courierFor returns the driver in the given state who was sent
+// for the Order, if there is one. must be called while holding f.mu
+func (f *Fleet) courierFor(orderID string, state string) *courier {
+	for _, courier := range f.couriers {
+		if courier.orderID == orderID && courier.state == state {
+			return courier
+		}
+	}
+
+	return nil
+}
+
+// must be called while holding f.mu
+func (f *Fleet) remove(courier *courier) {
+	for idx := range f.couriers {
+		if f.couriers[idx] == courier {
+			f.couriers = append(f.couriers[:idx], f.couriers[idx+1:]...)
+			return
+		}
+	}
+}
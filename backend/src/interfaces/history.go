@@ -0,0 +1,249 @@
+package interfaces
+
+import (
+	"fmt"
+	"time"
+)
+
+// pastOrder is an Order on the shelves while they are being rebuilt
+type pastOrder struct {
+	snapshot OrderSnapshot
+	// the Order is age ticks old at since, and ages a tick at a time from there
+	age   float32
+	since time.Time
+}
+
+// StateAt rebuilds what the shelves looked like at the given time from the
+// last snapshot taken at or before then, or from empty shelves if there isn't
+// one, and the Events logged after it. The Orders on the shelves are aged by
+// the ticks that had passed since they were placed, and their health worked
+// out from their age and the shelf they were on. snapshots can be nil
+func (ck *DarkKitchen) StateAt(at time.Time, log *EventLog, snapshots *SnapshotStore) (ShelfSetSnapshot, error) {
+	if at.After(ck.now()) {
+		return ShelfSetSnapshot{}, fmt.Errorf(StateInFutureErr, at.Format(time.RFC3339))
+	}
+
+	shelfSet, ok := ck.CarrierFacility.(*ShelfSet)
+	if !ok {
+		return ShelfSetSnapshot{}, fmt.Errorf(CarrierFacilityNotRecoverableErr)
+	}
+
+	past := &pastShelves{shelfSet: shelfSet}
+	past.clear()
+
+	received := map[string]OrderSnapshot{}
+	placedAt := map[string]time.Time{}
+	pickupAt := map[string]time.Time{}
+	var offset int64
+	if snapshots != nil {
+		snapshot, ok, err := snapshots.Latest(at)
+		if err != nil {
+			return ShelfSetSnapshot{}, err
+		}
+
+		if ok {
+			past.restore(snapshot)
+			offset = snapshot.LogOffset
+			for orderID, order := range snapshot.Received {
+				received[orderID] = order
+			}
+			for orderID, placed := range snapshot.PlacedAt {
+				placedAt[orderID] = placed
+			}
+		}
+	}
+
+	// a snapshot without an offset is replayed from the start of the log
+	events, err := log.ReadFrom(offset, at)
+	if err != nil {
+		return ShelfSetSnapshot{}, err
+	}
+
+	for _, event := range events {
+		// the Events between the offset and the snapshot are already on
+		// its shelves, but still say when their Orders were received or
+		// placed, or when their drivers were due
+		switch event.Type {
+		case ORDER_RECEIVED_EVENT_TYPE:
+			if event.Order != nil {
+				received[event.OrderID] = *event.Order
+			}
+		case ORDER_PLACED_EVENT_TYPE:
+			placedAt[event.OrderID] = event.At
+		case DRIVER_DISPATCHED_EVENT_TYPE:
+			if event.PickupAt != nil {
+				pickupAt[event.OrderID] = *event.PickupAt
+			}
+		}
+
+		if event.Seq > past.version {
+			past.apply(event, received)
+		}
+	}
+
+	return past.at(at, placedAt, pickupAt, ck.simulationConfig.SleepTime), nil
+}
+
+// TakeSnapshot snapshots the shelves for StateAt, along with where in the log
+// to carry on from and when the Orders on them were placed, so StateAt doesn't
+// have to read the log from the start
+func (ck *DarkKitchen) TakeSnapshot(log *EventLog) ShelfSetSnapshot {
+	// taken before the shelves, so no Event after the snapshot is skipped
+	offset := log.Size()
+	snapshot := ck.CarrierFacility.GetSnapshot()
+	snapshot.LogOffset = offset
+	snapshot.Received = map[string]OrderSnapshot{}
+	snapshot.PlacedAt = map[string]time.Time{}
+
+	ck.ordersMu.RLock()
+	defer ck.ordersMu.RUnlock()
+
+	for _, order := range ck.orders {
+		switch state := order.GetState(); {
+		case state == QUEUED_ORDER_STATE || state == COOKING_ORDER_STATE || state == DISPATCHING_ORDER_STATE:
+			// received, but still on its way to the shelves
+			snapshot.Received[order.GetID()] = order.Snapshot()
+		case state.OnShelves():
+			for _, transition := range order.GetTransitions() {
+				if transition.State.OnShelves() {
+					snapshot.PlacedAt[order.GetID()] = transition.At
+					break
+				}
+			}
+		}
+	}
+
+	return snapshot
+}
+
+// pastShelves are the shelves as they are rebuilt, one Event at a time
+type pastShelves struct {
+	shelfSet *ShelfSet
+	shelves  map[string][]*pastOrder
+	counts   map[string]int
+	version  uint64
+}
+
+// clear empties the shelves and the counts
+func (p *pastShelves) clear() {
+	p.shelves = map[string][]*pastOrder{}
+	for _, shelfConfig := range p.shelfSet.shelfConfigs {
+		p.shelves[shelfConfig.Label] = make([]*pastOrder, shelfConfig.Capacity)
+	}
+
+	p.counts = map[string]int{
+		SHELFSET_WASTED_ORDERS_DECAY_LABEL:   0,
+		SHELFSET_WASTED_ORDERS_NOSPACE_LABEL: 0,
+		SHELFSET_CANCELLED_ORDERS_LABEL:      0,
+	}
+}
+
+// restore starts the shelves off from a snapshot. Shelves that
+// aren't in the kitchen's layout anymore are left out
+func (p *pastShelves) restore(snapshot ShelfSetSnapshot) {
+	p.version = snapshot.Version
+	for label, count := range snapshot.Counts {
+		p.counts[label] = count
+	}
+
+	for label, shelf := range snapshot.Shelves {
+		for idx, order := range shelf {
+			if order != nil && idx < len(p.shelves[label]) {
+				p.shelves[label][idx] = &pastOrder{snapshot: *order, age: order.OrderAge, since: snapshot.At}
+			}
+		}
+	}
+}
+
+// apply makes the change the Event describes
+func (p *pastShelves) apply(event Event, received map[string]OrderSnapshot) {
+	p.version = event.Seq
+	if event.Type == SIMULATION_RESET_EVENT_TYPE {
+		p.clear()
+		return
+	}
+
+	if label, ok := countLabel(event.Type); ok {
+		p.counts[label]++
+	}
+
+	var moving *pastOrder
+	if event.FromSlot != nil {
+		moving = p.take(event.FromShelf, *event.FromSlot)
+	}
+
+	if event.Slot == nil {
+		return
+	}
+
+	switch event.Type {
+	case ORDER_PLACED_EVENT_TYPE:
+		if order, ok := received[event.OrderID]; ok {
+			p.put(&pastOrder{snapshot: order, since: event.At}, event.Shelf, *event.Slot)
+		}
+	case ORDER_MOVED_TO_OVERFLOW_EVENT_TYPE, ORDER_RESCUED_FROM_OVERFLOW_EVENT_TYPE:
+		if moving != nil {
+			p.put(moving, event.Shelf, *event.Slot)
+		}
+	default:
+		p.take(event.Shelf, *event.Slot)
+	}
+}
+
+func (p *pastShelves) take(label string, idx int) *pastOrder {
+	if idx < 0 || idx >= len(p.shelves[label]) {
+		return nil
+	}
+
+	order := p.shelves[label][idx]
+	p.shelves[label][idx] = nil
+	return order
+}
+
+// put places the Order in the given space and has it decay at that shelf's rate
+func (p *pastShelves) put(order *pastOrder, label string, idx int) {
+	if idx < 0 || idx >= len(p.shelves[label]) {
+		return
+	}
+
+	shelfConfig := p.shelfSet.shelfConfigsByLabel[label]
+	order.snapshot.State = ON_SHELF_ORDER_STATE
+	if shelfConfig.Overflow {
+		order.snapshot.State = IN_OVERFLOW_ORDER_STATE
+	}
+	order.snapshot.CurrentDecayRate = shelfConfig.DecayMultiplier * order.snapshot.OriginalDecayRate
+	p.shelves[label][idx] = order
+}
+
+// at returns the shelves with every Order aged to the given time
+func (p *pastShelves) at(at time.Time, placedAt map[string]time.Time, pickupAt map[string]time.Time, sleepTime time.Duration) ShelfSetSnapshot {
+	snapshot := ShelfSetSnapshot{
+		At:      at,
+		Version: p.version,
+		Shelves: map[string][]*OrderSnapshot{},
+		Counts:  p.counts,
+	}
+
+	for label, shelf := range p.shelves {
+		snapshot.Shelves[label] = make([]*OrderSnapshot, len(shelf))
+		for idx, order := range shelf {
+			if order == nil {
+				continue
+			}
+
+			orderSnapshot := order.snapshot
+			if since, ok := placedAt[orderSnapshot.ID]; ok {
+				orderSnapshot.OrderAge = ticksBetween(since, at, sleepTime)
+			} else {
+				orderSnapshot.OrderAge = order.age + ticksBetween(order.since, at, sleepTime)
+			}
+			if pickup, ok := pickupAt[orderSnapshot.ID]; ok {
+				orderSnapshot.ExpectedPickupTime = pickup
+			}
+			orderSnapshot.Health = getShelfDecayValue(orderSnapshot.ShelfLife, orderSnapshot.OrderAge, orderSnapshot.CurrentDecayRate)
+			snapshot.Shelves[label][idx] = &orderSnapshot
+		}
+	}
+
+	return snapshot
+}
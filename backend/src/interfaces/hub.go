@@ -0,0 +1,195 @@
+package interfaces
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Hub fans every message published to it out to all of its Subscriptions.
+// Each Subscription buffers messages on its own, so publishing never waits on
+// a subscriber, and a slow subscriber only ever loses its own messages
+type Hub struct {
+	mu            sync.RWMutex
+	subscriptions map[*Subscription]bool
+}
+
+// Subscription is one subscriber's bounded buffer of messages published to a Hub
+type Subscription struct {
+	hub        *Hub
+	bufferSize int
+	policy     string
+
+	mu      sync.Mutex
+	pending []interface{}
+	dropped int
+	// has a value in it while there are pending messages
+	ready chan struct{}
+	done  chan struct{}
+}
+
+// Coalescer is implemented by messages that can stand in for an earlier,
+// still pending message with the same key under COALESCE_SUBSCRIPTION_POLICY
+type Coalescer interface {
+	CoalesceKey() string
+}
+
+func CreateHub() *Hub {
+	return &Hub{
+		subscriptions: map[*Subscription]bool{},
+	}
+}
+
+// Subscribe adds a Subscription that holds up to bufferSize messages. What
+// happens when it is full is decided by policy, either DROP_SUBSCRIPTION_POLICY
+// or COALESCE_SUBSCRIPTION_POLICY
+func (h *Hub) Subscribe(bufferSize int, policy string) (*Subscription, error) {
+	if bufferSize < 1 {
+		return nil, fmt.Errorf(InvalidSubscriptionBufferSizeErr, bufferSize)
+	}
+
+	if policy != DROP_SUBSCRIPTION_POLICY && policy != COALESCE_SUBSCRIPTION_POLICY {
+		return nil, fmt.Errorf(SubscriptionPolicyNotFoundErr, policy)
+	}
+
+	subscription := &Subscription{
+		hub:        h,
+		bufferSize: bufferSize,
+		policy:     policy,
+		ready:      make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.subscriptions[subscription] = true
+
+	return subscription, nil
+}
+
+// Publish hands the message to every Subscription without blocking.
+// Messages published while there are no Subscriptions are dropped
+func (h *Hub) Publish(message interface{}) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for subscription := range h.subscriptions {
+		subscription.offer(message)
+	}
+}
+
+// SubscriberCount returns the number of open Subscriptions
+func (h *Hub) SubscriberCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return len(h.subscriptions)
+}
+
+// offer buffers the message, making room for it according to the policy
+func (s *Subscription) offer(message interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.policy == COALESCE_SUBSCRIPTION_POLICY {
+		if idx := s.pendingIndex(message); idx >= 0 {
+			// the newer message takes the older one's place in line
+			s.pending[idx] = message
+			s.signal()
+			return
+		}
+	}
+
+	if len(s.pending) >= s.bufferSize {
+		s.dropped++
+		if s.policy == DROP_SUBSCRIPTION_POLICY {
+			return
+		}
+
+		// coalescing keeps the newest messages
+		s.pending = s.pending[1:]
+	}
+
+	s.pending = append(s.pending, message)
+	s.signal()
+}
+
+// pendingIndex returns where a pending message with the same coalesce key as
+// message sits, or -1 if there isn't one. must be called while holding s.mu
+func (s *Subscription) pendingIndex(message interface{}) int {
+	key, ok := coalesceKey(message)
+	if !ok {
+		return -1
+	}
+
+	for idx, pending := range s.pending {
+		if pendingKey, ok := coalesceKey(pending); ok && pendingKey == key {
+			return idx
+		}
+	}
+
+	return -1
+}
+
+func coalesceKey(message interface{}) (string, bool) {
+	switch m := message.(type) {
+	case Coalescer:
+		return m.CoalesceKey(), true
+	case string:
+		return m, true
+	}
+
+	return "", false
+}
+
+// must be called while holding s.mu
+func (s *Subscription) signal() {
+	select {
+	case s.ready <- struct{}{}:
+	default:
+		// the subscriber hasn't picked up the last signal yet
+	}
+}
+
+// Ready receives a value when there are messages to Drain
+func (s *Subscription) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Done is closed once the Subscription is closed
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Drain returns every pending message, oldest first
+func (s *Subscription) Drain() []interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := s.pending
+	s.pending = nil
+
+	return messages
+}
+
+// Dropped returns how many messages the Subscription
+// has lost because it was full
+func (s *Subscription) Dropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.dropped
+}
+
+// Close removes the Subscription from its Hub. It is safe to call more than once
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	if !s.hub.subscriptions[s] {
+		return
+	}
+
+	delete(s.hub.subscriptions, s)
+	close(s.done)
+}
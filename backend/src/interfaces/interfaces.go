@@ -1,6 +1,9 @@
 package interfaces
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type Order interface {
 	GetID() string
@@ -14,14 +17,31 @@ type Order interface {
 	SetOrderAge(float32)
 	GetHealth() float32
 	GetPickedUp() bool
-	SetPickedUp(bool)
+	// GetState returns where the Order is in its lifecycle
+	GetState() OrderState
+	// TransitionTo moves the Order into the given state and records when it
+	// happened. It errors if the Order can't go there from its current state
+	TransitionTo(OrderState) error
+	// GetTransitions returns every state the Order has been in, oldest first
+	GetTransitions() []OrderTransition
+	// when the Order's driver is expected to arrive, or
+	// the zero time if no driver has been dispatched yet
+	GetExpectedPickupTime() time.Time
+	SetExpectedPickupTime(time.Time)
 	// pass in decay func w/ (shelfLife, orderAge, decayRate) format
 	Decay(chan Order, func(float32, float32, float32) float32)
+	AgeBy(float32, func(float32, float32, float32) float32) float32
+	// Snapshot returns the Order's state read all at once. Use it rather than
+	// the individual getters when the values have to agree with each other
+	Snapshot() OrderSnapshot
 }
 
 type OrderHandler interface {
 	SetNextOrderHandler(OrderHandler)
 	HandleOrder(Order) error
+	// CancelOrder withdraws an Order that was handled before. Each handler
+	// undoes its part of the Order's processing, and errors if it can't be cancelled
+	CancelOrder(Order) error
 }
 
 type Courier interface {
@@ -41,11 +61,96 @@ type Courier interface {
 type CarrierFacility interface {
 	OrderHandler
 	GiveOrder(string) (Order, error)
+	// GiveOrders hands over every Order with the given ids or none of
+	// them, along with the ids that aren't in the carrier facility.
+	// Asking for an id more than once gets none of them
+	GiveOrders([]string) ([]Order, []string, error)
+	// GetOrders returns every Order in the carrier facility and where it is
+	GetOrders() []ShelfOrder
+	// GetOrderShelf returns the label of the shelf an Order is
+	// on, or an empty string if it isn't in the carrier facility
+	GetOrderShelf(string) string
 	GetState() interface{}
+	// GetVersionedState returns every space in the carrier facility
+	// and the sequence number of the last Event it reflects
+	GetVersionedState() ShelfSetState
+	// GetSnapshot returns every space in the carrier facility with the
+	// Orders in them in full, as of now
+	GetSnapshot() ShelfSetSnapshot
+	// Sync blocks until the carrier facility has handled
+	// everything that was sent to it asynchronously
+	Sync()
 	Start()
 	Shutdown()
 }
 
+// Clock is how every timed loop in the DarkKitchen waits for
+// time to pass. Swapping it out lets a simulation be stepped manually
+// instead of waiting on the wall clock.
+type Clock interface {
+	Now() time.Time
+	Sleep(time.Duration)
+	// Go starts the function in a goroutine that sleeps on this Clock
+	Go(func())
+}
+
+// PlacementPolicy decides which Orders get to sit on the temperature shelves
+// when there isn't enough space for all of them. The ShelfSet delegates every
+// choice of what goes to overflow, what is thrown away and what comes back to it.
+type PlacementPolicy interface {
+	// ChooseForOverflow picks which of the Orders on the incoming Order's full
+	// temperature shelves moves to overflow to make room for it. Returning nil
+	// sends the incoming Order to overflow instead
+	ChooseForOverflow(incoming Order, candidates []ShelfOrder) *ShelfOrder
+	// ChooseEviction picks which Order on the overflow shelves is thrown away when
+	// they are full too. Returning nil rejects the incoming Order instead
+	ChooseEviction(incoming Order, overflowOrders []ShelfOrder) *ShelfOrder
+	// ChooseFromOverflow picks which overflow Order moves
+	// into a space that has been freed on a temperature shelf
+	ChooseFromOverflow(candidates []ShelfOrder) *ShelfOrder
+}
+
+// DispatchStrategy decides which Orders a driver leaves with once
+// they get to the carrier facility, and what they do if there are none
+type DispatchStrategy interface {
+	Label() string
+	// ChooseOrders picks which Orders a driver who was sent for the given
+	// Orders picks up, out of every Order that is ready on the shelves
+	ChooseOrders(sentFor []Order, ready []ShelfOrder) []Order
+	// WaitsForOrders is true when a driver who has nothing to pick up
+	// waits for the next Order, rather than leaving empty handed
+	WaitsForOrders() bool
+}
+
+// CourierProvider requests couriers for Orders from a delivery partner e.g.
+// UberEATS or DoorDash, in place of the kitchen's own simulated drivers. The
+// partner reports back on each courier through CourierWebhooks
+type CourierProvider interface {
+	// RequestCourier asks for a courier to pick up the Order
+	RequestCourier(Order) (CourierStatus, error)
+	// TrackCourier returns what the partner knows about the Order's courier
+	TrackCourier(orderID string) (CourierStatus, error)
+	// CancelCourier calls off the Order's courier
+	CancelCourier(orderID string) error
+}
+
+// Engine drives the passage of time for a DarkKitchen i.e. how
+// Orders decay on the shelves and how drivers travel to pick them up
+type Engine interface {
+	// StartDecay begins decaying an Order that was just placed on the shelves.
+	// Orders that decay to nothing are sent to the wasted channel
+	StartDecay(order Order, wasted chan Order, decayValueFn func(float32, float32, float32) float32)
+	// DecayRateChanged is called whenever an Order moves between shelves
+	DecayRateChanged(Order)
+	// StopDecay is called when an Order leaves the shelves before it decays
+	StopDecay(Order)
+	// DispatchDriver sends a Driver to pick up the Order and returns it
+	DispatchDriver(Order) *Driver
+	// ReturnDriver brings the driver who went for the Order
+	// back to the Fleet after the given number of ticks
+	ReturnDriver(order Order, ticks int)
+}
+
 // base class for OrderHandler
 type BaseOrderHandler struct {
 	nextOrderHandler OrderHandler
@@ -67,3 +172,11 @@ func (b *BaseOrderHandler) HandleOrder(order Order) error {
 
 	return nil
 }
+
+func (b *BaseOrderHandler) CancelOrder(order Order) error {
+	if b.nextOrderHandler == nil {
+		return fmt.Errorf("nextOrderHandler is nil")
+	}
+
+	return b.nextOrderHandler.CancelOrder(order)
+}
@@ -1,10 +1,23 @@
 package interfaces_test
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/drshrey/darkkitchen/backend/src/interfaces"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // Testing the order creation flow
@@ -42,119 +55,2238 @@ func TestReceiveOrder_Success(t *testing.T) {
 
 func TestReceiveOrder_Failure_GetWastedOrdersThatCannotBeAddedToShelves(t *testing.T) {
 	simulationConfig := interfaces.CreateSimulationConfig(100, 100, 10*time.Millisecond)
+	fakeClock := interfaces.CreateFakeClock(time.Time{})
+	simulationConfig.Clock = fakeClock
 	ck := interfaces.CreateDarkKitchen(simulationConfig)
 
+	receiveErrs := make(chan error, 40)
+	for i := 0; i < 40; i++ {
+		newOrder := interfaces.CreateFoodOrder("order-name", 0.1, 100, interfaces.HOT_TEMPERATURE_LABEL, ck)
+		go func(order interfaces.Order) {
+			receiveErrs <- ck.ReceiveOrder(order)
+		}(&newOrder)
+
+		// max is 35 since temp shelf(15) + overflow_shelf(20) = 35, and every order
+		// that fits on the shelves parks a decay and a driver goroutine
+		if i < 35 {
+			fakeClock.BlockUntil(2 * (i + 1))
+		}
+	}
+
+	// every order decays before its driver arrives
+	ck.Step(200)
+
 	wastedOrdersCount := 0
 	for i := 0; i < 40; i++ {
-		ck.WG.Add(1)
-		go func(idx int) {
-			defer ck.WG.Done()
-			newOrder := interfaces.CreateFoodOrder("order-name", 0.1, 100, interfaces.HOT_TEMPERATURE_LABEL, ck)
-			err := ck.ReceiveOrder(&newOrder)
-			if err != nil {
-				wastedOrdersCount++
+		if err := <-receiveErrs; err != nil {
+			wastedOrdersCount++
+		}
+	}
+
+	ck.WG.Wait()
+
+	if wastedOrdersCount != 5 {
+		t.Error("wasted order count is not exactly 5")
+	}
+
+	state := ck.CarrierFacility.GetState().(map[string]interface{})
+	if state[interfaces.SHELFSET_WASTED_ORDERS_DECAY_LABEL] != 35 {
+		t.Errorf("expected 35 decayed orders, got %v", state[interfaces.SHELFSET_WASTED_ORDERS_DECAY_LABEL])
+	}
+}
+
+func TestReceiveOrder_Success_AllTemperatureOrders(t *testing.T) {
+	simulationConfig := interfaces.CreateSimulationConfig(20, 20, 10)
+	ck := interfaces.CreateDarkKitchen(simulationConfig)
+
+	orders := make(chan *interfaces.FoodOrder, 45)
+	for _, label := range []string{interfaces.HOT_TEMPERATURE_LABEL, interfaces.COLD_TEMPERATURE_LABEL, interfaces.FROZEN_TEMPERATURE_LABEL} {
+		for i := 0; i < 15; i++ {
+			ck.WG.Add(1)
+			go func(idx int, tempLabel string) {
+				defer ck.WG.Done()
+				newOrder := interfaces.CreateFoodOrder("order-name", 0.1, 100, tempLabel, ck)
+				err := ck.ReceiveOrder(&newOrder)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				orders <- &newOrder
+			}(i, label)
+		}
+	}
+
+	// ReceiveOrder returns once the order is on the shelves,
+	// so wait for the drivers before checking on the orders
+	ck.WG.Wait()
+	close(orders)
+
+	// check if every order has been picked up
+	// and confirm that none of them died
+	for newOrder := range orders {
+		if !newOrder.GetPickedUp() {
+			t.Errorf("Order was %s instead of being picked up", newOrder.GetState())
+		}
+	}
+}
+
+func TestReceiveOrder_Success_WastedOrder(t *testing.T) {
+	simulationConfig := interfaces.CreateSimulationConfig(100, 100, 10)
+	fakeClock := interfaces.CreateFakeClock(time.Time{})
+	simulationConfig.Clock = fakeClock
+	ck := interfaces.CreateDarkKitchen(simulationConfig)
+
+	newOrder := interfaces.CreateFoodOrder("order-name", 10, 1, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	receiveErr := make(chan error, 1)
+	go func() {
+		receiveErr <- ck.ReceiveOrder(&newOrder)
+	}()
+	fakeClock.BlockUntil(2)
+
+	if newOrder.GetName() != "order-name" {
+		t.Error("Name does not match")
+	}
+
+	// the order dies on its first tick, long before the driver arrives
+	ck.Step(1)
+	if newOrder.GetHealth() > 0 {
+		t.Error("Order did not die")
+	}
+
+	ck.Step(200)
+	<-receiveErr
+	ck.WG.Wait()
+
+	if newOrder.GetPickedUp() {
+		t.Error("Order was picked up")
+	}
+}
+
+func TestCreateOrder_Failure_InvalidTemperature(t *testing.T) {
+	simulationConfig := interfaces.CreateSimulationConfig(20, 20, 10*time.Millisecond)
+	ck := interfaces.CreateDarkKitchen(simulationConfig)
+
+	newOrder := interfaces.CreateFoodOrder("order-name", 0.1, 10, "INVALID-TEMP", ck)
+	err := ck.ReceiveOrder(&newOrder)
+	if err == nil {
+		t.Error("Order was accepted")
+	}
+
+	ck.WG.Wait()
+}
+
+// Run with -race. The order is decayed while the shelves
+// move it around and the UI reads it
+func TestFoodOrderSnapshot_Success_ConsistentWhileDecaying(t *testing.T) {
+	simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+	ck := interfaces.CreateDarkKitchen(simulationConfig)
+	newOrder := interfaces.CreateFoodOrder("order-name", 0.5, 10000, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	newOrder.SetCurrentDecayRate(0.5)
+	decayValue := func(shelfLife float32, orderAge float32, decayRate float32) float32 {
+		return (shelfLife - orderAge) - (decayRate * orderAge)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			newOrder.AgeBy(1, decayValue)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			newOrder.SetCurrentDecayRate(0.5)
+			newOrder.SetExpectedPickupTime(time.Unix(int64(i), 0))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			snapshot := newOrder.Snapshot()
+			expectedHealth := decayValue(snapshot.ShelfLife, snapshot.OrderAge, snapshot.CurrentDecayRate)
+			if diff := snapshot.Health - expectedHealth; diff > 0.01 || diff < -0.01 {
+				t.Errorf("health %v does not match age %v", snapshot.Health, snapshot.OrderAge)
 				return
 			}
+		}
+	}()
+	wg.Wait()
+
+	snapshot := newOrder.Snapshot()
+	if snapshot.OrderAge != 1000 || snapshot.Health != newOrder.GetHealth() {
+		t.Errorf("unexpected snapshot after decaying: %+v", snapshot)
+	}
+}
+
+// Test Order lifecycle related functionality
+func TestFoodOrderTransitionTo_Failure_InvalidTransition(t *testing.T) {
+	ck, _ := createEventDarkKitchen(2, 8, 1)
+	newOrder := interfaces.CreateFoodOrder("order-name", 0.1, 100, interfaces.HOT_TEMPERATURE_LABEL, ck)
+
+	if err := newOrder.TransitionTo(interfaces.PICKED_UP_ORDER_STATE); err == nil {
+		t.Error("Order was picked up before it was cooked")
+	}
+
+	if err := newOrder.TransitionTo(interfaces.COOKING_ORDER_STATE); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := newOrder.TransitionTo(interfaces.ON_SHELF_ORDER_STATE); err == nil {
+		t.Error("Order went on the shelf before the Dispatcher took it on")
+	}
+
+	for _, state := range []interfaces.OrderState{interfaces.DISPATCHING_ORDER_STATE, interfaces.ON_SHELF_ORDER_STATE, interfaces.PICKED_UP_ORDER_STATE, interfaces.DELIVERED_ORDER_STATE} {
+		if err := newOrder.TransitionTo(state); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// delivered orders stay delivered
+	if err := newOrder.TransitionTo(interfaces.ON_SHELF_ORDER_STATE); err == nil {
+		t.Error("Order went back on the shelf after it was delivered")
+	}
+
+	if newOrder.GetState() != interfaces.DELIVERED_ORDER_STATE || len(newOrder.GetTransitions()) != 6 {
+		t.Errorf("Order ended up %s after %d transitions", newOrder.GetState(), len(newOrder.GetTransitions()))
+	}
+}
+
+func TestShelfSetHandleOrder_Failure_NotDispatched(t *testing.T) {
+	ck, _ := createEventDarkKitchen(2, 8, 1)
+	newOrder := interfaces.CreateFoodOrder("order-name", 0.1, 100, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	newOrder.TransitionTo(interfaces.COOKING_ORDER_STATE)
+
+	// the order skipped the Dispatcher, so it's turned away without being counted as wasted
+	if err := ck.CarrierFacility.HandleOrder(&newOrder); err == nil {
+		t.Error("Order was put on the shelves before the Dispatcher took it on")
+	}
+
+	state := ck.CarrierFacility.GetState().(map[string]interface{})
+	if newOrder.GetState() != interfaces.COOKING_ORDER_STATE || len(ck.CarrierFacility.GetOrders()) != 0 || state[interfaces.SHELFSET_WASTED_ORDERS_NOSPACE_LABEL] != 0 {
+		t.Errorf("Order ended up %s with %d orders on the shelves and state %v", newOrder.GetState(), len(ck.CarrierFacility.GetOrders()), state)
+	}
+}
+
+func TestEventEngine_Success_RecordsOrderLifecycle(t *testing.T) {
+	ck, engine := createEventDarkKitchen(2, 8, 1)
+
+	pickedUpOrder := interfaces.CreateFoodOrder("picked-up", 0.1, 100, interfaces.FROZEN_TEMPERATURE_LABEL, ck)
+	decayedOrder := interfaces.CreateFoodOrder("decayed", 1, 1, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	rejectedOrder := interfaces.CreateFoodOrder("rejected", 0.1, 100, "INVALID-TEMP", ck)
+	engine.ScheduleOrder(&pickedUpOrder, 5)
+	engine.ScheduleOrder(&decayedOrder, 5)
+	engine.ScheduleOrder(&rejectedOrder, 5)
+	engine.Run()
+
+	// the picked up order is delivered as soon as its driver arrives
+	pickupTick := int(pickedUpOrder.GetExpectedPickupTime().Sub(pickedUpOrder.GetTransitions()[0].At) / interfaces.DEFAULT_SLEEP_TIME)
+
+	tests := []struct {
+		order          *interfaces.FoodOrder
+		expectedStates []interfaces.OrderState
+		// ticks after the order was created that the last transition happened
+		expectedLastTick int
+	}{
+		{
+			order:            &pickedUpOrder,
+			expectedStates:   []interfaces.OrderState{interfaces.QUEUED_ORDER_STATE, interfaces.COOKING_ORDER_STATE, interfaces.DISPATCHING_ORDER_STATE, interfaces.ON_SHELF_ORDER_STATE, interfaces.PICKED_UP_ORDER_STATE, interfaces.DELIVERED_ORDER_STATE},
+			expectedLastTick: pickupTick,
+		},
+		{
+			order:            &decayedOrder,
+			expectedStates:   []interfaces.OrderState{interfaces.QUEUED_ORDER_STATE, interfaces.COOKING_ORDER_STATE, interfaces.DISPATCHING_ORDER_STATE, interfaces.ON_SHELF_ORDER_STATE, interfaces.WASTED_DECAY_ORDER_STATE},
+			expectedLastTick: 6,
+		},
+		{
+			order:            &rejectedOrder,
+			expectedStates:   []interfaces.OrderState{interfaces.QUEUED_ORDER_STATE, interfaces.COOKING_ORDER_STATE, interfaces.DISPATCHING_ORDER_STATE, interfaces.REJECTED_NO_SPACE_ORDER_STATE},
+			expectedLastTick: 5,
+		},
+	}
+
+	for _, test := range tests {
+		transitions := test.order.GetTransitions()
+		states := []interfaces.OrderState{}
+		for _, transition := range transitions {
+			states = append(states, transition.State)
+		}
+
+		if !reflect.DeepEqual(states, test.expectedStates) {
+			t.Errorf("%s: expected states %v, got %v", test.order.GetName(), test.expectedStates, states)
+			continue
+		}
+
+		// every order arrives at tick 5
+		if arrival := transitions[1].At.Sub(transitions[0].At); arrival != 5*interfaces.DEFAULT_SLEEP_TIME {
+			t.Errorf("%s: started cooking %v after it was created", test.order.GetName(), arrival)
+		}
+
+		if last := transitions[len(transitions)-1].At.Sub(transitions[0].At); last != time.Duration(test.expectedLastTick)*interfaces.DEFAULT_SLEEP_TIME {
+			t.Errorf("%s: ended up %s %v after it was created", test.order.GetName(), test.order.GetState(), last)
+		}
+	}
+}
+
+// Test order status related functionality
+func TestDarkKitchenListOrderStatuses_Success_Filters(t *testing.T) {
+	ck, engine := createEventDarkKitchen(100, 100, 1)
+
+	hotOrder := interfaces.CreateFoodOrder("hot-order", 0.1, 1000, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	coldOrder := interfaces.CreateFoodOrder("cold-order", 0.1, 1000, interfaces.COLD_TEMPERATURE_LABEL, ck)
+	rejectedOrder := interfaces.CreateFoodOrder("rejected-order", 0.1, 1000, "INVALID-TEMP", ck)
+	for _, order := range []*interfaces.FoodOrder{&hotOrder, &coldOrder, &rejectedOrder} {
+		engine.ScheduleOrder(order, 1)
+	}
+	engine.RunUntil(10)
+
+	status, err := ck.GetOrderStatus(hotOrder.GetID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.Shelf != interfaces.HOT_TEMPERATURE_LABEL || status.State != interfaces.ON_SHELF_ORDER_STATE || status.OrderAge != 9 || len(status.Transitions) != 4 {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	if _, err := ck.GetOrderStatus("missing-order"); err == nil {
+		t.Error("found status for an order that was never received")
+	}
+
+	tests := []struct {
+		filter        interfaces.OrderFilter
+		expectedNames []string
+	}{
+		{interfaces.OrderFilter{}, []string{"hot-order", "cold-order", "rejected-order"}},
+		{interfaces.OrderFilter{State: interfaces.ON_SHELF_ORDER_STATE}, []string{"hot-order", "cold-order"}},
+		{interfaces.OrderFilter{State: interfaces.REJECTED_NO_SPACE_ORDER_STATE}, []string{"rejected-order"}},
+		{interfaces.OrderFilter{Temperature: interfaces.COLD_TEMPERATURE_LABEL}, []string{"cold-order"}},
+		{interfaces.OrderFilter{Shelf: interfaces.HOT_TEMPERATURE_LABEL, State: interfaces.ON_SHELF_ORDER_STATE}, []string{"hot-order"}},
+		{interfaces.OrderFilter{Shelf: interfaces.OVERFLOW_LABEL}, []string{}},
+	}
+
+	for _, test := range tests {
+		names := []string{}
+		for _, status := range ck.ListOrderStatuses(test.filter) {
+			names = append(names, status.Name)
+		}
+
+		if !reflect.DeepEqual(names, test.expectedNames) {
+			t.Errorf("%+v: expected %v, got %v", test.filter, test.expectedNames, names)
+		}
+	}
+
+	// orders can still be looked up once they have left the shelves
+	engine.Run()
+	if status, err := ck.GetOrderStatus(hotOrder.GetID()); err != nil || status.State != interfaces.DELIVERED_ORDER_STATE || status.Shelf != "" {
+		t.Errorf("unexpected status %+v after the order was delivered, %v", status, err)
+	}
+}
+
+// Test order cancellation related functionality
+func TestDarkKitchenCancelOrder_Success_RefillsFromOverflowAndRecallsDriver(t *testing.T) {
+	ck, _ := createPolicyShelfSet(t, interfaces.HIGHEST_HEALTH_TO_OVERFLOW_POLICY_LABEL)
+	engine := ck.Engine.(*interfaces.EventEngine)
+
+	cancelledOrder := interfaces.CreateFoodOrder("cancelled", 0.1, 100, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	overflowOrder := interfaces.CreateFoodOrder("overflow", 0.1, 100, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	engine.ScheduleOrder(&cancelledOrder, 1)
+	engine.ScheduleOrder(&overflowOrder, 1)
+	engine.RunUntil(1)
+
+	if err := ck.CancelOrder(cancelledOrder.GetID()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the overflow order takes the cancelled order's space
+	if status, _ := ck.GetOrderStatus(overflowOrder.GetID()); status.Shelf != interfaces.HOT_TEMPERATURE_LABEL {
+		t.Errorf("overflow order is on the %q shelf after the cancel", status.Shelf)
+	}
+
+	if status, _ := ck.GetOrderStatus(cancelledOrder.GetID()); status.State != interfaces.CANCELLED_ORDER_STATE || status.Shelf != "" {
+		t.Errorf("unexpected status %+v after the cancel", status)
+	}
+
+	engine.Run()
+
+	// the cancelled order's driver never arrives, so the
+	// simulation ends as soon as the other order is picked up
+	pickupTick := int(overflowOrder.GetExpectedPickupTime().Sub(overflowOrder.GetTransitions()[0].At) / interfaces.DEFAULT_SLEEP_TIME)
+	if overflowOrder.GetState() != interfaces.DELIVERED_ORDER_STATE || engine.Now() != pickupTick {
+		t.Errorf("overflow order was %s and the simulation ended at tick %d", overflowOrder.GetState(), engine.Now())
+	}
+
+	if err := ck.CancelOrder(overflowOrder.GetID()); err == nil {
+		t.Error("cancelled an order that was already delivered")
+	}
+
+	if err := ck.CancelOrder("missing-order"); err == nil {
+		t.Error("cancelled an order that was never received")
+	}
+
+	// cancelled orders aren't counted as waste
+	state := ck.CarrierFacility.GetState().(map[string]interface{})
+	if state[interfaces.SHELFSET_CANCELLED_ORDERS_LABEL] != 1 || state[interfaces.SHELFSET_WASTED_ORDERS_DECAY_LABEL] != 0 || state[interfaces.SHELFSET_WASTED_ORDERS_NOSPACE_LABEL] != 0 {
+		t.Errorf("unexpected counts %v", state)
+	}
+}
+
+func TestDarkKitchenCancelOrder_Success_StopsDecayAndDriverGoroutines(t *testing.T) {
+	simulationConfig := interfaces.CreateSimulationConfig(50, 50, 10*time.Millisecond)
+	fakeClock := interfaces.CreateFakeClock(time.Time{})
+	simulationConfig.Clock = fakeClock
+	ck := interfaces.CreateDarkKitchen(simulationConfig)
+
+	newOrder := interfaces.CreateFoodOrder("order-name", 0.1, 1000, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	if err := ck.ReceiveOrder(&newOrder); err != nil {
+		t.Fatal(err)
+	}
+	fakeClock.BlockUntil(2)
+
+	if err := ck.CancelOrder(newOrder.GetID()); err != nil {
+		t.Fatal(err)
+	}
+
+	// both goroutines stop the next time they wake up instead of
+	// running until the driver arrives or the order decays
+	ck.Step(1)
+	stopped := make(chan bool)
+	go func() {
+		ck.WG.Wait()
+		stopped <- true
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("decay and driver goroutines are still running")
+	}
+
+	if newOrder.GetState() != interfaces.CANCELLED_ORDER_STATE {
+		t.Errorf("Order was %s after it was cancelled", newOrder.GetState())
+	}
+}
+
+// Test FakeClock related functionality
+func TestDarkKitchenStop_Success_StepAfterShelvesShutDown(t *testing.T) {
+	simulationConfig := interfaces.CreateSimulationConfig(2, 2, interfaces.DEFAULT_SLEEP_TIME)
+	simulationConfig.Clock = interfaces.CreateFakeClock(time.Time{})
+
+	// the stopped kitchen's shelves shut down straight away since it has no
+	// orders, but it still hears about every goroutine woken on the clock
+	stopped := interfaces.CreateDarkKitchen(simulationConfig)
+	stopped.Stop()
+	time.Sleep(10 * time.Millisecond)
+
+	ck := interfaces.CreateDarkKitchen(simulationConfig)
+	newOrder := interfaces.CreateFoodOrder("order-name", 0.1, 1000, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	ck.ReceiveOrder(&newOrder)
+
+	stepped := make(chan bool)
+	go func() {
+		ck.Step(3)
+		stepped <- true
+	}()
+
+	select {
+	case <-stepped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stepping blocked on the stopped kitchen's shelves")
+	}
+
+	if newOrder.GetState() != interfaces.DELIVERED_ORDER_STATE {
+		t.Errorf("Order was %s after its driver arrived", newOrder.GetState())
+	}
+}
+
+func TestDarkKitchenStep_Success_Deterministic(t *testing.T) {
+	runSimulation := func() []byte {
+		simulationConfig := interfaces.CreateSimulationConfig(1000, 1000, interfaces.DEFAULT_SLEEP_TIME)
+		fakeClock := interfaces.CreateFakeClock(time.Time{})
+		simulationConfig.Clock = fakeClock
+		ck := interfaces.CreateDarkKitchen(simulationConfig)
+
+		// fill up the hot shelf and spill over into the overflow
+		// shelf with orders that have different lifetimes
+		for i := 0; i < 25; i++ {
+			newOrder := interfaces.CreateFoodOrder(fmt.Sprintf("order-%d", i), 0.5, float32(10+i*7%40), interfaces.HOT_TEMPERATURE_LABEL, ck)
+			go ck.ReceiveOrder(&newOrder)
+			fakeClock.BlockUntil(2 * (i + 1))
+		}
+
+		if err := ck.Step(20); err != nil {
+			t.Fatal(err)
+		}
+
+		return stateWithoutIDs(t, ck.CarrierFacility.GetState())
+	}
+
+	first := runSimulation()
+	for i := 0; i < 5; i++ {
+		if next := runSimulation(); string(next) != string(first) {
+			t.Fatalf("state differs between runs:\n%s\n%s", first, next)
+		}
+	}
+}
+
+// Test seeded randomness related functionality
+func TestDriverArrival_Success_SameSeedSameSchedule(t *testing.T) {
+	pickupSchedule := func(seed int64) []int {
+		simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+		simulationConfig.DriverMinDelay = 1
+		simulationConfig.DriverMaxDelay = 20
+		simulationConfig.Seed = seed
+		fakeClock := interfaces.CreateFakeClock(time.Time{})
+		simulationConfig.Clock = fakeClock
+		ck := interfaces.CreateDarkKitchen(simulationConfig)
+
+		orders := []*interfaces.FoodOrder{}
+		for i := 0; i < 10; i++ {
+			newOrder := interfaces.CreateFoodOrder(fmt.Sprintf("order-%d", i), 0.1, 300, interfaces.COLD_TEMPERATURE_LABEL, ck)
+			orders = append(orders, &newOrder)
+			go ck.ReceiveOrder(&newOrder)
+			fakeClock.BlockUntil(2 * (i + 1))
+		}
+
+		// record the tick each order was picked up at
+		schedule := make([]int, len(orders))
+		for tick := 1; tick <= 21; tick++ {
+			ck.Step(1)
+			for idx, order := range orders {
+				if schedule[idx] == 0 && order.GetPickedUp() {
+					schedule[idx] = tick
+				}
+			}
+		}
+
+		ck.WG.Wait()
+		return schedule
+	}
+
+	first := pickupSchedule(42)
+	if second := pickupSchedule(42); !reflect.DeepEqual(first, second) {
+		t.Errorf("same seed gave different pickup schedules %v and %v", first, second)
+	}
+
+	if other := pickupSchedule(7); reflect.DeepEqual(first, other) {
+		t.Errorf("different seeds gave the same pickup schedule %v", first)
+	}
+}
+
+func TestReplayOrders_Success_SameGapsSameOutcome(t *testing.T) {
+	dir, err := ioutil.TempDir("", "traffic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "orders.jsonl")
+	recorder, err := interfaces.CreateTrafficRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordedAt := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i, gap := range []time.Duration{0, time.Second, 500 * time.Millisecond, 2500 * time.Millisecond} {
+		recordedAt = recordedAt.Add(gap)
+		input := interfaces.FoodOrderInput{Name: fmt.Sprintf("order-%d", i), DecayRate: 0.5, ShelfLife: float32(3 + i*100), Temperature: interfaces.HOT_TEMPERATURE_LABEL}
+		if err := recorder.Record(recordedAt, "recorded", input); err != nil {
+			t.Fatal(err)
+		}
+		// another session's orders are recorded in between
+		if err := recorder.Record(recordedAt, "other", interfaces.FoodOrderInput{Name: "other", Temperature: interfaces.COLD_TEMPERATURE_LABEL}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recorder.Close()
+
+	all, err := interfaces.LoadRecordedOrders(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := interfaces.RecordedOrdersFor(all, "recorded")
+	if len(all) != 8 || len(recorded) != 4 {
+		t.Fatalf("expected 4 of the 8 recorded orders to be for the simulation, got %d of %d", len(recorded), len(all))
+	}
+
+	replay := func(seed int64, speed float64) []interfaces.OrderStatus {
+		simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+		simulationConfig.Seed = seed
+		simulationConfig.Clock = interfaces.CreateFakeClock(time.Time{})
+		ck := interfaces.CreateDarkKitchen(simulationConfig)
+
+		if err := ck.ReplayOrders(recorded, speed); err != nil {
+			t.Fatal(err)
+		}
+		ck.Step(20)
+		ck.WG.Wait()
+
+		statuses := ck.ListOrderStatuses(interfaces.OrderFilter{})
+		for idx := range statuses {
+			// IDs are new every run
+			statuses[idx].ID = ""
+		}
+		return statuses
+	}
+
+	statuses := replay(42, 2)
+	if len(statuses) != len(recorded) {
+		t.Fatalf("expected %d orders to be replayed, got %d", len(recorded), len(statuses))
+	}
+	for idx, offset := range []time.Duration{0, 500 * time.Millisecond, 750 * time.Millisecond, 2 * time.Second} {
+		if receivedAt := statuses[idx].Transitions[0].At; !receivedAt.Equal(time.Time{}.Add(offset)) {
+			t.Errorf("expected %s to be received %v into the replay, got %v", statuses[idx].Name, offset, receivedAt.Sub(time.Time{}))
+		}
+	}
+
+	if again := replay(42, 2); !reflect.DeepEqual(statuses, again) {
+		t.Errorf("replaying with the same seed gave different outcomes %+v and %+v", statuses, again)
+	}
+
+	simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+	if err := interfaces.CreateDarkKitchen(simulationConfig).ReplayOrders(recorded, 0); err == nil {
+		t.Error("expected an error for a replay speed of 0")
+	}
+}
+
+func TestFleet_Success_OrdersQueueForFreeDrivers(t *testing.T) {
+	createConfig := func() *interfaces.SimulationConfig {
+		simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+		// every driver takes 2 ticks to get to the kitchen, and 2 to get back
+		simulationConfig.DriverMinDelay = 2
+		simulationConfig.DriverMaxDelay = 2
+		simulationConfig.FleetSize = 2
+		simulationConfig.Clock = interfaces.CreateFakeClock(time.Time{})
+		return simulationConfig
+	}
+	pickedUpAt := func(order interfaces.Order) int {
+		for _, transition := range order.GetTransitions() {
+			if transition.State == interfaces.PICKED_UP_ORDER_STATE {
+				return int(transition.At.Sub(time.Time{}) / interfaces.DEFAULT_SLEEP_TIME)
+			}
+		}
+		return -1
+	}
+
+	ck := interfaces.CreateDarkKitchen(createConfig())
+	orders := []*interfaces.FoodOrder{}
+	for i := 0; i < 5; i++ {
+		order := interfaces.CreateFoodOrder(fmt.Sprintf("order-%d", i), 0.1, 300, interfaces.HOT_TEMPERATURE_LABEL, ck)
+		orders = append(orders, &order)
+		ck.ReceiveOrder(&order)
+	}
+	// a cancelled order gives up its place in the queue
+	ck.CancelOrder(orders[4].GetID())
+
+	expectedStates := []interfaces.FleetState{
+		{Size: 2, EnRoute: 2, Queued: 2, Utilization: 1},
+		{Size: 2, Returning: 2, Queued: 2, Utilization: 1},
+		{Size: 2, EnRoute: 2, Utilization: 1},
+		{Size: 2, Returning: 2, Utilization: 1},
+		{Size: 2, Available: 2},
+	}
+	for idx, expected := range expectedStates {
+		if idx > 0 {
+			ck.Step(2)
+		}
+
+		state := ck.CarrierFacility.GetState().(map[string]interface{})
+		if fleetState := state[interfaces.SHELFSET_FLEET_LABEL]; fleetState != expected {
+			t.Errorf("after %d ticks expected the fleet to be %+v, got %+v", idx*2, expected, fleetState)
+		}
+	}
+
+	// the queued orders are picked up once the first two drivers are back
+	for idx, expected := range []int{2, 2, 6, 6, -1} {
+		if tick := pickedUpAt(orders[idx]); tick != expected {
+			t.Errorf("expected %s to be picked up at tick %d, got %d", orders[idx].GetName(), expected, tick)
+		}
+	}
+
+	// the EventEngine sends drivers from the fleet the same way
+	simulationConfig := createConfig()
+	simulationConfig.Engine = interfaces.EVENT_ENGINE_LABEL
+	ck = interfaces.CreateDarkKitchen(simulationConfig)
+	engine := ck.Engine.(*interfaces.EventEngine)
+	orders = orders[:0]
+	for i := 0; i < 4; i++ {
+		order := interfaces.CreateFoodOrder(fmt.Sprintf("order-%d", i), 0.1, 300, interfaces.HOT_TEMPERATURE_LABEL, ck)
+		orders = append(orders, &order)
+		engine.ScheduleOrder(&order, 0)
+	}
+	engine.Run()
+
+	for idx, expected := range []int{2, 2, 6, 6} {
+		if tick := pickedUpAt(orders[idx]); tick != expected {
+			t.Errorf("with the EventEngine expected %s to be picked up at tick %d, got %d", orders[idx].GetName(), expected, tick)
+		}
+	}
+	if fleetState := ck.Dispatcher.Fleet.GetState(); fleetState.Available != 2 {
+		t.Errorf("expected every driver to be back once the simulation was done, got %+v", fleetState)
+	}
+}
+
+func TestBatching_Success_DriversPickUpCloseOrdersTogether(t *testing.T) {
+	simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+	// every driver takes 2 ticks to get to the kitchen
+	simulationConfig.DriverMinDelay = 2
+	simulationConfig.DriverMaxDelay = 2
+	simulationConfig.BatchSize = 2
+	simulationConfig.BatchWindow = 2
+	simulationConfig.Clock = interfaces.CreateFakeClock(time.Time{})
+	pickedUpAt := func(order interfaces.Order) int {
+		for _, transition := range order.GetTransitions() {
+			if transition.State == interfaces.PICKED_UP_ORDER_STATE {
+				return int(transition.At.Sub(time.Time{}) / interfaces.DEFAULT_SLEEP_TIME)
+			}
+		}
+		return -1
+	}
+
+	ck := interfaces.CreateDarkKitchen(simulationConfig)
+	orders := []*interfaces.FoodOrder{}
+	receive := func() {
+		order := interfaces.CreateFoodOrder(fmt.Sprintf("order-%d", len(orders)), 0.1, 300, interfaces.HOT_TEMPERATURE_LABEL, ck)
+		orders = append(orders, &order)
+		ck.ReceiveOrder(&order)
+	}
+
+	receive()
+	ck.Step(1)
+	// order-1 joins the driver due next tick, who is then full, so order-2 gets
+	// a driver of its own that order-3 joins. order-5 joins order-4's driver,
+	// who keeps going for order-5 once order-4 is cancelled
+	for i := 1; i < 6; i++ {
+		receive()
+	}
+	subscription, _ := ck.Events.Subscribe(100, interfaces.DROP_SUBSCRIPTION_POLICY)
+	ck.CancelOrder(orders[4].GetID())
+	for _, message := range subscription.Drain() {
+		if event := message.(interfaces.Event); event.Type == interfaces.DRIVER_RECALLED_EVENT_TYPE {
+			t.Errorf("order-4's driver was reported recalled while they carry on for order-5")
+		}
+	}
+
+	if fleetState := ck.Dispatcher.Fleet.GetState(); fleetState.EnRoute != 3 {
+		t.Errorf("expected 3 drivers on their way for 5 orders, got %+v", fleetState)
+	}
+	if pickupAt := orders[1].GetExpectedPickupTime(); pickupAt != orders[0].GetExpectedPickupTime() {
+		t.Errorf("expected order-1 to be picked up with order-0, got %v", pickupAt)
+	}
+	ck.Step(2)
+
+	for idx, expected := range []int{2, 2, 3, 3, -1, 3} {
+		if tick := pickedUpAt(orders[idx]); tick != expected {
+			t.Errorf("expected %s to be picked up at tick %d, got %d", orders[idx].GetName(), expected, tick)
+		}
+	}
+	if orders[5].GetState() != interfaces.DELIVERED_ORDER_STATE {
+		t.Errorf("expected order-5 to be delivered, got %s", orders[5].GetState())
+	}
+}
+
+func TestShelfSetGiveOrders_Failure_MissingOrderKeepsBatch(t *testing.T) {
+	simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+	simulationConfig.Clock = interfaces.CreateFakeClock(time.Time{})
+	ck := interfaces.CreateDarkKitchen(simulationConfig)
+
+	order := interfaces.CreateFoodOrder("order-name", 0.1, 300, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	ck.ReceiveOrder(&order)
+
+	orders, missing, err := ck.CarrierFacility.GiveOrders([]string{order.GetID(), "missing-id"})
+	if err == nil || len(orders) != 0 {
+		t.Errorf("expected no orders to be given when one is missing, got %v", orders)
+	}
+	if len(missing) != 1 || missing[0] != "missing-id" {
+		t.Errorf("expected to be told missing-id is missing, got %v", missing)
+	}
+	if ck.CarrierFacility.GetOrderShelf(order.GetID()) == "" {
+		t.Error("the order in the batch that was there should still be on the shelves")
+	}
+
+	// an order asked for twice isn't handed over twice
+	orders, _, err = ck.CarrierFacility.GiveOrders([]string{order.GetID(), order.GetID()})
+	if err == nil || len(orders) != 0 || order.GetState() == interfaces.PICKED_UP_ORDER_STATE {
+		t.Errorf("expected no orders to be given when one is asked for twice, got %v", orders)
+	}
+
+	orders, _, err = ck.CarrierFacility.GiveOrders([]string{order.GetID()})
+	if err != nil || len(orders) != 1 || order.GetState() != interfaces.PICKED_UP_ORDER_STATE {
+		t.Errorf("expected the order to be picked up once the batch was complete, got %v", err)
+	}
+}
+
+func TestDispatchStrategy_Success_DriversPickUpByStrategy(t *testing.T) {
+	pickedUpAt := func(order interfaces.Order) int {
+		for _, transition := range order.GetTransitions() {
+			if transition.State == interfaces.PICKED_UP_ORDER_STATE {
+				return int(transition.At.Sub(time.Time{}) / interfaces.DEFAULT_SLEEP_TIME)
+			}
+		}
+		return -1
+	}
+	run := func(strategy string) (*interfaces.DarkKitchen, []interfaces.Order) {
+		simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+		simulationConfig.Clock = interfaces.CreateFakeClock(time.Time{})
+		simulationConfig.DispatchStrategy, _ = interfaces.CreateDispatchStrategy(strategy)
+		ck := interfaces.CreateDarkKitchen(simulationConfig)
+
+		// each order's driver arrives at the tick it is expected to be picked up
+		orders := []interfaces.Order{}
+		receive := func(shelfLife float32, pickupTick int) {
+			order := interfaces.CreateFoodOrder(fmt.Sprintf("order-%d", len(orders)), 0.1, shelfLife, interfaces.HOT_TEMPERATURE_LABEL, ck)
+			order.SetExpectedPickupTime(time.Time{}.Add(time.Duration(pickupTick) * interfaces.DEFAULT_SLEEP_TIME))
+			orders = append(orders, &order)
+			ck.ReceiveOrder(&order)
+		}
+
+		receive(300, 4)
+		ck.Step(1)
+		receive(300, 2)
+		ck.Step(1)
+		receive(20, 3)
+		ck.Step(2)
+		return ck, orders
+	}
+
+	expectedTicks := map[string][]int{
+		interfaces.MATCHED_DISPATCH_STRATEGY_LABEL: {4, 2, 3},
+		// the first driver takes the order that has been ready the longest
+		interfaces.FIFO_DISPATCH_STRATEGY_LABEL: {2, 3, 4},
+		// the second driver takes the order that was ready last, since it has the least life left
+		interfaces.HEALTH_FIRST_DISPATCH_STRATEGY_LABEL: {2, 4, 3},
+	}
+	for strategy, expected := range expectedTicks {
+		ck, orders := run(strategy)
+		for idx, tick := range expected {
+			if pickedUpAt(orders[idx]) != tick {
+				t.Errorf("with %s expected %s to be picked up at tick %d, got %d", strategy, orders[idx].GetName(), tick, pickedUpAt(orders[idx]))
+			}
+		}
+
+		// every order waits 2 ticks whichever driver takes it
+		stats := ck.Dispatcher.GetWaitStats()
+		if stats.Strategy != strategy || stats.OrdersPickedUp != 3 || stats.AverageFoodWait != 2 || stats.AverageDriverWait != 0 {
+			t.Errorf("with %s expected 3 orders to wait 2 ticks for drivers who didn't wait, got %+v", strategy, stats)
+		}
+	}
+
+	// a driver whose order decayed waits for the next one, which doesn't get a driver of its own
+	ck, orders := run(interfaces.FIFO_DISPATCH_STRATEGY_LABEL)
+	wasted := interfaces.CreateFoodOrder("wasted", 0.1, 1, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	wasted.SetExpectedPickupTime(time.Time{}.Add(8 * interfaces.DEFAULT_SLEEP_TIME))
+	ck.ReceiveOrder(&wasted)
+	ck.Step(6)
+	if stats := ck.Dispatcher.GetWaitStats(); stats.DriversWaiting != 1 {
+		t.Errorf("expected the wasted order's driver to wait for an order, got %+v", stats)
+	}
+
+	next := interfaces.CreateFoodOrder("next", 0.1, 300, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	ck.ReceiveOrder(&next)
+	if tick := pickedUpAt(&next); tick != 10 || next.GetState() != interfaces.DELIVERED_ORDER_STATE {
+		t.Errorf("expected the waiting driver to deliver the next order at tick 10, got %d", tick)
+	}
+	if fleetState := ck.Dispatcher.Fleet.GetState(); fleetState.EnRoute != 0 {
+		t.Errorf("expected no driver to be sent for the next order, got %+v", fleetState)
+	}
+	stats := ck.Dispatcher.GetWaitStats()
+	if stats.OrdersPickedUp != len(orders)+1 || stats.AverageFoodWait != 1.5 || stats.LongestFoodWait != 2 || stats.AverageDriverWait != 0.5 || stats.DriversWaiting != 0 {
+		t.Errorf("expected the waiting driver's 2 ticks to count towards the driver wait, got %+v", stats)
+	}
+
+	if _, err := interfaces.CreateDispatchStrategy("closest-first"); err == nil {
+		t.Error("expected an error for a dispatch strategy that doesn't exist")
+	}
+}
+
+func TestHTTPCourierProvider_Success_StubCourierPicksUpOrder(t *testing.T) {
+	stub := interfaces.CreateStubCourierService(10*time.Millisecond, 0, 0, "secret")
+	partner := httptest.NewServer(stub)
+	defer partner.Close()
+
+	var ck *interfaces.DarkKitchen
+	webhookErrs := make(chan error, 10)
+	kitchen := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if !interfaces.VerifyCourierWebhook("secret", body, r.Header.Get(interfaces.COURIER_SIGNATURE_HEADER)) {
+			webhookErrs <- fmt.Errorf("unsigned webhook %s", body)
+			return
+		}
+
+		webhook := interfaces.CourierWebhook{}
+		json.Unmarshal(body, &webhook)
+		if err := ck.HandleCourierWebhook(webhook); err != nil {
+			webhookErrs <- err
+		}
+	}))
+	defer kitchen.Close()
+
+	simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+	simulationConfig.Clock = interfaces.CreateFakeClock(time.Time{})
+	simulationConfig.CourierProvider = interfaces.CreateHTTPCourierProvider(partner.URL, kitchen.URL)
+	ck = interfaces.CreateDarkKitchen(simulationConfig)
+
+	delivered := interfaces.CreateFoodOrder("delivered", 0.1, 300, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	cancelled := interfaces.CreateFoodOrder("cancelled", 0.1, 300, interfaces.COLD_TEMPERATURE_LABEL, ck)
+	ck.ReceiveOrder(&delivered)
+	ck.ReceiveOrder(&cancelled)
+	if err := ck.CancelOrder(cancelled.GetID()); err != nil {
+		t.Fatal(err)
+	}
+	stub.Wait()
+
+	// the partner's courier takes the order instead of a simulated driver
+	if fleetState := ck.Dispatcher.Fleet.GetState(); fleetState.EnRoute != 0 {
+		t.Errorf("expected no simulated drivers, got %+v", fleetState)
+	}
+	if delivered.GetState() != interfaces.DELIVERED_ORDER_STATE {
+		t.Errorf("expected the order to be delivered, got %s", delivered.GetState())
+	}
+	if status, _ := ck.GetOrderStatus(delivered.GetID()); status.Courier == nil || status.Courier.State != interfaces.COURIER_PICKED_UP_STATE || status.Courier.CourierID == "" {
+		t.Errorf("unexpected courier %+v", status.Courier)
+	}
+	if status, _ := ck.GetOrderStatus(cancelled.GetID()); status.Courier == nil || status.Courier.State != interfaces.COURIER_CANCELLED_STATE {
+		t.Errorf("expected the cancelled order's courier to be called off, got %+v", status.Courier)
+	}
+
+	select {
+	case err := <-webhookErrs:
+		t.Errorf("webhook was turned away: %v", err)
+	default:
+	}
+
+	if err := ck.HandleCourierWebhook(interfaces.CourierWebhook{OrderID: delivered.GetID(), Event: "teleported"}); err == nil {
+		t.Error("accepted an unknown courier event")
+	}
+	if err := ck.HandleCourierWebhook(interfaces.CourierWebhook{OrderID: cancelled.GetID(), Event: interfaces.COURIER_PICKED_UP_STATE}); err == nil {
+		t.Error("a cancelled courier picked up their order")
+	}
+
+	body := []byte(`{"orderId":"order","event":"pickedUp"}`)
+	for name, verified := range map[string]bool{
+		"unsigned":     interfaces.VerifyCourierWebhook("secret", body, ""),
+		"wrong secret": interfaces.VerifyCourierWebhook("secret", body, interfaces.SignCourierWebhook("guess", body)),
+		"no secret":    interfaces.VerifyCourierWebhook("", body, interfaces.SignCourierWebhook("", body)),
+		"tampered":     interfaces.VerifyCourierWebhook("secret", []byte(`{"orderId":"other","event":"pickedUp"}`), interfaces.SignCourierWebhook("secret", body)),
+	} {
+		if verified {
+			t.Errorf("%s webhook was verified", name)
+		}
+	}
+}
+
+func TestHTTPCourierProvider_Success_SlowPartnerDoesntHoldUpOrders(t *testing.T) {
+	release := make(chan struct{})
+	var releaseOnce sync.Once
+	releasePartner := func() {
+		releaseOnce.Do(func() { close(release) })
+	}
+	partner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer partner.Close()
+	defer releasePartner()
+
+	simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+	simulationConfig.CourierProvider = interfaces.CreateHTTPCourierProvider(partner.URL, "")
+	ck := interfaces.CreateDarkKitchen(simulationConfig)
+
+	order := interfaces.CreateFoodOrder("order", 0.1, 300, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	received := make(chan error, 1)
+	go func() {
+		received <- ck.ReceiveOrder(&order)
+	}()
+	select {
+	case err := <-received:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the order was held up waiting on the partner")
+	}
+	looked := make(chan interfaces.OrderStatus, 1)
+	go func() {
+		status, _ := ck.GetOrderStatus(order.GetID())
+		looked <- status
+	}()
+	select {
+	case status := <-looked:
+		if status.State != interfaces.ON_SHELF_ORDER_STATE || status.Courier == nil || status.Courier.State != interfaces.COURIER_REQUESTED_STATE {
+			t.Errorf("expected the order on its shelf with a courier requested, got %+v", status)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("looking up the order waited on the partner")
+	}
+
+	// the partner turns the request down, so a simulated driver goes instead
+	releasePartner()
+	deadline := time.After(5 * time.Second)
+	for ck.Dispatcher.Fleet.GetState().EnRoute != 1 {
+		select {
+		case <-deadline:
+			t.Fatal("no simulated driver was sent once the partner failed")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if status, _ := ck.GetOrderStatus(order.GetID()); status.Courier.State != interfaces.COURIER_FAILED_STATE {
+		t.Errorf("expected the courier to be marked failed, got %+v", status.Courier)
+	}
+}
+
+func TestHTTPCourierProvider_Success_CatchesUpOnMissedWebhooks(t *testing.T) {
+	partner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the partner's webhooks never make it, but it knows the order was picked up
+		state := interfaces.COURIER_REQUESTED_STATE
+		if r.Method == http.MethodGet {
+			state = interfaces.COURIER_PICKED_UP_STATE
+		}
+		json.NewEncoder(w).Encode(interfaces.CourierStatus{CourierID: "courier", State: state})
+	}))
+	defer partner.Close()
+
+	simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+	simulationConfig.CourierProvider = interfaces.CreateHTTPCourierProvider(partner.URL, "")
+	ck := interfaces.CreateDarkKitchen(simulationConfig)
+	subscription, err := ck.Events.Subscribe(1000, interfaces.DROP_SUBSCRIPTION_POLICY)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := interfaces.CreateFoodOrder("order", 0.1, 300, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	if err := ck.ReceiveOrder(&order); err != nil {
+		t.Fatal(err)
+	}
+
+	// looking the order up checks on the courier in the
+	// background, once the partner has answered the request
+	deadline := time.After(5 * time.Second)
+	for {
+		status, _ := ck.GetOrderStatus(order.GetID())
+		if status.State == interfaces.DELIVERED_ORDER_STATE {
+			if status.Courier.State != interfaces.COURIER_PICKED_UP_STATE || status.Shelf != "" {
+				t.Errorf("expected the courier to have picked the order up off its shelf, got %+v", status)
+			}
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("the order was never caught up with its courier, got %+v", status)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	counts := map[interfaces.EventType]int{}
+	for _, message := range subscription.Drain() {
+		counts[message.(interfaces.Event).Type]++
+	}
+	for _, eventType := range []interfaces.EventType{interfaces.DRIVER_DISPATCHED_EVENT_TYPE, interfaces.DRIVER_ARRIVED_EVENT_TYPE, interfaces.ORDER_DELIVERED_EVENT_TYPE} {
+		if counts[eventType] != 1 {
+			t.Errorf("expected one %s event for the states caught up on, got %d", eventType, counts[eventType])
+		}
+	}
+}
+
+func TestCourierWebhook_Success_FollowsCourierStates(t *testing.T) {
+	simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+	simulationConfig.Clock = interfaces.CreateFakeClock(time.Time{})
+	simulationConfig.CourierProvider = TestCourierProvider{}
+	ck := interfaces.CreateDarkKitchen(simulationConfig)
+	courierState := func(order interfaces.Order) string {
+		status, _ := ck.GetOrderStatus(order.GetID())
+		return status.Courier.State
+	}
+	update := func(order interfaces.Order, event string) error {
+		return ck.HandleCourierWebhook(interfaces.CourierWebhook{OrderID: order.GetID(), Event: event})
+	}
+
+	order := interfaces.CreateFoodOrder("order", 0.1, 300, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	ck.ReceiveOrder(&order)
+	if err := update(&order, interfaces.COURIER_PICKED_UP_STATE); err == nil {
+		t.Error("a courier who was never assigned picked up their order")
+	}
+	if order.GetState() != interfaces.ON_SHELF_ORDER_STATE || courierState(&order) != interfaces.COURIER_REQUESTED_STATE {
+		t.Errorf("a skipped step shouldn't move the order or courier along, got %s and %s", order.GetState(), courierState(&order))
+	}
+
+	// the partner sends every webhook twice
+	for _, event := range []string{interfaces.COURIER_ASSIGNED_STATE, interfaces.COURIER_ARRIVING_STATE, interfaces.COURIER_PICKED_UP_STATE} {
+		for i := 0; i < 2; i++ {
+			if err := update(&order, event); err != nil {
+				t.Errorf("%s webhook %d was turned away: %v", event, i+1, err)
+			}
+		}
+	}
+	if order.GetState() != interfaces.DELIVERED_ORDER_STATE || courierState(&order) != interfaces.COURIER_PICKED_UP_STATE {
+		t.Errorf("expected the order to be delivered once, got %s and %s", order.GetState(), courierState(&order))
+	}
+	if err := update(&order, interfaces.COURIER_ASSIGNED_STATE); err == nil {
+		t.Error("a courier who picked up their order was assigned again")
+	}
+
+	// the courier only picks up once the order has come off the shelves
+	gone := interfaces.CreateFoodOrder("gone", 0.1, 300, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	ck.ReceiveOrder(&gone)
+	update(&gone, interfaces.COURIER_ASSIGNED_STATE)
+	update(&gone, interfaces.COURIER_ARRIVING_STATE)
+	ck.CarrierFacility.GiveOrder(gone.GetID())
+	if err := update(&gone, interfaces.COURIER_PICKED_UP_STATE); err == nil {
+		t.Error("a courier picked up an order that wasn't on the shelves")
+	}
+	if courierState(&gone) != interfaces.COURIER_ARRIVING_STATE {
+		t.Errorf("expected the courier to still be arriving, got %s", courierState(&gone))
+	}
+}
+
+func TestDarkKitchenStep_Failure_RealClock(t *testing.T) {
+	simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+	ck := interfaces.CreateDarkKitchen(simulationConfig)
+
+	if err := ck.Step(1); err == nil {
+		t.Error("Step should error out since the clock is not a FakeClock")
+	}
+}
+
+// Test Simulation related functionality
+func TestEventLog_Success_CutsOffTornEntry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "events.log")
+
+	eventLog, err := interfaces.CreateEventLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for seq := uint64(1); seq <= 3; seq++ {
+		if err := eventLog.Append(interfaces.Event{Seq: seq, Type: interfaces.ORDER_RECEIVED_EVENT_TYPE}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	eventLog.Close()
+
+	if err := eventLog.Append(interfaces.Event{Seq: 4}); err == nil {
+		t.Error("expected an error appending to a closed log")
+	}
+
+	// the backend went down halfway through writing an entry
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	file.WriteString(`{"seq":4,"type":"Order`)
+	file.Close()
+
+	eventLog, err = interfaces.CreateEventLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events := eventLog.Events(); len(events) != 3 || events[2].Seq != 3 {
+		t.Errorf("expected the 3 complete entries, got %v", events)
+	}
+
+	eventLog.Append(interfaces.Event{Seq: 4, Type: interfaces.ORDER_RECEIVED_EVENT_TYPE})
+	eventLog.Close()
+
+	eventLog, _ = interfaces.CreateEventLog(path)
+	if events := eventLog.Events(); len(events) != 4 || events[3].Seq != 4 {
+		t.Errorf("expected the entry appended after the torn one, got %v", events)
+	}
+	eventLog.Close()
+
+	// an entry that is complete but unreadable can't be skipped over
+	ioutil.WriteFile(path, []byte("{\"seq\":1}\nnot json\n{\"seq\":3}\n"), 0644)
+	if _, err := interfaces.CreateEventLog(path); err == nil {
+		t.Error("expected an error for a corrupt entry")
+	}
+}
+
+func TestEventLog_Failure_WithholdsEventsThatArentLogged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	eventLog, err := interfaces.CreateEventLog(filepath.Join(dir, "events.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eventLog.Close()
+	simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+	simulationConfig.Clock = interfaces.CreateFakeClock(time.Time{})
+	ck, err := interfaces.RecoverDarkKitchen(simulationConfig, nil, eventLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscription, err := ck.Events.Subscribe(100, interfaces.DROP_SUBSCRIPTION_POLICY)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an order that can't be written to the log, since JSON has no NaN
+	unloggable := interfaces.CreateFoodOrder("unloggable", float32(math.NaN()), 100, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	if err := ck.ReceiveOrder(&unloggable); err == nil {
+		t.Error("an order that couldn't be logged was acknowledged")
+	}
+	select {
+	case <-eventLog.Failed():
+	default:
+		t.Error("the log should say it failed as soon as an append does")
+	}
+
+	// nothing gets logged after a gap, so nothing more is acknowledged either
+	order := interfaces.CreateFoodOrder("order", 0.1, 100, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	if err := ck.ReceiveOrder(&order); err == nil {
+		t.Error("an order was acknowledged after the log failed")
+	}
+	if events := subscription.Drain(); len(events) != 0 || ck.Events.LastSeq() != 0 {
+		t.Errorf("events that weren't logged were handed out %v", events)
+	}
+}
+
+func TestRecoverDarkKitchen_Success_RestoresShelvesAndTimers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "events.log")
+
+	createConfig := func(clock interfaces.Clock) *interfaces.SimulationConfig {
+		simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+		simulationConfig.Shelves = []interfaces.ShelfConfig{
+			{Label: "hot", Capacity: 2, Temperatures: []string{interfaces.HOT_TEMPERATURE_LABEL}, DecayMultiplier: 1},
+			{Label: "overflow", Capacity: 2, Temperatures: []string{interfaces.HOT_TEMPERATURE_LABEL}, DecayMultiplier: 2, Overflow: true},
+		}
+		simulationConfig.Seed = 7
+		simulationConfig.Clock = clock
+		return simulationConfig
+	}
+
+	eventLog, err := interfaces.CreateEventLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakeClock := interfaces.CreateFakeClock(time.Time{})
+	ck, err := interfaces.RecoverDarkKitchen(createConfig(fakeClock), nil, eventLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// orders that decay, get rejected, get cancelled and are moved around
+	orders := make([]interfaces.FoodOrder, 7)
+	for idx := range orders {
+		orders[idx] = interfaces.CreateFoodOrder(fmt.Sprintf("order-%d", idx), 1, float32(4+idx*10), interfaces.HOT_TEMPERATURE_LABEL, ck)
+		ck.ReceiveOrder(&orders[idx])
+		ck.Step(1)
+	}
+	ck.CancelOrder(orders[4].GetID())
+	ck.Step(2)
+
+	// the backend goes down, and comes back on a clock that picks up from the same
+	// time. The first kitchen keeps its log and carries on, to compare against
+	defer eventLog.Close()
+	logged, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recoveredPath := filepath.Join(dir, "recovered.log")
+	if err := ioutil.WriteFile(recoveredPath, logged, 0644); err != nil {
+		t.Fatal(err)
+	}
+	recoveredLog, err := interfaces.CreateEventLog(recoveredPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recoveredLog.Close()
+	recoveredClock := interfaces.CreateFakeClock(fakeClock.Now())
+	recovered, err := interfaces.RecoverDarkKitchen(createConfig(recoveredClock), nil, recoveredLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compare := func(when string) {
+		statuses := func(ck *interfaces.DarkKitchen) string {
+			statuses := ck.ListOrderStatuses(interfaces.OrderFilter{})
+			for idx := range statuses {
+				// a decay goroutine can age its order once more after it
+				// has left the shelves, so only the ages on the shelves have to match
+				if !statuses[idx].State.OnShelves() {
+					statuses[idx].OrderAge = 0
+					statuses[idx].Health = 0
+				}
+			}
+			body, _ := json.Marshal(statuses)
+			return string(body)
+		}
+		if expected, got := statuses(ck), statuses(recovered); expected != got {
+			t.Errorf("%s, expected orders\n%s\ngot\n%s", when, expected, got)
+		}
+
+		state := func(ck *interfaces.DarkKitchen) string {
+			body, _ := json.Marshal(ck.CarrierFacility.GetVersionedState())
+			return string(body)
+		}
+		if expected, got := state(ck), state(recovered); expected != got {
+			t.Errorf("%s, expected shelves\n%s\ngot\n%s", when, expected, got)
+		}
+	}
+
+	compare("after recovering")
+
+	// the decay and driver timers carry on the same as if the backend never went down
+	for i := 0; i < 12; i++ {
+		ck.Step(1)
+		recovered.Step(1)
+	}
+	compare("after carrying on")
+
+	if status, _ := recovered.GetOrderStatus(orders[2].GetID()); status.State != interfaces.DELIVERED_ORDER_STATE {
+		t.Errorf("expected a recovered driver to deliver the order, got %s", status.State)
+	}
+}
+
+func TestStateAt_Success_RebuildsPastShelves(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	eventLog, err := interfaces.CreateEventLog(filepath.Join(dir, "events.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eventLog.Close()
+	snapshots, err := interfaces.CreateSnapshotStore(filepath.Join(dir, "snapshots.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snapshots.Close()
+
+	simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+	simulationConfig.Shelves = []interfaces.ShelfConfig{
+		{Label: "hot", Capacity: 2, Temperatures: []string{interfaces.HOT_TEMPERATURE_LABEL}, DecayMultiplier: 1},
+		{Label: "overflow", Capacity: 2, Temperatures: []string{interfaces.HOT_TEMPERATURE_LABEL}, DecayMultiplier: 2, Overflow: true},
+	}
+	simulationConfig.Seed = 7
+	fakeClock := interfaces.CreateFakeClock(time.Time{})
+	simulationConfig.Clock = fakeClock
+	ck, err := interfaces.RecoverDarkKitchen(simulationConfig, nil, eventLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// what the shelves looked like after every tick, with a snapshot saved every few ticks
+	expected := []interfaces.ShelfSetSnapshot{}
+	for tick := 0; tick < 16; tick++ {
+		// everything that happens at a time is done before the shelves are recorded at it
+		ck.Step(1)
+		if tick < 7 {
+			order := interfaces.CreateFoodOrder(fmt.Sprintf("order-%d", tick), 1, float32(4+tick*10), interfaces.HOT_TEMPERATURE_LABEL, ck)
+			ck.ReceiveOrder(&order)
+			if tick == 6 {
+				ck.CancelOrder(order.GetID())
+			}
+		}
+
+		expected = append(expected, ck.CarrierFacility.GetSnapshot())
+		if tick%5 == 2 {
+			snapshots.Save(ck.TakeSnapshot(eventLog))
+		}
+	}
+
+	check := func(expected interfaces.ShelfSetSnapshot, got interfaces.ShelfSetSnapshot, from string) {
+		if got.Version != expected.Version || !reflect.DeepEqual(got.Counts, expected.Counts) {
+			t.Errorf("at %v from %s, expected version %d and counts %v, got %d and %v", expected.At, from, expected.Version, expected.Counts, got.Version, got.Counts)
+		}
+
+		for label, shelf := range expected.Shelves {
+			for idx, order := range shelf {
+				pastOrder := got.Shelves[label][idx]
+				if (order == nil) != (pastOrder == nil) {
+					t.Errorf("at %v from %s, expected %v in %s %d, got %v", expected.At, from, order, label, idx, pastOrder)
+					continue
+				}
+
+				if order != nil && (order.ID != pastOrder.ID || order.OrderAge != pastOrder.OrderAge || order.State != pastOrder.State ||
+					order.CurrentDecayRate != pastOrder.CurrentDecayRate || !order.ExpectedPickupTime.Equal(pastOrder.ExpectedPickupTime) ||
+					math.Abs(float64(order.Health-pastOrder.Health)) > 0.001) {
+					t.Errorf("at %v from %s, expected %+v in %s %d, got %+v", expected.At, from, *order, label, idx, *pastOrder)
+				}
+			}
+		}
+	}
+
+	for _, snapshot := range expected {
+		withSnapshots, err := ck.StateAt(snapshot.At, eventLog, snapshots)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(snapshot, withSnapshots, "snapshots")
+
+		fromLog, _ := ck.StateAt(snapshot.At, eventLog, nil)
+		check(snapshot, fromLog, "the event log")
+	}
+
+	if _, err := ck.StateAt(fakeClock.Now().Add(time.Hour), eventLog, snapshots); err == nil {
+		t.Error("expected an error for a time that hasn't come yet")
+	}
+
+	// with a snapshot, only the log after it is read. Garble the first
+	// entry so the shelves can only be rebuilt without reading it
+	if snapshot, _, _ := snapshots.Latest(expected[7].At); snapshot.LogOffset == 0 || len(snapshot.PlacedAt) == 0 {
+		t.Fatalf("expected the snapshot to say where to carry on from in the log, got %+v", snapshot)
+	}
+	file, _ := os.OpenFile(filepath.Join(dir, "events.log"), os.O_WRONLY, 0644)
+	file.WriteAt([]byte("garbled"), 0)
+	file.Close()
+	for _, snapshot := range expected[7:] {
+		withSnapshots, err := ck.StateAt(snapshot.At, eventLog, snapshots)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(snapshot, withSnapshots, "snapshots after the log was garbled")
+	}
+	if _, err := ck.StateAt(fakeClock.Now(), eventLog, nil); err == nil {
+		t.Error("expected the garbled entry to be read without a snapshot")
+	}
+}
+
+func TestSimulationRegistry_Success_StopAndReset(t *testing.T) {
+	baseConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+	baseConfig.Clock = interfaces.CreateFakeClock(time.Time{})
+	simulations := interfaces.CreateSimulationRegistry(baseConfig)
+
+	seed := int64(42)
+	request := interfaces.SimulationRequest{
+		PoissonRateParameter: 4,
+		DriverMinDelay:       50,
+		DriverMaxDelay:       50,
+		TimeUnits:            10,
+		Seed:                 &seed,
+	}
+	for i := 0; i < 5; i++ {
+		request.Orders = append(request.Orders, interfaces.FoodOrderInput{Name: fmt.Sprintf("order-%d", i), Temperature: interfaces.HOT_TEMPERATURE_LABEL, ShelfLife: 1000, DecayRate: 0.1})
+	}
+
+	simulation, err := simulations.Start(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	darkKitchen := simulation.DarkKitchen()
+	if err := darkKitchen.Step(10); err != nil {
+		t.Fatal(err)
+	}
+
+	status := simulation.GetStatus()
+	if status.State != interfaces.SIMULATION_RUNNING_STATE || status.Seed != seed || status.OrdersReceived != 5 || status.OrdersByState[interfaces.ON_SHELF_ORDER_STATE] != 5 {
+		t.Fatalf("unexpected status after feeding the orders %+v", status)
+	}
+
+	simulation.Stop()
+	if status := simulation.GetStatus(); status.State != interfaces.SIMULATION_STOPPED_STATE || status.StoppedAt == nil {
+		t.Errorf("unexpected status after stopping %+v", status)
+	}
+
+	newOrder := interfaces.CreateFoodOrder("late-order", 0.1, 1000, interfaces.HOT_TEMPERATURE_LABEL, darkKitchen)
+	if err := darkKitchen.ReceiveOrder(&newOrder); err == nil {
+		t.Error("a stopped kitchen should turn away new orders")
+	}
+
+	fedOrderID := darkKitchen.ListOrderStatuses(interfaces.OrderFilter{})[0].ID
+	if found, err := simulations.FindOrder(fedOrderID); err != nil || found != simulation {
+		t.Errorf("expected to find the order in its simulation, got %v", err)
+	}
+
+	if _, err := simulations.Reset(simulation.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := simulations.FindOrder(fedOrderID); err == nil {
+		t.Error("an order from before the reset shouldn't be found anymore")
+	}
+	if simulation.DarkKitchen() == darkKitchen {
+		t.Fatal("reset should start a fresh kitchen")
+	}
+	status = simulation.GetStatus()
+	if status.State != interfaces.SIMULATION_RUNNING_STATE || status.Resets != 1 || status.OrdersReceived != 0 || status.Seed != seed {
+		t.Errorf("unexpected status after resetting %+v", status)
+	}
+
+	// another simulation runs next to the first one without touching it
+	other, err := simulations.Start(interfaces.SimulationRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	drawnSeed := other.GetStatus().Seed
+	if _, err := simulations.Reset(other.ID); err != nil {
+		t.Fatal(err)
+	}
+	if seed := other.GetStatus().Seed; seed != drawnSeed {
+		t.Errorf("expected the seed drawn for the simulation, %d, to be kept through a reset, got %d", drawnSeed, seed)
+	}
+	otherOrder := interfaces.CreateFoodOrder("other-order", 0.1, 1000, interfaces.COLD_TEMPERATURE_LABEL, other.DarkKitchen())
+	if err := other.DarkKitchen().ReceiveOrder(&otherOrder); err != nil {
+		t.Fatal(err)
+	}
+	if simulation.GetStatus().State != interfaces.SIMULATION_RUNNING_STATE {
+		t.Error("the new simulation should leave the first running")
+	}
+	if simulation.GetStatus().OrdersReceived != 0 || other.GetStatus().OrdersReceived != 1 {
+		t.Error("orders should only go to the simulation they were sent to")
+	}
+	if found, err := simulations.FindOrder(otherOrder.GetID()); err != nil || found != other {
+		t.Errorf("expected to find the order in the simulation it was sent to, got %v", err)
+	}
+	if len(simulations.List()) != 2 {
+		t.Errorf("expected 2 simulations, got %d", len(simulations.List()))
+	}
+
+	if _, err := simulations.Get("missing"); err == nil {
+		t.Error("looking up an unknown simulation should error out")
+	}
+}
+
+func TestSimulationRegistry_Success_CollectsIdleSimulations(t *testing.T) {
+	baseConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+	fakeClock := interfaces.CreateFakeClock(time.Time{})
+	baseConfig.Clock = fakeClock
+	simulations := interfaces.CreateSimulationRegistry(baseConfig)
+
+	idle, _ := simulations.Start(interfaces.SimulationRequest{})
+	watched, _ := simulations.Start(interfaces.SimulationRequest{})
+	kept, _ := simulations.Start(interfaces.SimulationRequest{})
+	simulations.Keep(kept.ID)
+	watched.Attach()
+
+	fakeClock.Advance(time.Hour)
+	if collected := simulations.CollectIdle(time.Hour); !reflect.DeepEqual(collected, []string{idle.ID}) {
+		t.Fatalf("expected only %s to be collected, got %v", idle.ID, collected)
+	}
+	if _, err := simulations.Get(idle.ID); err == nil {
+		t.Error("a collected simulation should be forgotten")
+	}
+	if !idle.DarkKitchen().IsStopped() {
+		t.Error("a collected simulation should be stopped")
+	}
+
+	// the idle timer starts over once the last watcher leaves
+	watched.Detach()
+	if collected := simulations.CollectIdle(time.Hour); len(collected) != 0 {
+		t.Errorf("nothing should be collected yet, got %v", collected)
+	}
+	fakeClock.Advance(time.Hour)
+	if collected := simulations.CollectIdle(time.Hour); !reflect.DeepEqual(collected, []string{watched.ID}) {
+		t.Errorf("expected only %s to be collected, got %v", watched.ID, collected)
+	}
+
+	if _, err := simulations.Get(kept.ID); err != nil || len(simulations.List()) != 1 {
+		t.Error("a kept simulation should never be collected")
+	}
+}
+
+// Test Event related functionality
+func TestEventStream_Success_PublishesOrderAndDriverEvents(t *testing.T) {
+	simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+	simulationConfig.Shelves = []interfaces.ShelfConfig{
+		{Label: "hot", Capacity: 1, Temperatures: []string{interfaces.HOT_TEMPERATURE_LABEL}, DecayMultiplier: 1},
+		{Label: "overflow", Capacity: 1, Temperatures: []string{interfaces.HOT_TEMPERATURE_LABEL}, DecayMultiplier: 2, Overflow: true},
+	}
+	fakeClock := interfaces.CreateFakeClock(time.Time{})
+	simulationConfig.Clock = fakeClock
+	ck := interfaces.CreateDarkKitchen(simulationConfig)
+	subscription, err := ck.Events.Subscribe(1000, interfaces.DROP_SUBSCRIPTION_POLICY)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first order is the healthiest, so it goes to overflow to make room
+	// for the second. the third doesn't fit anywhere
+	orders := []interfaces.FoodOrder{
+		interfaces.CreateFoodOrder("first", 0.1, 1000, interfaces.HOT_TEMPERATURE_LABEL, ck),
+		interfaces.CreateFoodOrder("second", 0.1, 100, interfaces.HOT_TEMPERATURE_LABEL, ck),
+		interfaces.CreateFoodOrder("third", 0.1, 10, interfaces.HOT_TEMPERATURE_LABEL, ck),
+	}
+	for idx := range orders {
+		ck.ReceiveOrder(&orders[idx])
+	}
+
+	// cancel the second order so the first is rescued from overflow
+	if err := ck.CancelOrder(orders[1].GetID()); err != nil {
+		t.Fatal(err)
+	}
+
+	type eventSummary struct {
+		Type    interfaces.EventType
+		OrderID string
+		Shelf   string
+	}
+	expected := []eventSummary{
+		{interfaces.ORDER_RECEIVED_EVENT_TYPE, orders[0].GetID(), ""},
+		{interfaces.ORDER_PLACED_EVENT_TYPE, orders[0].GetID(), "hot"},
+		{interfaces.DRIVER_DISPATCHED_EVENT_TYPE, orders[0].GetID(), ""},
+		{interfaces.ORDER_RECEIVED_EVENT_TYPE, orders[1].GetID(), ""},
+		{interfaces.ORDER_MOVED_TO_OVERFLOW_EVENT_TYPE, orders[0].GetID(), "overflow"},
+		{interfaces.ORDER_PLACED_EVENT_TYPE, orders[1].GetID(), "hot"},
+		{interfaces.DRIVER_DISPATCHED_EVENT_TYPE, orders[1].GetID(), ""},
+		{interfaces.ORDER_RECEIVED_EVENT_TYPE, orders[2].GetID(), ""},
+		{interfaces.ORDER_REJECTED_NO_SPACE_EVENT_TYPE, orders[2].GetID(), ""},
+		{interfaces.ORDER_CANCELLED_EVENT_TYPE, orders[1].GetID(), "hot"},
+		{interfaces.ORDER_RESCUED_FROM_OVERFLOW_EVENT_TYPE, orders[0].GetID(), "hot"},
+		{interfaces.DRIVER_RECALLED_EVENT_TYPE, orders[1].GetID(), ""},
+	}
+
+	events := subscription.Drain()
+	summaries := []eventSummary{}
+	for idx, message := range events {
+		event := message.(interfaces.Event)
+		if event.Seq != uint64(idx+1) {
+			t.Errorf("event %d has sequence number %d", idx, event.Seq)
+		}
+		summaries = append(summaries, eventSummary{event.Type, event.OrderID, event.Shelf})
+	}
+	if !reflect.DeepEqual(summaries, expected) {
+		t.Fatalf("unexpected events\n%v\nexpected\n%v", summaries, expected)
+	}
+
+	rescued := events[10].(interfaces.Event)
+	if rescued.FromShelf != "overflow" || *rescued.FromSlot != 0 || *rescued.Slot != 0 {
+		t.Errorf("rescue should say where the order came from %+v", rescued)
+	}
+
+	// once the first order's driver arrives it is picked up and delivered
+	for tick := 0; tick < 20 && !orders[0].GetPickedUp(); tick++ {
+		ck.Step(1)
+	}
+	expectedTypes := []interfaces.EventType{interfaces.DRIVER_ARRIVED_EVENT_TYPE, interfaces.ORDER_PICKED_UP_EVENT_TYPE, interfaces.ORDER_DELIVERED_EVENT_TYPE}
+	types := []interfaces.EventType{}
+	for _, message := range subscription.Drain() {
+		event := message.(interfaces.Event)
+		if event.At != fakeClock.Now() {
+			t.Errorf("event was stamped %v instead of the simulated time %v", event.At, fakeClock.Now())
+		}
+		types = append(types, event.Type)
+	}
+	if !reflect.DeepEqual(types, expectedTypes) {
+		t.Errorf("expected %v once the driver arrives, got %v", expectedTypes, types)
+	}
+}
+
+func TestEventStream_Success_SubscribeSince(t *testing.T) {
+	events := interfaces.CreateEventStream()
+	for i := 0; i < 5; i++ {
+		events.Publish(interfaces.Event{Type: interfaces.ORDER_RECEIVED_EVENT_TYPE})
+	}
+
+	_, backlog, ok, err := events.SubscribeSince(2, 10, interfaces.DROP_SUBSCRIPTION_POLICY)
+	if err != nil || !ok || len(backlog) != 3 || backlog[0].Seq != 3 || backlog[2].Seq != 5 {
+		t.Errorf("expected events 3 to 5, got %v %v", backlog, ok)
+	}
+
+	subscription, backlog, ok, _ := events.SubscribeSince(5, 10, interfaces.DROP_SUBSCRIPTION_POLICY)
+	if !ok || len(backlog) != 0 {
+		t.Errorf("a client that is caught up shouldn't get a backlog, got %v %v", backlog, ok)
+	}
+	events.Publish(interfaces.Event{Type: interfaces.ORDER_RECEIVED_EVENT_TYPE})
+	if messages := subscription.Drain(); len(messages) != 1 || messages[0].(interfaces.Event).Seq != 6 {
+		t.Errorf("expected event 6 from the subscription, got %v", messages)
+	}
+
+	if _, _, ok, _ := events.SubscribeSince(9, 10, interfaces.DROP_SUBSCRIPTION_POLICY); ok {
+		t.Error("a version that hasn't been published yet can't be caught up from")
+	}
+
+	for i := 0; i < interfaces.EVENT_HISTORY_SIZE; i++ {
+		events.Publish(interfaces.Event{Type: interfaces.ORDER_RECEIVED_EVENT_TYPE})
+	}
+	if _, _, ok, _ := events.SubscribeSince(1, 10, interfaces.DROP_SUBSCRIPTION_POLICY); ok {
+		t.Error("a version that has fallen out of the history can't be caught up from")
+	}
+}
+
+func TestEventFilter_Success_MatchesTypesAndShelves(t *testing.T) {
+	slot := 0
+	placed := interfaces.Event{Type: interfaces.ORDER_PLACED_EVENT_TYPE, Shelf: "hot", Slot: &slot}
+	moved := interfaces.Event{Type: interfaces.ORDER_MOVED_TO_OVERFLOW_EVENT_TYPE, Shelf: "overflow", Slot: &slot, FromShelf: "hot", FromSlot: &slot}
+	dispatched := interfaces.Event{Type: interfaces.DRIVER_DISPATCHED_EVENT_TYPE}
+
+	tests := []struct {
+		types    []string
+		shelves  []string
+		expected []bool
+	}{
+		{nil, nil, []bool{true, true, true}},
+		{[]string{"OrderPlaced", "DriverDispatched"}, nil, []bool{true, false, true}},
+		{nil, []string{"hot"}, []bool{true, true, false}},
+		{nil, []string{"overflow"}, []bool{false, true, false}},
+		{[]string{"OrderPlaced"}, []string{"overflow"}, []bool{false, false, false}},
+	}
+
+	for _, test := range tests {
+		filter, err := interfaces.CreateEventFilter(test.types, test.shelves)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for idx, event := range []interfaces.Event{placed, moved, dispatched} {
+			if filter.Matches(event) != test.expected[idx] {
+				t.Errorf("filter on %v %v: expected %v for %s", test.types, test.shelves, test.expected[idx], event.Type)
+			}
+		}
+	}
+
+	filter, _ := interfaces.CreateEventFilter(nil, []string{"hot"})
+	state := filter.FilterState(interfaces.ShelfSetState{Shelves: map[string][]*interfaces.ViewableOrder{"hot": nil, "cold": nil}})
+	if _, ok := state.Shelves["cold"]; ok || len(state.Shelves) != 1 {
+		t.Errorf("expected only the hot shelf, got %v", state.Shelves)
+	}
+
+	if _, err := interfaces.CreateEventFilter([]string{"OrderEaten"}, nil); err == nil {
+		t.Error("expected an error for an unknown event type")
+	}
+}
+
+func TestShelfSetDiff_Success_DiffsRebuildVersionedState(t *testing.T) {
+	simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+	simulationConfig.Shelves = []interfaces.ShelfConfig{
+		{Label: "hot", Capacity: 2, Temperatures: []string{interfaces.HOT_TEMPERATURE_LABEL}, DecayMultiplier: 1},
+		{Label: "overflow", Capacity: 2, Temperatures: []string{interfaces.HOT_TEMPERATURE_LABEL}, DecayMultiplier: 2, Overflow: true},
+	}
+	simulationConfig.Seed = 42
+	fakeClock := interfaces.CreateFakeClock(time.Time{})
+	simulationConfig.Clock = fakeClock
+	ck := interfaces.CreateDarkKitchen(simulationConfig)
+
+	subscription, _ := ck.Events.Subscribe(1000, interfaces.DROP_SUBSCRIPTION_POLICY)
+	state := ck.CarrierFacility.GetVersionedState()
+
+	// orders that get moved to overflow, rescued, rejected, cancelled, decay and get picked up
+	orders := []interfaces.FoodOrder{}
+	for i := 0; i < 6; i++ {
+		orders = append(orders, interfaces.CreateFoodOrder(fmt.Sprintf("order-%d", i), 1, float32(3+i*20), interfaces.HOT_TEMPERATURE_LABEL, ck))
+	}
+	for idx := range orders {
+		ck.ReceiveOrder(&orders[idx])
+		if idx == 3 {
+			ck.CancelOrder(orders[3].GetID())
+		}
+	}
+	ck.Step(20)
+
+	for _, message := range subscription.Drain() {
+		event := message.(interfaces.Event)
+		if diff, ok := ck.DiffFromEvent(event); ok {
+			for _, change := range diff.Slots {
+				state.Shelves[change.Shelf][change.Slot] = change.Order
+			}
+			for label, count := range diff.Counts {
+				state.Counts[label] += count
+			}
+		}
+		state.Version = event.Seq
+	}
+
+	expected := ck.CarrierFacility.GetVersionedState()
+	slotIDs := func(state interfaces.ShelfSetState) map[string][]string {
+		ids := map[string][]string{}
+		for label, shelf := range state.Shelves {
+			for _, order := range shelf {
+				id := ""
+				if order != nil {
+					id = order.ID
+				}
+				ids[label] = append(ids[label], id)
+			}
+		}
+		return ids
+	}
+
+	if state.Version != expected.Version || !reflect.DeepEqual(slotIDs(state), slotIDs(expected)) || !reflect.DeepEqual(state.Counts, expected.Counts) {
+		t.Errorf("applying the diffs gave\n%v %v %v\ninstead of\n%v %v %v", state.Version, slotIDs(state), state.Counts, expected.Version, slotIDs(expected), expected.Counts)
+	}
+
+	// make sure every kind of change was covered
+	if expected.Counts[interfaces.SHELFSET_WASTED_ORDERS_DECAY_LABEL] == 0 || expected.Counts[interfaces.SHELFSET_WASTED_ORDERS_NOSPACE_LABEL] == 0 || expected.Counts[interfaces.SHELFSET_CANCELLED_ORDERS_LABEL] == 0 {
+		t.Errorf("expected some decayed, rejected and cancelled orders, got %v", expected.Counts)
+	}
+}
+
+func TestShelfWatcher_Success_KeepsClientsShelvesUpToDate(t *testing.T) {
+	baseConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+	baseConfig.Clock = interfaces.CreateFakeClock(time.Time{})
+	simulations := interfaces.CreateSimulationRegistry(baseConfig)
+	simulation, err := simulations.Start(interfaces.SimulationRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	receive := func(temperature string) {
+		order := interfaces.CreateFoodOrder(temperature+"-order", 0.1, 1000, temperature, simulation.DarkKitchen())
+		if err := simulation.DarkKitchen().ReceiveOrder(&order); err != nil {
+			t.Fatal(err)
+		}
+	}
+	watch := func(bufferSize int, filter interfaces.EventFilter, since *uint64) (*interfaces.ShelfWatcher, *[]interfaces.ShelfUpdate) {
+		updates := []interfaces.ShelfUpdate{}
+		watcher, err := simulation.WatchShelves(bufferSize, filter, since, func(update interfaces.ShelfUpdate) error {
+			updates = append(updates, update)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return watcher, &updates
+	}
+	// the types of the Events sent, with "snapshot" for a snapshot
+	sent := func(updates []interfaces.ShelfUpdate) []string {
+		types := []string{}
+		for _, update := range updates {
+			if update.Snapshot != nil {
+				types = append(types, update.Snapshot.Type)
+			} else {
+				types = append(types, string(update.Event.Type))
+			}
+		}
+		return types
+	}
+
+	// a new client starts from a snapshot, and is then sent every Event
+	receive(interfaces.HOT_TEMPERATURE_LABEL)
+	watcher, updates := watch(100, interfaces.EventFilter{}, nil)
+	receive(interfaces.COLD_TEMPERATURE_LABEL)
+	watcher.Update()
+	expected := []string{interfaces.SNAPSHOT_MESSAGE_TYPE, "OrderReceived", "OrderPlaced", "DriverDispatched"}
+	if types := sent(*updates); !reflect.DeepEqual(types, expected) {
+		t.Fatalf("expected %v, got %v", expected, types)
+	}
+	if placed := (*updates)[2]; placed.Diff == nil || placed.Diff.Slots[0].Shelf != interfaces.COLD_TEMPERATURE_LABEL || (*updates)[1].Diff != nil {
+		t.Errorf("expected a diff only for the order placed on the cold shelf, got %+v", *updates)
+	}
+	version := (*updates)[3].Event.Seq
+	watcher.Close()
+
+	// a client that comes back is sent only what it missed
+	receive(interfaces.FROZEN_TEMPERATURE_LABEL)
+	watcher, updates = watch(100, interfaces.EventFilter{}, &version)
+	expected = []string{"OrderReceived", "OrderPlaced", "DriverDispatched"}
+	if types := sent(*updates); !reflect.DeepEqual(types, expected) || (*updates)[0].Event.Seq != version+1 {
+		t.Errorf("expected to catch up from %d with %v, got %v", version, expected, types)
+	}
+	watcher.Close()
+
+	// or a snapshot, if the client is ahead of the simulation
+	ahead := version + 100
+	watcher, updates = watch(100, interfaces.EventFilter{}, &ahead)
+	if types := sent(*updates); !reflect.DeepEqual(types, []string{interfaces.SNAPSHOT_MESSAGE_TYPE}) || (*updates)[0].Snapshot.Version != simulation.Events().LastSeq() {
+		t.Errorf("expected a snapshot for a version that hasn't been published, got %v", types)
+	}
+	watcher.Close()
+
+	// a client that falls behind gets a snapshot in place of the Events it missed
+	watcher, updates = watch(1, interfaces.EventFilter{}, nil)
+	receive(interfaces.HOT_TEMPERATURE_LABEL)
+	watcher.Update()
+	if types := sent(*updates); !reflect.DeepEqual(types, []string{interfaces.SNAPSHOT_MESSAGE_TYPE, interfaces.SNAPSHOT_MESSAGE_TYPE}) || (*updates)[1].Snapshot.Version != simulation.Events().LastSeq() {
+		t.Errorf("expected a new snapshot after Events were dropped, got %v", types)
+	}
+
+	// and so does one watching a simulation that is reset
+	simulation.Reset()
+	watcher.Update()
+	if last := (*updates)[len(*updates)-1]; last.Snapshot == nil || last.Snapshot.Counts[interfaces.SHELFSET_WASTED_ORDERS_NOSPACE_LABEL] != 0 || len(last.Snapshot.Shelves[interfaces.HOT_TEMPERATURE_LABEL]) == 0 || last.Snapshot.Shelves[interfaces.HOT_TEMPERATURE_LABEL][0] != nil {
+		t.Errorf("expected a snapshot of the empty shelves after a reset, got %+v", last)
+	}
+	watcher.Close()
+
+	// only the Events and shelves that get through the filter are sent
+	filter, _ := interfaces.CreateEventFilter([]string{"OrderPlaced", "DriverDispatched"}, []string{interfaces.HOT_TEMPERATURE_LABEL})
+	watcher, updates = watch(100, filter, nil)
+	receive(interfaces.COLD_TEMPERATURE_LABEL)
+	receive(interfaces.HOT_TEMPERATURE_LABEL)
+	watcher.Update()
+	if types := sent(*updates); !reflect.DeepEqual(types, []string{interfaces.SNAPSHOT_MESSAGE_TYPE, "OrderPlaced"}) || (*updates)[1].Diff.Slots[0].Shelf != interfaces.HOT_TEMPERATURE_LABEL {
+		t.Errorf("expected only the order placed on the hot shelf, got %v", types)
+	}
+	if shelves := (*updates)[0].Snapshot.Shelves; len(shelves) != 1 || shelves[interfaces.HOT_TEMPERATURE_LABEL] == nil {
+		t.Errorf("expected a snapshot of only the hot shelf, got %v", shelves)
+	}
+	watcher.Close()
+
+	// the simulation can be collected once nobody is watching it
+	baseConfig.Clock.(*interfaces.FakeClock).Advance(time.Hour)
+	if collected := simulations.CollectIdle(time.Hour); !reflect.DeepEqual(collected, []string{simulation.ID}) {
+		t.Errorf("expected the simulation to be collected once its watchers left, got %v", collected)
+	}
+}
+
+func TestMetrics_Success_CountShelfAndDriverActivity(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := interfaces.CreateMetrics(registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+	simulationConfig.Shelves = []interfaces.ShelfConfig{
+		{Label: "hot", Capacity: 2, Temperatures: []string{interfaces.HOT_TEMPERATURE_LABEL}, DecayMultiplier: 1},
+		{Label: "overflow", Capacity: 2, Temperatures: []string{interfaces.HOT_TEMPERATURE_LABEL}, DecayMultiplier: 2, Overflow: true},
+	}
+	simulationConfig.Seed = 42
+	simulationConfig.Clock = interfaces.CreateFakeClock(time.Time{})
+	simulationConfig.Metrics = metrics
+	ck := interfaces.CreateDarkKitchen(simulationConfig)
+	subscription, _ := ck.Events.Subscribe(1000, interfaces.DROP_SUBSCRIPTION_POLICY)
+
+	for i := 0; i < 8; i++ {
+		order := interfaces.CreateFoodOrder(fmt.Sprintf("order-%d", i), 1, float32(3+(3-i%4)*20), interfaces.HOT_TEMPERATURE_LABEL, ck)
+		ck.ReceiveOrder(&order)
+	}
+	ck.Step(12)
+
+	// what the metrics should add up to, going by the events
+	events := map[interfaces.EventType]float64{}
+	for _, message := range subscription.Drain() {
+		events[message.(interfaces.Event).Type]++
+	}
+	occupied := map[string]float64{}
+	for label, shelf := range ck.CarrierFacility.GetVersionedState().Shelves {
+		for _, order := range shelf {
+			if order != nil {
+				occupied[label]++
+			}
+		}
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every sample by its name and label values, with histograms by their sample count
+	samples := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			name := family.GetName()
+			for _, label := range metric.GetLabel() {
+				name += "/" + label.GetValue()
+			}
+			samples[name] = metric.GetCounter().GetValue() + metric.GetGauge().GetValue() + float64(metric.GetHistogram().GetSampleCount())
+		}
+	}
+
+	expected := map[string]float64{
+		"darkkitchen_orders_received_total":              events[interfaces.ORDER_RECEIVED_EVENT_TYPE],
+		"darkkitchen_orders_moved_to_overflow_total":     events[interfaces.ORDER_MOVED_TO_OVERFLOW_EVENT_TYPE],
+		"darkkitchen_orders_rescued_from_overflow_total": events[interfaces.ORDER_RESCUED_FROM_OVERFLOW_EVENT_TYPE],
+		"darkkitchen_orders_picked_up_total":             events[interfaces.ORDER_PICKED_UP_EVENT_TYPE],
+		"darkkitchen_order_health_at_pickup":             events[interfaces.ORDER_PICKED_UP_EVENT_TYPE],
+		"darkkitchen_driver_wait_seconds":                events[interfaces.DRIVER_ARRIVED_EVENT_TYPE],
+		"darkkitchen_orders_wasted_total/decay":          events[interfaces.ORDER_DECAYED_EVENT_TYPE],
+		"darkkitchen_orders_wasted_total/no_space":       events[interfaces.ORDER_REJECTED_NO_SPACE_EVENT_TYPE],
+		"darkkitchen_shelf_orders/hot":                   occupied["hot"],
+		"darkkitchen_shelf_orders/overflow":              occupied["overflow"],
+		// every time an order was put in a space and then left it
+		"darkkitchen_order_shelf_seconds/hot/overflow": events[interfaces.ORDER_PLACED_EVENT_TYPE] + events[interfaces.ORDER_MOVED_TO_OVERFLOW_EVENT_TYPE] +
+			events[interfaces.ORDER_RESCUED_FROM_OVERFLOW_EVENT_TYPE] - occupied["hot"] - occupied["overflow"],
+	}
+	samples["darkkitchen_orders_placed_total/hot/overflow"] = samples["darkkitchen_orders_placed_total/hot"] + samples["darkkitchen_orders_placed_total/overflow"]
+	samples["darkkitchen_order_shelf_seconds/hot/overflow"] = samples["darkkitchen_order_shelf_seconds/hot"] + samples["darkkitchen_order_shelf_seconds/overflow"]
+	expected["darkkitchen_orders_placed_total/hot/overflow"] = events[interfaces.ORDER_PLACED_EVENT_TYPE]
+
+	for name, value := range expected {
+		if samples[name] != value {
+			t.Errorf("expected %s to be %v, got %v", name, value, samples[name])
+		}
+	}
+
+	for _, name := range []string{"darkkitchen_orders_moved_to_overflow_total", "darkkitchen_orders_picked_up_total", "darkkitchen_orders_wasted_total/decay", "darkkitchen_orders_wasted_total/no_space"} {
+		if expected[name] == 0 {
+			t.Errorf("expected the orders to cover %s", name)
+		}
+	}
+
+	if _, err := interfaces.CreateMetrics(registry); err == nil {
+		t.Error("expected an error registering the metrics twice")
+	}
+}
+
+func TestCreateSimulation_Failure_InvalidRequest(t *testing.T) {
+	baseConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+	requests := []interfaces.SimulationRequest{
+		{PoissonRateParameter: -1},
+		{DriverMinDelay: 8, DriverMaxDelay: 2},
+		{DriverMinDelay: -2, DriverMaxDelay: 8},
+		{TimeUnits: -1000},
+	}
+
+	for _, request := range requests {
+		if _, err := interfaces.CreateSimulation(request, baseConfig); err == nil {
+			t.Errorf("expected %+v to be rejected", request)
+		}
+	}
+}
+
+// Test Hub related functionality
+func TestHub_Success_FansOutToEverySubscriber(t *testing.T) {
+	ck := interfaces.CreateDarkKitchen(interfaces.CreateSimulationConfig(50, 50, interfaces.DEFAULT_SLEEP_TIME))
+
+	// two browser tabs watching the same kitchen
+	first, err := ck.Events.Subscribe(interfaces.WEBSOCKET_BUFFER_SIZE, interfaces.COALESCE_SUBSCRIPTION_POLICY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ck.Events.Subscribe(interfaces.WEBSOCKET_BUFFER_SIZE, interfaces.COALESCE_SUBSCRIPTION_POLICY)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newOrder := interfaces.CreateFoodOrder("order-name", 0.1, 1000, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	if err := ck.ReceiveOrder(&newOrder); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, subscription := range []*interfaces.Subscription{first, second} {
+		select {
+		case <-subscription.Ready():
+		case <-time.After(5 * time.Second):
+			t.Fatal("every subscriber should hear about the order")
+		}
+
+		if messages := subscription.Drain(); len(messages) != 3 {
+			t.Errorf("expected every event to reach every subscriber, got %v", messages)
+		}
+	}
+
+	first.Close()
+	first.Close()
+	nextOrder := interfaces.CreateFoodOrder("order-name", 0.1, 1000, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	ck.ReceiveOrder(&nextOrder)
+	if messages := first.Drain(); len(messages) != 0 {
+		t.Errorf("a closed subscription shouldn't receive events, got %v", messages)
+	}
+}
+
+type testCoalescer struct {
+	key   string
+	value int
+}
+
+func (c testCoalescer) CoalesceKey() string {
+	return c.key
+}
+
+func TestHub_Success_SlowSubscriberPolicies(t *testing.T) {
+	hub := interfaces.CreateHub()
+	dropping, _ := hub.Subscribe(2, interfaces.DROP_SUBSCRIPTION_POLICY)
+	coalescing, _ := hub.Subscribe(2, interfaces.COALESCE_SUBSCRIPTION_POLICY)
+
+	hub.Publish(testCoalescer{"a", 1})
+	hub.Publish(testCoalescer{"b", 1})
+	hub.Publish(testCoalescer{"a", 2})
+	hub.Publish(testCoalescer{"c", 1})
+
+	// the full buffer throws the newest messages away
+	expected := []interface{}{testCoalescer{"a", 1}, testCoalescer{"b", 1}}
+	if messages := dropping.Drain(); !reflect.DeepEqual(messages, expected) || dropping.Dropped() != 2 {
+		t.Errorf("drop kept %v and dropped %d", messages, dropping.Dropped())
+	}
+
+	// a2 takes a1's place, then c pushes out the oldest message
+	expected = []interface{}{testCoalescer{"b", 1}, testCoalescer{"c", 1}}
+	if messages := coalescing.Drain(); !reflect.DeepEqual(messages, expected) || coalescing.Dropped() != 1 {
+		t.Errorf("coalesce kept %v and dropped %d", messages, coalescing.Dropped())
+	}
+
+	// nobody is draining, but publishing carries on without blocking
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100000; i++ {
+			hub.Publish(i)
+		}
+		done <- true
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("publishing blocked on a subscriber")
+	}
+
+	if messages := dropping.Drain(); len(messages) != 2 {
+		t.Errorf("expected the buffer to hold 2 messages, got %d", len(messages))
+	}
+
+	if _, err := hub.Subscribe(0, interfaces.DROP_SUBSCRIPTION_POLICY); err == nil {
+		t.Error("a subscription needs room for at least one message")
+	}
+	if _, err := hub.Subscribe(1, "unknown"); err == nil {
+		t.Error("subscribing with an unknown policy should error out")
+	}
+}
+
+// stateWithoutIDs marshals the shelf state without the
+// randomly generated order IDs so two runs can be compared
+func stateWithoutIDs(t *testing.T, state interface{}) []byte {
+	jsonState, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsedState := map[string]interface{}{}
+	if err := json.Unmarshal(jsonState, &parsedState); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, shelf := range parsedState {
+		if orders, ok := shelf.([]interface{}); ok {
+			for _, order := range orders {
+				delete(order.(map[string]interface{}), "id")
+			}
+		}
+	}
 
-			// check if order has been picked up
-			// and confirm that it does not die
-			for {
-				if newOrder.GetPickedUp() {
-					break
-				}
+	jsonState, err = json.Marshal(parsedState)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-				if newOrder.GetHealth() <= 0 {
-					break
-				}
-			}
+	return jsonState
+}
 
-			return
-		}(i)
+// Test EventEngine related functionality
+func createEventDarkKitchen(driverMinDelay int, driverMaxDelay int, seed int64) (*interfaces.DarkKitchen, *interfaces.EventEngine) {
+	simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+	simulationConfig.DriverMinDelay = driverMinDelay
+	simulationConfig.DriverMaxDelay = driverMaxDelay
+	simulationConfig.Seed = seed
+	simulationConfig.Engine = interfaces.EVENT_ENGINE_LABEL
+	ck := interfaces.CreateDarkKitchen(simulationConfig)
+
+	return ck, ck.Engine.(*interfaces.EventEngine)
+}
+
+func TestEventEngine_Failure_GetWastedOrdersThatCannotBeAddedToShelves(t *testing.T) {
+	ck, engine := createEventDarkKitchen(100, 100, 1)
+
+	orders := []*interfaces.FoodOrder{}
+	for i := 0; i < 40; i++ {
+		newOrder := interfaces.CreateFoodOrder("order-name", 0.1, 100, interfaces.HOT_TEMPERATURE_LABEL, ck)
+		orders = append(orders, &newOrder)
+		engine.ScheduleOrder(&newOrder, 0)
 	}
 
-	ck.WG.Wait()
+	engine.Run()
 
-	// max is 35 since temp shelf(15) + overflow_shelf(20) = 35
-	if wastedOrdersCount != 5 {
-		t.Error("wasted order count is not exactly 5")
+	state := ck.CarrierFacility.GetState().(map[string]interface{})
+	if state[interfaces.SHELFSET_WASTED_ORDERS_NOSPACE_LABEL] != 5 {
+		t.Errorf("expected 5 orders without space, got %v", state[interfaces.SHELFSET_WASTED_ORDERS_NOSPACE_LABEL])
+	}
+
+	// every order decays before its driver arrives
+	if state[interfaces.SHELFSET_WASTED_ORDERS_DECAY_LABEL] != 35 {
+		t.Errorf("expected 35 decayed orders, got %v", state[interfaces.SHELFSET_WASTED_ORDERS_DECAY_LABEL])
+	}
+
+	for _, order := range orders {
+		if order.GetPickedUp() {
+			t.Error("Order was picked up")
+		}
 	}
 }
 
-func TestReceiveOrder_Success_AllTemperatureOrders(t *testing.T) {
-	simulationConfig := interfaces.CreateSimulationConfig(20, 20, 10)
-	ck := interfaces.CreateDarkKitchen(simulationConfig)
+func TestEventEngine_Success_PickupBeforeDecay(t *testing.T) {
+	ck, engine := createEventDarkKitchen(2, 8, 1)
 
-	for _, label := range []string{interfaces.HOT_TEMPERATURE_LABEL, interfaces.COLD_TEMPERATURE_LABEL, interfaces.FROZEN_TEMPERATURE_LABEL} {
-		for i := 0; i < 15; i++ {
-			ck.WG.Add(1)
-			go func(idx int, tempLabel string) {
-				defer ck.WG.Done()
-				newOrder := interfaces.CreateFoodOrder("order-name", 0.1, 100, tempLabel, ck)
-				err := ck.ReceiveOrder(&newOrder)
-				if err != nil {
-					t.Error(err)
-					return
-				}
+	newOrder := interfaces.CreateFoodOrder("order-name", 0.1, 100, interfaces.FROZEN_TEMPERATURE_LABEL, ck)
+	engine.ScheduleOrder(&newOrder, 5)
 
-				// check if order has been picked up
-				// and confirm that it does not die
-				for {
-					if newOrder.GetPickedUp() {
-						break
-					}
+	engine.RunUntil(4)
+	if newOrder.GetOrderAge() != 0 {
+		t.Error("Order aged before it arrived")
+	}
 
-					if newOrder.GetHealth() <= 0 {
-						t.Error("Order died")
-						return
-					}
-				}
+	engine.Run()
+	if !newOrder.GetPickedUp() {
+		t.Error("Order was not picked up")
+	}
 
-				return
-			}(i, label)
-		}
+	// the driver takes [DriverMinDelay, DriverMaxDelay] ticks
+	if engine.Now() < 7 || engine.Now() > 13 {
+		t.Errorf("driver arrived at tick %d", engine.Now())
 	}
 
-	ck.WG.Wait()
+	if newOrder.GetOrderAge() != float32(engine.Now()-5) {
+		t.Errorf("Order age %v does not match the time it spent on the shelf", newOrder.GetOrderAge())
+	}
 }
 
-func TestReceiveOrder_Success_WastedOrder(t *testing.T) {
-	simulationConfig := interfaces.CreateSimulationConfig(100, 100, 10)
-	ck := interfaces.CreateDarkKitchen(simulationConfig)
+func TestEventEngine_Success_TenThousandOrderDay(t *testing.T) {
+	runDay := func() map[string]interface{} {
+		ck, engine := createEventDarkKitchen(2, 8, 99)
 
-	newOrder := interfaces.CreateFoodOrder("order-name", 10, 1, interfaces.HOT_TEMPERATURE_LABEL, ck)
-	ck.ReceiveOrder(&newOrder)
+		random := rand.New(rand.NewSource(99))
+		temperatures := []string{interfaces.HOT_TEMPERATURE_LABEL, interfaces.COLD_TEMPERATURE_LABEL, interfaces.FROZEN_TEMPERATURE_LABEL}
+		inputs := []interfaces.FoodOrderInput{}
+		for i := 0; i < 10000; i++ {
+			inputs = append(inputs, interfaces.FoodOrderInput{
+				Name:        fmt.Sprintf("order-%d", i),
+				DecayRate:   random.Float32(),
+				ShelfLife:   float32(5 + random.Intn(300)),
+				Temperature: temperatures[random.Intn(len(temperatures))],
+			})
+		}
 
-	if newOrder.GetName() != "order-name" {
-		t.Error("Name does not match")
-	}
+		orders := engine.ScheduleOrders(inputs, 3.25)
+		engine.Run()
 
-	// check if order has been picked up
-	// and confirm that it does not die
-	for {
-		if newOrder.GetPickedUp() {
-			t.Error("Order was picked up")
-			break
+		state := ck.CarrierFacility.GetState().(map[string]interface{})
+		pickedUp := 0
+		for _, order := range orders {
+			if order.GetPickedUp() {
+				pickedUp++
+			}
 		}
 
-		if newOrder.GetHealth() <= 0 {
-			break
+		// every order is either picked up or wasted
+		wasted := state[interfaces.SHELFSET_WASTED_ORDERS_DECAY_LABEL].(int) + state[interfaces.SHELFSET_WASTED_ORDERS_NOSPACE_LABEL].(int)
+		if pickedUp+wasted != len(orders) {
+			t.Errorf("%d orders picked up and %d wasted out of %d", pickedUp, wasted, len(orders))
+		}
+
+		return map[string]interface{}{
+			"pickedUp":      pickedUp,
+			"wastedDecay":   state[interfaces.SHELFSET_WASTED_ORDERS_DECAY_LABEL],
+			"wastedNoSpace": state[interfaces.SHELFSET_WASTED_ORDERS_NOSPACE_LABEL],
 		}
 	}
 
-	ck.WG.Wait()
+	first := runDay()
+	if second := runDay(); !reflect.DeepEqual(first, second) {
+		t.Errorf("same seed gave different results %v and %v", first, second)
+	}
 }
 
-func TestCreateOrder_Failure_InvalidTemperature(t *testing.T) {
-	simulationConfig := interfaces.CreateSimulationConfig(20, 20, 10*time.Millisecond)
-	ck := interfaces.CreateDarkKitchen(simulationConfig)
-
-	newOrder := interfaces.CreateFoodOrder("order-name", 0.1, 10, "INVALID-TEMP", ck)
-	err := ck.ReceiveOrder(&newOrder)
-	if err == nil {
-		t.Error("Order was accepted")
+func TestRunEventSimulation_Success_SameSeedSameResult(t *testing.T) {
+	random := rand.New(rand.NewSource(7))
+	inputs := []interfaces.FoodOrderInput{}
+	for i := 0; i < 500; i++ {
+		inputs = append(inputs, interfaces.FoodOrderInput{Name: fmt.Sprintf("order-%d", i), DecayRate: random.Float32(), ShelfLife: float32(5 + random.Intn(300)), Temperature: interfaces.HOT_TEMPERATURE_LABEL})
+	}
+	run := func(seed int64) interfaces.EventSimulationResult {
+		simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+		simulationConfig.Seed = seed
+		return interfaces.RunEventSimulation(inputs, 3.25, simulationConfig)
 	}
 
-	ck.WG.Wait()
+	first := run(7)
+	if second := run(7); !reflect.DeepEqual(first, second) {
+		t.Errorf("same seed gave different results %+v and %+v", first, second)
+	}
+	if first.Seed != 7 || first.Orders != len(inputs) || first.PickedUp+first.WastedDecay+first.WastedNoSpace != len(inputs) {
+		t.Errorf("expected every order to be picked up or wasted with seed 7, got %+v", first)
+	}
+	if other := run(8); reflect.DeepEqual(first, other) {
+		t.Error("a different seed gave the same result")
+	}
 }
 
 // Test Driver related functionality
@@ -188,6 +2320,126 @@ func TestDriverReceiveOrderRequest_Failure_NilCarrierFacility(t *testing.T) {
 	}
 }
 
+func TestDriverReceiveOrderRequest_Success_WaitsUntilHandedAnOrder(t *testing.T) {
+	simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+	fakeClock := interfaces.CreateFakeClock(time.Time{})
+	simulationConfig.Clock = fakeClock
+	simulationConfig.DispatchStrategy, _ = interfaces.CreateDispatchStrategy(interfaces.FIFO_DISPATCH_STRATEGY_LABEL)
+	ck := interfaces.CreateDarkKitchen(simulationConfig)
+
+	// the driver's order never reaches the shelves, so they wait for the next one
+	driver := interfaces.CreateDriver(ck)
+	request := interfaces.CreateFoodOrder("never-ready", 0.1, 300, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	request.SetExpectedPickupTime(time.Time{}.Add(2 * interfaces.DEFAULT_SLEEP_TIME))
+	received := make(chan error, 1)
+	go func() {
+		received <- driver.ReceiveOrderRequest(&request)
+	}()
+
+	fakeClock.BlockUntil(1)
+	ck.Step(2)
+	select {
+	case err := <-received:
+		t.Fatalf("the driver is waiting for an order, but their request was answered with %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	next := interfaces.CreateFoodOrder("next", 0.1, 300, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	ck.ReceiveOrder(&next)
+	select {
+	case err := <-received:
+		if err != nil || next.GetState() != interfaces.DELIVERED_ORDER_STATE {
+			t.Errorf("expected the driver to deliver the next order, got %v and %s", err, next.GetState())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the request wasn't answered once the driver was handed an order")
+	}
+}
+
+func TestTravelTimeDistribution_Success_DrawsWithinBounds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "traveltime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "observed.json")
+	ioutil.WriteFile(path, []byte(`{ "type": "empirical", "min": 2, "max": 6, "histogram": [{ "ticks": 1, "count": 1 }, { "ticks": 4, "count": 3 }, { "ticks": 9, "count": 1 }] }`), 0644)
+	empirical, err := interfaces.LoadTravelTimeDistribution(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	distributions := []interfaces.TravelTimeDistribution{
+		interfaces.CreateUniformTravelTime(2, 8),
+		{Type: interfaces.NORMAL_TRAVEL_TIME, Min: 2, Max: 8, Mean: 5, StdDev: 3},
+		{Type: interfaces.LOG_NORMAL_TRAVEL_TIME, Min: 2, Max: 8, Mu: 1.5, Sigma: 1},
+		{Type: interfaces.EXPONENTIAL_TRAVEL_TIME, Min: 2, Max: 8, Mean: 4},
+		// observations outside of min and max are clamped to them
+		*empirical,
+	}
+	for _, distribution := range distributions {
+		random := interfaces.CreateLockedRand(1)
+		drawn := map[int]int{}
+		for i := 0; i < 10000; i++ {
+			ticks := distribution.Draw(random)
+			if ticks < distribution.Min || ticks > distribution.Max {
+				t.Fatalf("%s drew %d ticks, outside of [%d, %d]", distribution.Type, ticks, distribution.Min, distribution.Max)
+			}
+			drawn[ticks]++
+		}
+
+		if drawn[distribution.Min] == 0 || drawn[distribution.Max] == 0 {
+			t.Errorf("expected %s to draw both its min and max, got %v", distribution.Type, drawn)
+		}
+		if distribution.Type == interfaces.EMPIRICAL_TRAVEL_TIME && (len(drawn) != 3 || drawn[4] < drawn[2]*2) {
+			t.Errorf("expected the empirical draws to follow the histogram, got %v", drawn)
+		}
+	}
+
+	// drivers draw from the delays they are configured with, which are never exceeded
+	simulationConfig := interfaces.CreateSimulationConfig(2, 3, interfaces.DEFAULT_SLEEP_TIME)
+	simulationConfig.Clock = interfaces.CreateFakeClock(time.Time{})
+	ck := interfaces.CreateDarkKitchen(simulationConfig)
+	for i := 0; i < 20; i++ {
+		order := interfaces.CreateFoodOrder(fmt.Sprintf("order-%d", i), 0.1, 300, interfaces.COLD_TEMPERATURE_LABEL, ck)
+		ck.ReceiveOrder(&order)
+		if ticks := order.GetExpectedPickupTime().Sub(time.Time{}) / interfaces.DEFAULT_SLEEP_TIME; ticks < 2 || ticks > 3 {
+			t.Errorf("expected the driver to take 2 to 3 ticks, got %d", ticks)
+		}
+	}
+
+	// and from the distribution when there is one
+	simulationConfig = interfaces.CreateSimulationConfig(2, 3, interfaces.DEFAULT_SLEEP_TIME)
+	simulationConfig.Clock = interfaces.CreateFakeClock(time.Time{})
+	simulationConfig.TravelTime = &interfaces.TravelTimeDistribution{Type: interfaces.NORMAL_TRAVEL_TIME, Min: 10, Max: 10, Mean: 5}
+	ck = interfaces.CreateDarkKitchen(simulationConfig)
+	order := interfaces.CreateFoodOrder("order-name", 0.1, 300, interfaces.COLD_TEMPERATURE_LABEL, ck)
+	ck.ReceiveOrder(&order)
+	expectedPickupAt := time.Time{}.Add(10 * interfaces.DEFAULT_SLEEP_TIME)
+	if pickupAt := order.GetExpectedPickupTime(); pickupAt != expectedPickupAt {
+		t.Errorf("expected the driver to take 10 ticks, got %v", pickupAt)
+	}
+}
+
+func TestTravelTimeDistribution_Failure_InvalidSpecs(t *testing.T) {
+	distributions := []interfaces.TravelTimeDistribution{
+		{Min: 0, Max: 5},
+		{Min: 5, Max: 2},
+		{Type: "gamma", Min: 1, Max: 5},
+		{Type: interfaces.NORMAL_TRAVEL_TIME, Min: 1, Max: 5, StdDev: -1},
+		{Type: interfaces.LOG_NORMAL_TRAVEL_TIME, Min: 1, Max: 5, Sigma: -1},
+		{Type: interfaces.EXPONENTIAL_TRAVEL_TIME, Min: 1, Max: 5},
+		{Type: interfaces.EMPIRICAL_TRAVEL_TIME, Min: 1, Max: 5},
+		{Type: interfaces.EMPIRICAL_TRAVEL_TIME, Min: 1, Max: 5, Histogram: []interfaces.TravelTimeBucket{{Ticks: 3, Count: -1}}},
+	}
+
+	for _, distribution := range distributions {
+		if err := distribution.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", distribution)
+		}
+	}
+}
+
 // Test BaseOrderHandler related functionality
 func TestBaseOrderHandlerHandleOrder_Failure_NilNextOrderHandler(t *testing.T) {
 	simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
@@ -215,6 +2467,17 @@ func TestDispatcherHandleOrder_Failure_NilNextOrderHandler(t *testing.T) {
 }
 
 // Test ShelfSet related functionality
+
+// createCookedOrder creates an order that has been through the kitchen and on to
+// the Dispatcher, since orders handed straight to the shelves have to be taken on first
+func createCookedOrder(name string, decayRate float32, shelfLife float32, temperature string, ck *interfaces.DarkKitchen) *interfaces.FoodOrder {
+	newOrder := interfaces.CreateFoodOrder(name, decayRate, shelfLife, temperature, ck)
+	newOrder.TransitionTo(interfaces.COOKING_ORDER_STATE)
+	newOrder.TransitionTo(interfaces.DISPATCHING_ORDER_STATE)
+
+	return &newOrder
+}
+
 func TestShelfSetGetState_Success(t *testing.T) {
 	simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
 	ck := interfaces.CreateDarkKitchen(simulationConfig)
@@ -248,6 +2511,387 @@ func TestShelfSetGetState_Success(t *testing.T) {
 	}
 }
 
+func TestShelfSetAddOrderToShelf_Success_ConfiguredLayout(t *testing.T) {
+	simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+	simulationConfig.Engine = interfaces.EVENT_ENGINE_LABEL
+	simulationConfig.Shelves = []interfaces.ShelfConfig{
+		{Label: "hot-a", Capacity: 2, Temperatures: []string{interfaces.HOT_TEMPERATURE_LABEL}, DecayMultiplier: 1},
+		{Label: "hot-b", Capacity: 1, Temperatures: []string{interfaces.HOT_TEMPERATURE_LABEL}, DecayMultiplier: 1},
+		{Label: "ambient", Capacity: 2, Temperatures: []string{"ambient"}, DecayMultiplier: 0.5},
+		{Label: "big-overflow", Capacity: 40, DecayMultiplier: 3, Overflow: true},
+	}
+	// a layout doesn't need a shelf for every temperature, or a single overflow shelf
+	for _, layout := range [][]interfaces.ShelfConfig{
+		simulationConfig.Shelves,
+		{{Label: "ambient", Capacity: 1, Temperatures: []string{"ambient"}}},
+		{{Label: "ambient", Capacity: 1, Temperatures: []string{"ambient"}}, {Label: "overflow-a", Capacity: 1, Overflow: true}, {Label: "overflow-b", Capacity: 1, Overflow: true}},
+	} {
+		if err := interfaces.ValidateShelfConfigs(layout); err != nil {
+			t.Errorf("layout %v should be valid: %v", layout, err)
+		}
+	}
+	ck := interfaces.CreateDarkKitchen(simulationConfig)
+	shelfSet := ck.CarrierFacility.(*interfaces.ShelfSet)
+
+	hotOrders := []*interfaces.FoodOrder{}
+	for i := 0; i < 4; i++ {
+		newOrder := createCookedOrder("hot-order", 0.2, 100, interfaces.HOT_TEMPERATURE_LABEL, ck)
+		if err := shelfSet.AddOrderToShelf(newOrder); err != nil {
+			t.Fatal(err)
+		}
+		hotOrders = append(hotOrders, newOrder)
+	}
+
+	ambientOrder := createCookedOrder("ambient-order", 0.2, 100, "ambient", ck)
+	if err := shelfSet.AddOrderToShelf(ambientOrder); err != nil {
+		t.Fatal(err)
+	}
+
+	frozenOrder := createCookedOrder("frozen-order", 0.2, 100, interfaces.FROZEN_TEMPERATURE_LABEL, ck)
+	if err := shelfSet.AddOrderToShelf(frozenOrder); err == nil || err.Error() != fmt.Sprintf(interfaces.ShelfWithLabelNotFoundErr, interfaces.FROZEN_TEMPERATURE_LABEL) {
+		t.Errorf("Order was accepted without a shelf for its temperature, got %v", err)
+	}
+
+	state := shelfSet.GetState().(map[string]interface{})
+	expectedCounts := map[string]int{"hot-a": 2, "hot-b": 1, "ambient": 1, "big-overflow": 1}
+	for label, count := range expectedCounts {
+		shelfJSON, _ := json.Marshal(state[label])
+		shelf := []interface{}{}
+		json.Unmarshal(shelfJSON, &shelf)
+		if len(shelf) != count {
+			t.Errorf("expected %d orders on shelf %s, got %d", count, label, len(shelf))
+		}
+	}
+
+	// decay rates come from the multiplier of the shelf each order sits on
+	if rate := hotOrders[0].GetCurrentDecayRate(); rate != 0.2 {
+		t.Errorf("hot order decays at %v", rate)
+	}
+
+	if rate := hotOrders[3].GetCurrentDecayRate(); rate != 0.6 {
+		t.Errorf("overflow order decays at %v", rate)
+	}
+
+	if rate := ambientOrder.GetCurrentDecayRate(); rate != 0.1 {
+		t.Errorf("ambient order decays at %v", rate)
+	}
+}
+
+// Run with -race. Orders are added, picked up and decay
+// off of the shelves at the same time
+func TestShelfSetHandleOrder_Success_ConcurrentAddPickupAndDecay(t *testing.T) {
+	policyLabels := []string{
+		interfaces.HIGHEST_HEALTH_TO_OVERFLOW_POLICY_LABEL,
+		interfaces.EARLIEST_PICKUP_FIRST_POLICY_LABEL,
+		interfaces.LOWEST_VALUE_AT_RISK_FIRST_POLICY_LABEL,
+		interfaces.REJECT_NEWEST_POLICY_LABEL,
+	}
+	temperatures := []string{interfaces.HOT_TEMPERATURE_LABEL, interfaces.COLD_TEMPERATURE_LABEL, interfaces.FROZEN_TEMPERATURE_LABEL}
+
+	for _, policyLabel := range policyLabels {
+		t.Run(policyLabel, func(t *testing.T) {
+			placementPolicy, err := interfaces.CreatePlacementPolicy(policyLabel)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, time.Millisecond)
+			simulationConfig.PlacementPolicy = placementPolicy
+			ck := interfaces.CreateDarkKitchen(simulationConfig)
+			shelfSet := ck.CarrierFacility.(*interfaces.ShelfSet)
+
+			adders, ordersPerAdder := 4, 100
+			placedOrders := make(chan interfaces.Order, adders*ordersPerAdder)
+			var addWG sync.WaitGroup
+			for a := 0; a < adders; a++ {
+				addWG.Add(1)
+				go func(a int) {
+					defer addWG.Done()
+					for i := 0; i < ordersPerAdder; i++ {
+						// every third order decays within a couple of ticks
+						shelfLife := float32(1000)
+						if i%3 == 0 {
+							shelfLife = 3
+						}
+
+						newOrder := createCookedOrder(fmt.Sprintf("order-%d-%d", a, i), 0.5, shelfLife, temperatures[i%len(temperatures)], ck)
+						if shelfSet.HandleOrder(newOrder) == nil {
+							placedOrders <- newOrder
+						}
+					}
+				}(a)
+			}
+
+			done := make(chan bool)
+			go func() {
+				for {
+					select {
+					case <-done:
+						return
+					default:
+						shelfSet.GetState()
+					}
+				}
+			}()
+
+			var pickedUp int32
+			var pickWG sync.WaitGroup
+			for p := 0; p < 4; p++ {
+				pickWG.Add(1)
+				go func() {
+					defer pickWG.Done()
+					for order := range placedOrders {
+						if _, err := shelfSet.GiveOrder(order.GetID()); err == nil {
+							atomic.AddInt32(&pickedUp, 1)
+						}
+					}
+				}()
+			}
+
+			addWG.Wait()
+			close(placedOrders)
+			pickWG.Wait()
+			close(done)
+			ck.WG.Wait()
+			shelfSet.Sync()
+
+			// every order was either picked up, decayed or had no space
+			state := shelfSet.GetState().(map[string]interface{})
+			wastedDecay := state[interfaces.SHELFSET_WASTED_ORDERS_DECAY_LABEL].(int)
+			wastedNoSpace := state[interfaces.SHELFSET_WASTED_ORDERS_NOSPACE_LABEL].(int)
+			if total := int(pickedUp) + wastedDecay + wastedNoSpace; total != adders*ordersPerAdder {
+				t.Errorf("%d picked up, %d decayed and %d had no space, expected %d orders in total", pickedUp, wastedDecay, wastedNoSpace, adders*ordersPerAdder)
+			}
+
+			for _, label := range []string{interfaces.HOT_TEMPERATURE_LABEL, interfaces.COLD_TEMPERATURE_LABEL, interfaces.FROZEN_TEMPERATURE_LABEL, interfaces.OVERFLOW_LABEL} {
+				if left := reflect.ValueOf(state[label]).Len(); left != 0 {
+					t.Errorf("%d orders left on the %s shelf", left, label)
+				}
+			}
+		})
+	}
+}
+
+// Test PlacementPolicy related functionality
+func createPolicyShelfSet(t *testing.T, policyLabel string) (*interfaces.DarkKitchen, *interfaces.ShelfSet) {
+	placementPolicy, err := interfaces.CreatePlacementPolicy(policyLabel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+	simulationConfig.Engine = interfaces.EVENT_ENGINE_LABEL
+	simulationConfig.PlacementPolicy = placementPolicy
+	simulationConfig.Shelves = []interfaces.ShelfConfig{
+		{Label: interfaces.HOT_TEMPERATURE_LABEL, Capacity: 1, Temperatures: []string{interfaces.HOT_TEMPERATURE_LABEL}, DecayMultiplier: 1},
+		{Label: interfaces.OVERFLOW_LABEL, Capacity: 1, DecayMultiplier: interfaces.OVERFLOW_PREMIUM, Overflow: true},
+	}
+	ck := interfaces.CreateDarkKitchen(simulationConfig)
+
+	return ck, ck.CarrierFacility.(*interfaces.ShelfSet)
+}
+
+// shelfOrderNames returns the names of the orders on each shelf
+func shelfOrderNames(t *testing.T, shelfSet *interfaces.ShelfSet) map[string][]string {
+	jsonState, err := json.Marshal(shelfSet.GetState())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := map[string]json.RawMessage{}
+	json.Unmarshal(jsonState, &state)
+
+	names := map[string][]string{}
+	for _, label := range []string{interfaces.HOT_TEMPERATURE_LABEL, interfaces.OVERFLOW_LABEL} {
+		orders := []struct {
+			Name string `json:"name"`
+		}{}
+		json.Unmarshal(state[label], &orders)
+		names[label] = []string{}
+		for _, order := range orders {
+			names[label] = append(names[label], order.Name)
+		}
+	}
+
+	return names
+}
+
+func TestPlacementPolicy_Success_ChoosesOverflowAndEvictions(t *testing.T) {
+	type orderSpec struct {
+		name      string
+		shelfLife float32
+		decayRate float32
+	}
+
+	tests := []struct {
+		policyLabel      string
+		orders           []orderSpec
+		expectedShelves  map[string][]string
+		expectedRejected int
+	}{
+		{
+			// the order with the highest health goes to overflow, and
+			// nothing is thrown away to make room for a new order
+			policyLabel: interfaces.HIGHEST_HEALTH_TO_OVERFLOW_POLICY_LABEL,
+			orders:      []orderSpec{{"fresh", 100, 0.1}, {"stale", 50, 0.1}, {"late", 80, 0.1}},
+			expectedShelves: map[string][]string{
+				interfaces.HOT_TEMPERATURE_LABEL: {"stale"},
+				interfaces.OVERFLOW_LABEL:        {"fresh"},
+			},
+			expectedRejected: 1,
+		},
+		{
+			policyLabel: interfaces.REJECT_NEWEST_POLICY_LABEL,
+			orders:      []orderSpec{{"fresh", 100, 0.1}, {"stale", 50, 0.1}, {"late", 80, 0.1}},
+			expectedShelves: map[string][]string{
+				interfaces.HOT_TEMPERATURE_LABEL: {"fresh"},
+				interfaces.OVERFLOW_LABEL:        {"stale"},
+			},
+			expectedRejected: 1,
+		},
+		{
+			// the slow decaying order has the least to lose, so it goes to
+			// overflow and is then thrown away to make room for the third order
+			policyLabel: interfaces.LOWEST_VALUE_AT_RISK_FIRST_POLICY_LABEL,
+			orders:      []orderSpec{{"slow", 100, 0.1}, {"fast", 100, 0.9}, {"medium", 100, 0.5}},
+			expectedShelves: map[string][]string{
+				interfaces.HOT_TEMPERATURE_LABEL: {"fast"},
+				interfaces.OVERFLOW_LABEL:        {"medium"},
+			},
+			expectedRejected: 1,
+		},
+	}
+
+	for _, test := range tests {
+		ck, shelfSet := createPolicyShelfSet(t, test.policyLabel)
+
+		for _, spec := range test.orders {
+			newOrder := createCookedOrder(spec.name, spec.decayRate, spec.shelfLife, interfaces.HOT_TEMPERATURE_LABEL, ck)
+			shelfSet.HandleOrder(newOrder)
+		}
+
+		if names := shelfOrderNames(t, shelfSet); !reflect.DeepEqual(names, test.expectedShelves) {
+			t.Errorf("%s: expected shelves %v, got %v", test.policyLabel, test.expectedShelves, names)
+		}
+
+		state := shelfSet.GetState().(map[string]interface{})
+		if state[interfaces.SHELFSET_WASTED_ORDERS_NOSPACE_LABEL] != test.expectedRejected {
+			t.Errorf("%s: expected %d wasted orders, got %v", test.policyLabel, test.expectedRejected, state[interfaces.SHELFSET_WASTED_ORDERS_NOSPACE_LABEL])
+		}
+	}
+}
+
+func TestEarliestPickupFirstPolicy_Success_EstimatesPickupForNewOrders(t *testing.T) {
+	ck, shelfSet := createPolicyShelfSet(t, interfaces.EARLIEST_PICKUP_FIRST_POLICY_LABEL)
+
+	first := createCookedOrder("first", 0.1, 300, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	first.SetExpectedPickupTime(time.Now().Add(24 * time.Hour))
+	shelfSet.HandleOrder(first)
+	soon := createCookedOrder("soon", 0.1, 300, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	shelfSet.HandleOrder(soon)
+
+	// the first order's driver is a day away, while a driver sent for the new
+	// order would be there within a few ticks, so the first order goes to overflow
+	expectedShelves := map[string][]string{
+		interfaces.HOT_TEMPERATURE_LABEL: {"soon"},
+		interfaces.OVERFLOW_LABEL:        {"first"},
+	}
+	if names := shelfOrderNames(t, shelfSet); !reflect.DeepEqual(names, expectedShelves) {
+		t.Errorf("expected shelves %v, got %v", expectedShelves, names)
+	}
+}
+
+func TestEarliestPickupFirstPolicy_Success_KeepsOrdersWithDriversDueSoonest(t *testing.T) {
+	simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
+	simulationConfig.Engine = interfaces.EVENT_ENGINE_LABEL
+	simulationConfig.PlacementPolicy = interfaces.EarliestPickupFirstPolicy{}
+	simulationConfig.Shelves = []interfaces.ShelfConfig{
+		{Label: interfaces.HOT_TEMPERATURE_LABEL, Capacity: 1, Temperatures: []string{interfaces.HOT_TEMPERATURE_LABEL}, DecayMultiplier: 1},
+		{Label: interfaces.OVERFLOW_LABEL, Capacity: 1, DecayMultiplier: interfaces.OVERFLOW_PREMIUM, Overflow: true},
+	}
+	// every driver takes 5 ticks, and there's only one of them
+	travelTime := interfaces.CreateUniformTravelTime(5, 5)
+	simulationConfig.TravelTime = &travelTime
+	simulationConfig.FleetSize = 1
+	ck := interfaces.CreateDarkKitchen(simulationConfig)
+	shelfSet := ck.CarrierFacility.(*interfaces.ShelfSet)
+	engine := ck.Engine.(*interfaces.EventEngine)
+
+	orders := map[string]*interfaces.FoodOrder{}
+	for tick, name := range []string{"first", "queued", "last"} {
+		order := interfaces.CreateFoodOrder(name, 0.1, 300, interfaces.HOT_TEMPERATURE_LABEL, ck)
+		orders[name] = &order
+		engine.ScheduleOrder(&order, tick+1)
+	}
+	engine.RunUntil(3)
+
+	// the first order's driver is due before the second order's driver could
+	// get there, so the second order goes to overflow. It's then still waiting for
+	// the only driver, so it's thrown away to make room for the last order
+	expectedShelves := map[string][]string{
+		interfaces.HOT_TEMPERATURE_LABEL: {"first"},
+		interfaces.OVERFLOW_LABEL:        {"last"},
+	}
+	if names := shelfOrderNames(t, shelfSet); !reflect.DeepEqual(names, expectedShelves) {
+		t.Errorf("expected shelves %v, got %v", expectedShelves, names)
+	}
+	if state := orders["queued"].GetState(); state != interfaces.REJECTED_NO_SPACE_ORDER_STATE {
+		t.Errorf("expected the queued order to be thrown away, got %s", state)
+	}
+}
+
+func TestPlacementPolicy_Success_ChoosesOrderFromOverflow(t *testing.T) {
+	ck, shelfSet := createPolicyShelfSet(t, interfaces.EARLIEST_PICKUP_FIRST_POLICY_LABEL)
+
+	first := createCookedOrder("first", 0.1, 100, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	first.SetExpectedPickupTime(time.Time{}.Add(time.Second))
+	second := createCookedOrder("second", 0.1, 100, interfaces.HOT_TEMPERATURE_LABEL, ck)
+	second.SetExpectedPickupTime(time.Time{}.Add(time.Minute))
+	shelfSet.HandleOrder(first)
+	shelfSet.HandleOrder(second)
+
+	if _, err := shelfSet.GiveOrder(first.GetID()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the overflow order comes back to the freed space at its normal decay rate
+	names := shelfOrderNames(t, shelfSet)
+	if !reflect.DeepEqual(names[interfaces.HOT_TEMPERATURE_LABEL], []string{"second"}) || len(names[interfaces.OVERFLOW_LABEL]) != 0 {
+		t.Errorf("overflow order was not moved back, got %v", names)
+	}
+
+	if second.GetCurrentDecayRate() != second.GetOriginalDecayRate() {
+		t.Error("order moved back from overflow still decays at the overflow rate")
+	}
+}
+
+func TestCreatePlacementPolicy_Failure_UnknownLabel(t *testing.T) {
+	if _, err := interfaces.CreatePlacementPolicy("no-such-policy"); err == nil {
+		t.Error("unknown placement policy was created")
+	}
+}
+
+func TestValidateShelfConfigs_Failure_InvalidLayouts(t *testing.T) {
+	invalidLayouts := map[string][]interfaces.ShelfConfig{
+		"no shelves":         {},
+		"duplicate label":    {{Label: "hot", Capacity: 1, Temperatures: []string{"hot"}}, {Label: "hot", Capacity: 1, Temperatures: []string{"hot"}}},
+		"zero capacity":      {{Label: "hot", Capacity: 0, Temperatures: []string{"hot"}}},
+		"negative decay":     {{Label: "hot", Capacity: 1, Temperatures: []string{"hot"}, DecayMultiplier: -1}},
+		"no temperatures":    {{Label: "hot", Capacity: 1}},
+		"missing shelf name": {{Capacity: 1, Temperatures: []string{"hot"}}},
+	}
+
+	for name, layout := range invalidLayouts {
+		if err := interfaces.ValidateShelfConfigs(layout); err == nil {
+			t.Errorf("%s: layout should be invalid", name)
+		}
+	}
+
+	if err := interfaces.ValidateShelfConfigs(interfaces.CreateDefaultShelfConfigs()); err != nil {
+		t.Error(err)
+	}
+}
+
 // Test Interfaces
 type TestCarrierFacility struct {
 	interfaces.CarrierFacility
@@ -261,3 +2905,27 @@ func (t TestCarrierFacility) GiveOrder(orderID string) (interfaces.Order, error)
 	invalidOrder := interfaces.CreateFoodOrder("somename", 0.1, 10, interfaces.HOT_TEMPERATURE_LABEL, ck)
 	return &invalidOrder, nil
 }
+
+func (t TestCarrierFacility) GetOrders() []interfaces.ShelfOrder {
+	return nil
+}
+
+func (t TestCarrierFacility) GiveOrders(orderIDs []string) ([]interfaces.Order, []string, error) {
+	order, err := t.GiveOrder(orderIDs[0])
+	return []interfaces.Order{order}, nil, err
+}
+
+// TestCourierProvider hands out a courier for every Order without calling a partner
+type TestCourierProvider struct{}
+
+func (t TestCourierProvider) RequestCourier(order interfaces.Order) (interfaces.CourierStatus, error) {
+	return interfaces.CourierStatus{CourierID: "courier-" + order.GetName()}, nil
+}
+
+func (t TestCourierProvider) TrackCourier(orderID string) (interfaces.CourierStatus, error) {
+	return interfaces.CourierStatus{}, fmt.Errorf("not tracked")
+}
+
+func (t TestCourierProvider) CancelCourier(orderID string) error {
+	return nil
+}
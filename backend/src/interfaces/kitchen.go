@@ -1,8 +1,8 @@
 package interfaces
 
-// Kitchen implements OrderHandler by subclassing BaseOrderHandler. Although
-// there isn't anything custom in this implementation, we may want to implement methods
-// like CookOrder and other Kitchen related functions that don't exist at the moment.
+// Kitchen implements OrderHandler by subclassing BaseOrderHandler. For now it
+// only marks the Order as cooking before passing it on, but we may want to implement
+// methods like CookOrder and other Kitchen related functions that don't exist at the moment.
 type Kitchen struct {
 	BaseOrderHandler
 }
@@ -10,3 +10,12 @@ type Kitchen struct {
 func CreateKitchen() *Kitchen {
 	return &Kitchen{}
 }
+
+func (k *Kitchen) HandleOrder(order Order) error {
+	err := order.TransitionTo(COOKING_ORDER_STATE)
+	if err != nil {
+		return err
+	}
+
+	return k.BaseOrderHandler.HandleOrder(order)
+}
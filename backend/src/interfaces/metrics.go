@@ -0,0 +1,182 @@
+package interfaces
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics are the Prometheus metrics the ShelfSet and Drivers report to. Every
+// DarkKitchen created from a SimulationConfig with the same Metrics adds to
+// them, so they cover every simulation the backend is running. A nil *Metrics
+// is fine to report to and throws everything away
+type Metrics struct {
+	shelfOrders           *prometheus.GaugeVec
+	ordersReceived        prometheus.Counter
+	ordersPlaced          *prometheus.CounterVec
+	ordersMovedToOverflow prometheus.Counter
+	ordersRescued         prometheus.Counter
+	ordersPickedUp        prometheus.Counter
+	ordersWasted          *prometheus.CounterVec
+	driverWait            prometheus.Histogram
+	healthAtPickup        prometheus.Histogram
+	timeOnShelf           *prometheus.HistogramVec
+	foodWait              *prometheus.HistogramVec
+	pickupWait            *prometheus.HistogramVec
+}
+
+// CreateMetrics creates the metrics and registers them with registerer
+func CreateMetrics(registerer prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		shelfOrders: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "shelf_orders",
+			Help:      "Number of orders sitting on each shelf.",
+		}, []string{SHELF_METRIC_LABEL}),
+		ordersReceived: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "orders_received_total",
+			Help:      "Orders received by the kitchen.",
+		}),
+		ordersPlaced: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "orders_placed_total",
+			Help:      "Orders placed on the shelves as they came out of the kitchen, by the shelf they were placed on.",
+		}, []string{SHELF_METRIC_LABEL}),
+		ordersMovedToOverflow: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "orders_moved_to_overflow_total",
+			Help:      "Orders moved from a temperature shelf to overflow to make room.",
+		}),
+		ordersRescued: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "orders_rescued_from_overflow_total",
+			Help:      "Orders moved from overflow back to a temperature shelf.",
+		}),
+		ordersPickedUp: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "orders_picked_up_total",
+			Help:      "Orders picked up by a driver.",
+		}),
+		ordersWasted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "orders_wasted_total",
+			Help:      "Orders thrown away, by whether they decayed or there was no space for them.",
+		}, []string{REASON_METRIC_LABEL}),
+		driverWait: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "driver_wait_seconds",
+			Help:      "Time from a driver being dispatched for an order to them arriving to pick it up.",
+			Buckets:   prometheus.LinearBuckets(1, 1, 15),
+		}),
+		healthAtPickup: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "order_health_at_pickup",
+			Help:      "Health of orders as they are picked up, as a fraction of their shelf life.",
+			Buckets:   prometheus.LinearBuckets(0.1, 0.1, 10),
+		}),
+		timeOnShelf: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "order_shelf_seconds",
+			Help:      "Time an order spent in a single space on a shelf before it was moved or left the shelves.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+		}, []string{SHELF_METRIC_LABEL}),
+		foodWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "food_wait_seconds",
+			Help:      "Time from an order being ready on the shelves to it being picked up, by dispatch strategy.",
+			Buckets:   prometheus.LinearBuckets(1, 1, 15),
+		}, []string{STRATEGY_METRIC_LABEL}),
+		pickupWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "driver_pickup_wait_seconds",
+			Help:      "Time from a driver arriving at the kitchen to them leaving with their orders, by dispatch strategy.",
+			Buckets:   prometheus.LinearBuckets(1, 1, 15),
+		}, []string{STRATEGY_METRIC_LABEL}),
+	}
+
+	collectors := []prometheus.Collector{
+		m.shelfOrders, m.ordersReceived, m.ordersPlaced, m.ordersMovedToOverflow, m.ordersRescued,
+		m.ordersPickedUp, m.ordersWasted, m.driverWait, m.healthAtPickup, m.timeOnShelf, m.foodWait, m.pickupWait,
+	}
+	for _, collector := range collectors {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func (m *Metrics) orderReceived() {
+	if m != nil {
+		m.ordersReceived.Inc()
+	}
+}
+
+func (m *Metrics) orderPlaced(shelf string) {
+	if m != nil {
+		m.ordersPlaced.WithLabelValues(shelf).Inc()
+	}
+}
+
+// orderMoved counts an Order moving to or from overflow
+func (m *Metrics) orderMoved(toOverflow bool) {
+	if m == nil {
+		return
+	}
+
+	if toOverflow {
+		m.ordersMovedToOverflow.Inc()
+	} else {
+		m.ordersRescued.Inc()
+	}
+}
+
+func (m *Metrics) orderPickedUp(snapshot OrderSnapshot) {
+	if m != nil {
+		m.ordersPickedUp.Inc()
+		m.healthAtPickup.Observe(float64(snapshot.NormalizedHealth()))
+	}
+}
+
+func (m *Metrics) orderWasted(reason string) {
+	if m != nil {
+		m.ordersWasted.WithLabelValues(reason).Inc()
+	}
+}
+
+// shelfEntered counts an Order taking up a space on the shelf
+func (m *Metrics) shelfEntered(shelf string) {
+	if m != nil {
+		m.shelfOrders.WithLabelValues(shelf).Inc()
+	}
+}
+
+// shelfLeft frees up the space the Order had on the shelf and
+// records how long it was there for
+func (m *Metrics) shelfLeft(shelf string, onShelf time.Duration) {
+	if m != nil {
+		m.shelfOrders.WithLabelValues(shelf).Dec()
+		m.timeOnShelf.WithLabelValues(shelf).Observe(onShelf.Seconds())
+	}
+}
+
+func (m *Metrics) driverArrived(waited time.Duration) {
+	if m != nil {
+		m.driverWait.Observe(waited.Seconds())
+	}
+}
+
+// pickedUp records how long the Orders a driver left with were
+// ready for, and how long the driver waited for them
+func (m *Metrics) pickedUp(strategy string, foodWaits []time.Duration, driverWait time.Duration) {
+	if m == nil {
+		return
+	}
+
+	for _, foodWait := range foodWaits {
+		m.foodWait.WithLabelValues(strategy).Observe(foodWait.Seconds())
+	}
+	m.pickupWait.WithLabelValues(strategy).Observe(driverWait.Seconds())
+}
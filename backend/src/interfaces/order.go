@@ -1,6 +1,8 @@
 package interfaces
 
 import (
+	"fmt"
+	"sync"
 	"time"
 
 	uuid "github.com/satori/go.uuid"
@@ -13,29 +15,58 @@ type FoodOrderInput struct {
 	Temperature string  `json:"temp"`
 }
 
+// OrderSnapshot is the state of an Order at a single point in time
+type OrderSnapshot struct {
+	ID                 string     `json:"id"`
+	Name               string     `json:"name"`
+	Temperature        string     `json:"temp"`
+	ShelfLife          float32    `json:"shelfLife"`
+	OriginalDecayRate  float32    `json:"originalDecayRate"`
+	CurrentDecayRate   float32    `json:"currentDecayRate"`
+	OrderAge           float32    `json:"orderAge"`
+	Health             float32    `json:"health"`
+	PickedUp           bool       `json:"pickedUp"`
+	State              OrderState `json:"state"`
+	ExpectedPickupTime time.Time  `json:"expectedPickupTime"`
+}
+
+// NormalizedHealth is the Order's health as a fraction of its shelf life
+func (o OrderSnapshot) NormalizedHealth() float32 {
+	return o.Health / o.ShelfLife
+}
+
 // FoodOrder implements Order. In this particular case, we are handling food orders, so
 // in the case of custom properties for an order containing food like the decay rate, we want to have a different
 // implementation to distinguish from a different order type.
+// The decay goroutine, the ShelfSet and drivers all touch the same FoodOrder,
+// so everything that can change after it is created is guarded by mu.
 type FoodOrder struct {
 	id                string
 	name              string
-	currentDecayRate  float32
 	originalDecayRate float32
+	shelfLife         float32
+	temperature       string
+	darkKitchen       *DarkKitchen
+
+	mu               sync.RWMutex
+	currentDecayRate float32
 	// health is used for future-proofing the effects that other systems
 	// may have on the food order e.g. weather conditions. although we only are affected
 	// by the decay value function of the shelfset in this case, this may change over time
 	// and we want a way to centralize the total effects on the food order
 	health      float32
-	shelfLife   float32
-	temperature string
 	orderAge    float32
-	pickedUp    bool
-	darkKitchen *DarkKitchen
+	state       OrderState
+	transitions []OrderTransition
+	// when the driver for the order is expected to arrive
+	expectedPickupTime time.Time
 }
 
 func CreateFoodOrder(name string, decayRate float32, shelfLife float32, temperature string, darkKitchen *DarkKitchen) FoodOrder {
 	uniqueID := uuid.NewV4()
 	return FoodOrder{
+		state:             QUEUED_ORDER_STATE,
+		transitions:       []OrderTransition{{State: QUEUED_ORDER_STATE, At: darkKitchen.now()}},
 		id:                uniqueID.String(),
 		name:              name,
 		originalDecayRate: decayRate,
@@ -43,7 +74,22 @@ func CreateFoodOrder(name string, decayRate float32, shelfLife float32, temperat
 		temperature:       temperature,
 		orderAge:          0.0,
 		health:            shelfLife,
-		pickedUp:          false,
+		darkKitchen:       darkKitchen,
+	}
+}
+
+// restoreFoodOrder recreates an Order that was received before the
+// DarkKitchen was recovered from an EventLog, as it was when it was received
+func restoreFoodOrder(snapshot OrderSnapshot, receivedAt time.Time, darkKitchen *DarkKitchen) *FoodOrder {
+	return &FoodOrder{
+		state:             QUEUED_ORDER_STATE,
+		transitions:       []OrderTransition{{State: QUEUED_ORDER_STATE, At: receivedAt}},
+		id:                snapshot.ID,
+		name:              snapshot.Name,
+		originalDecayRate: snapshot.OriginalDecayRate,
+		shelfLife:         snapshot.ShelfLife,
+		temperature:       snapshot.Temperature,
+		health:            snapshot.ShelfLife,
 		darkKitchen:       darkKitchen,
 	}
 }
@@ -65,6 +111,9 @@ func (f *FoodOrder) GetOriginalDecayRate() float32 {
 
 // GetOriginalDecayRate
 func (f *FoodOrder) GetCurrentDecayRate() float32 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
 	return f.currentDecayRate
 }
 
@@ -80,33 +129,137 @@ func (f *FoodOrder) GetTemperature() string {
 
 // GetOrderAge
 func (f *FoodOrder) GetOrderAge() float32 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
 	return f.orderAge
 }
 
 // GetHealth
 func (f *FoodOrder) GetHealth() float32 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
 	return f.health
 }
 
-// GetPickedUp
+// GetPickedUp is true once a driver has taken the order off of the shelves
 func (f *FoodOrder) GetPickedUp() bool {
-	return f.pickedUp
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.pickedUp()
+}
+
+func (f *FoodOrder) pickedUp() bool {
+	return f.state == PICKED_UP_ORDER_STATE || f.state == DELIVERED_ORDER_STATE
+}
+
+// GetState
+func (f *FoodOrder) GetState() OrderState {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.state
+}
+
+// GetTransitions
+func (f *FoodOrder) GetTransitions() []OrderTransition {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	transitions := make([]OrderTransition, len(f.transitions))
+	copy(transitions, f.transitions)
+	return transitions
+}
+
+// TransitionTo moves the order along its lifecycle. The time of the
+// transition comes from the DarkKitchen's clock so simulations record ticks
+func (f *FoodOrder) TransitionTo(state OrderState) error {
+	return f.transitionAt(state, f.darkKitchen.now())
+}
+
+// transitionAt is TransitionTo with the time of the transition
+// given, e.g. when it is replayed from an EventLog
+func (f *FoodOrder) transitionAt(state OrderState, at time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !CanTransition(f.state, state) {
+		return fmt.Errorf(InvalidOrderTransitionErr, f.id, f.state, state)
+	}
+
+	f.state = state
+	f.transitions = append(f.transitions, OrderTransition{State: state, At: at})
+	return nil
+}
+
+// GetExpectedPickupTime
+func (f *FoodOrder) GetExpectedPickupTime() time.Time {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.expectedPickupTime
+}
+
+// SetExpectedPickupTime
+func (f *FoodOrder) SetExpectedPickupTime(expectedPickupTime time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.expectedPickupTime = expectedPickupTime
 }
 
 // SetOrderAge
 func (f *FoodOrder) SetOrderAge(newOrderAge float32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
 	f.orderAge = newOrderAge
 }
 
 // SetCurrentDecayRate
 func (f *FoodOrder) SetCurrentDecayRate(newDecayRate float32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
 	f.currentDecayRate = newDecayRate
 }
 
-// SetPickedUp shows the state for whether an order has been picked up.
-// For instance, we stop the Order's Decay process if an order has been picked up
-func (f *FoodOrder) SetPickedUp(pickedUp bool) {
-	f.pickedUp = pickedUp
+// Snapshot reads all of the FoodOrder's state at once, so the values
+// are consistent with each other even while the order is decaying
+func (f *FoodOrder) Snapshot() OrderSnapshot {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return OrderSnapshot{
+		ID:                 f.id,
+		Name:               f.name,
+		Temperature:        f.temperature,
+		ShelfLife:          f.shelfLife,
+		OriginalDecayRate:  f.originalDecayRate,
+		CurrentDecayRate:   f.currentDecayRate,
+		OrderAge:           f.orderAge,
+		Health:             f.health,
+		PickedUp:           f.pickedUp(),
+		State:              f.state,
+		ExpectedPickupTime: f.expectedPickupTime,
+	}
+}
+
+// AgeBy ages the order by the given number of ticks and returns its new health
+func (f *FoodOrder) AgeBy(ticks float32, decayValueFn func(shelfLife float32, orderAge float32, decayRate float32) float32) float32 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.orderAge += ticks
+	// get delta between the current health and decay so we preserve the history of changed decay rates
+	// for instance, if the decay rate was 1 but then became 2 once it went to the overflow shelf, we want
+	// the health to reflect the total sum of how much it was affected when it was at 1 and how much it was affected when it was at 2
+	delta := f.health - decayValueFn(f.shelfLife, f.orderAge, f.currentDecayRate)
+	f.health -= delta
+
+	return f.health
 }
 
 // Decay
@@ -114,20 +267,16 @@ func (f *FoodOrder) Decay(decayNotifications chan Order, decayValueFn func(shelf
 	defer f.darkKitchen.WG.Done()
 
 	for {
-		time.Sleep(f.darkKitchen.simulationConfig.SleepTime)
-		f.SetOrderAge(f.GetOrderAge() + 1)
-		// get delta between the current health and decay so we preserve the history of changed decay rates
-		// for instance, if the decay rate was 1 but then became 2 once it went to the overflow shelf, we want
-		// the health to reflect the total sum of how much it was affected when it was at 1 and how much it was affected when it was at 2
-		delta := f.health - decayValueFn(f.GetShelfLife(), f.GetOrderAge(), f.GetCurrentDecayRate())
-		f.health -= delta
-		if f.health <= 0 {
+		f.darkKitchen.simulationConfig.Clock.Sleep(f.darkKitchen.simulationConfig.SleepTime)
+		if f.AgeBy(1, decayValueFn) <= 0 {
 			// notify the channel that this order has died
 			decayNotifications <- f
 			break
 		}
 
-		if f.GetPickedUp() {
+		// stop once the order has left the shelves
+		// e.g. it was picked up or thrown away for space
+		if !f.GetState().OnShelves() {
 			break
 		}
 	}
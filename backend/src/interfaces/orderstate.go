@@ -0,0 +1,39 @@
+package interfaces
+
+import "time"
+
+// OrderState is where an Order is in its lifecycle
+type OrderState string
+
+// OrderTransition records when an Order moved into a state
+type OrderTransition struct {
+	State OrderState `json:"state"`
+	At    time.Time  `json:"at"`
+}
+
+// the states each OrderState can move to. Orders that are delivered,
+// wasted, rejected or cancelled stay in that state for good
+var validOrderTransitions = map[OrderState][]OrderState{
+	QUEUED_ORDER_STATE:      {COOKING_ORDER_STATE, CANCELLED_ORDER_STATE},
+	COOKING_ORDER_STATE:     {DISPATCHING_ORDER_STATE, CANCELLED_ORDER_STATE},
+	DISPATCHING_ORDER_STATE: {ON_SHELF_ORDER_STATE, IN_OVERFLOW_ORDER_STATE, REJECTED_NO_SPACE_ORDER_STATE, CANCELLED_ORDER_STATE},
+	ON_SHELF_ORDER_STATE:    {IN_OVERFLOW_ORDER_STATE, PICKED_UP_ORDER_STATE, WASTED_DECAY_ORDER_STATE, CANCELLED_ORDER_STATE},
+	IN_OVERFLOW_ORDER_STATE: {ON_SHELF_ORDER_STATE, PICKED_UP_ORDER_STATE, WASTED_DECAY_ORDER_STATE, REJECTED_NO_SPACE_ORDER_STATE, CANCELLED_ORDER_STATE},
+	PICKED_UP_ORDER_STATE:   {DELIVERED_ORDER_STATE},
+}
+
+// CanTransition reports whether an Order can move from one state to the other
+func CanTransition(from OrderState, to OrderState) bool {
+	for _, state := range validOrderTransitions[from] {
+		if state == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// OnShelves reports whether an Order in this state is sitting on the shelves
+func (s OrderState) OnShelves() bool {
+	return s == ON_SHELF_ORDER_STATE || s == IN_OVERFLOW_ORDER_STATE
+}
@@ -0,0 +1,89 @@
+package interfaces
+
+// OrderStatus is what the DarkKitchen reports about an Order it has received
+type OrderStatus struct {
+	OrderSnapshot
+	// the shelf the Order is sitting on, or empty if it isn't on the shelves
+	Shelf       string            `json:"shelf,omitempty"`
+	Transitions []OrderTransition `json:"transitions"`
+	// where the partner's courier is, if the Order has one
+	Courier *CourierStatus `json:"courier,omitempty"`
+}
+
+// OrderFilter picks which Orders are listed. Empty fields match every Order
+type OrderFilter struct {
+	State       OrderState
+	Temperature string
+	Shelf       string
+}
+
+func (f OrderFilter) matches(status OrderStatus) bool {
+	if f.State != "" && f.State != status.State {
+		return false
+	}
+
+	if f.Temperature != "" && f.Temperature != status.Temperature {
+		return false
+	}
+
+	if f.Shelf != "" && f.Shelf != status.Shelf {
+		return false
+	}
+
+	return true
+}
+
+// GetOrderStatus returns the status of the Order with the
+// given ID, as long as the DarkKitchen has received it
+func (ck *DarkKitchen) GetOrderStatus(orderID string) (OrderStatus, error) {
+	order, err := ck.GetOrder(orderID)
+	if err != nil {
+		return OrderStatus{}, err
+	}
+
+	status := ck.orderStatus(order)
+	if ck.Dispatcher != nil {
+		if courier, ok := ck.Dispatcher.TrackCourier(orderID); ok {
+			status.Courier = &courier
+		}
+	}
+
+	return status, nil
+}
+
+// ListOrderStatuses returns the status of every Order that matches
+// the filter, in the order the DarkKitchen received them
+func (ck *DarkKitchen) ListOrderStatuses(filter OrderFilter) []OrderStatus {
+	ck.ordersMu.RLock()
+	orders := make([]Order, 0, len(ck.orderIDs))
+	for _, orderID := range ck.orderIDs {
+		orders = append(orders, ck.orders[orderID])
+	}
+	ck.ordersMu.RUnlock()
+
+	statuses := []OrderStatus{}
+	for _, order := range orders {
+		if status := ck.orderStatus(order); filter.matches(status) {
+			statuses = append(statuses, status)
+		}
+	}
+
+	return statuses
+}
+
+func (ck *DarkKitchen) orderStatus(order Order) OrderStatus {
+	status := OrderStatus{
+		OrderSnapshot: order.Snapshot(),
+		Shelf:         ck.CarrierFacility.GetOrderShelf(order.GetID()),
+		Transitions:   order.GetTransitions(),
+	}
+
+	// listing Orders doesn't check on their couriers with the partner
+	if ck.Dispatcher != nil {
+		if courier, ok := ck.Dispatcher.lastCourierStatus(order.GetID()); ok {
+			status.Courier = &courier
+		}
+	}
+
+	return status
+}
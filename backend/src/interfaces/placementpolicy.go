@@ -0,0 +1,202 @@
+package interfaces
+
+import (
+	"fmt"
+	"time"
+)
+
+// HighestHealthToOverflowPolicy implements PlacementPolicy with the rules
+// described in the README: when an Order's shelves are full, the Order with the
+// highest health (including the incoming Order) goes to the overflow shelf,
+// an Order that doesn't fit on the overflow shelf either is rejected, and the
+// Order with the least life left is the one that comes back from overflow.
+type HighestHealthToOverflowPolicy struct{}
+
+func (p HighestHealthToOverflowPolicy) ChooseForOverflow(incoming Order, candidates []ShelfOrder) *ShelfOrder {
+	var highestHealthOrder *ShelfOrder
+	var highestHealth float32
+	for idx := range candidates {
+		if health := candidates[idx].Snapshot().Health; highestHealthOrder == nil || health > highestHealth {
+			highestHealthOrder = &candidates[idx]
+			highestHealth = health
+		}
+	}
+
+	// if the highestHealthOrder has a health gt the input order,
+	// move that to overflow. otherwise, insert the input order into overflow
+	if highestHealthOrder != nil && highestHealth > incoming.Snapshot().Health {
+		return highestHealthOrder
+	}
+
+	return nil
+}
+
+func (p HighestHealthToOverflowPolicy) ChooseEviction(incoming Order, overflowOrders []ShelfOrder) *ShelfOrder {
+	return nil
+}
+
+func (p HighestHealthToOverflowPolicy) ChooseFromOverflow(candidates []ShelfOrder) *ShelfOrder {
+	return shortestLivingOrder(candidates)
+}
+
+// EarliestPickupFirstPolicy implements PlacementPolicy by keeping the
+// temperature shelves for the Orders that will be picked up soonest. The Order
+// picked up last goes to overflow or is thrown away, and the Order picked up first
+// comes back from overflow. An Order still waiting for a driver is treated as being
+// picked up last. The incoming Order's driver is only sent once it's on the shelves,
+// so the ShelfSet estimates when it will be picked up instead.
+type EarliestPickupFirstPolicy struct{}
+
+func (p EarliestPickupFirstPolicy) ChooseForOverflow(incoming Order, candidates []ShelfOrder) *ShelfOrder {
+	return latestPickupOrder(incoming, candidates)
+}
+
+func (p EarliestPickupFirstPolicy) ChooseEviction(incoming Order, overflowOrders []ShelfOrder) *ShelfOrder {
+	return latestPickupOrder(incoming, overflowOrders)
+}
+
+func (p EarliestPickupFirstPolicy) ChooseFromOverflow(candidates []ShelfOrder) *ShelfOrder {
+	var earliestPickupOrder *ShelfOrder
+	for idx := range candidates {
+		if earliestPickupOrder == nil || pickupTime(candidates[idx]).Before(pickupTime(*earliestPickupOrder)) {
+			earliestPickupOrder = &candidates[idx]
+		}
+	}
+
+	return earliestPickupOrder
+}
+
+// LowestValueAtRiskFirstPolicy implements PlacementPolicy by protecting the Orders
+// that have the most to lose. An Order's value at risk is its normalized health
+// times its decay rate, so fresh Orders that decay quickly are kept on their shelves
+// while Orders that are nearly gone or barely decay go to overflow or are thrown away first.
+type LowestValueAtRiskFirstPolicy struct{}
+
+func (p LowestValueAtRiskFirstPolicy) ChooseForOverflow(incoming Order, candidates []ShelfOrder) *ShelfOrder {
+	return lowestValueAtRiskOrder(incoming, candidates)
+}
+
+func (p LowestValueAtRiskFirstPolicy) ChooseEviction(incoming Order, overflowOrders []ShelfOrder) *ShelfOrder {
+	return lowestValueAtRiskOrder(incoming, overflowOrders)
+}
+
+func (p LowestValueAtRiskFirstPolicy) ChooseFromOverflow(candidates []ShelfOrder) *ShelfOrder {
+	var highestValueAtRiskOrder *ShelfOrder
+	for idx := range candidates {
+		if highestValueAtRiskOrder == nil || valueAtRisk(candidates[idx]) > valueAtRisk(*highestValueAtRiskOrder) {
+			highestValueAtRiskOrder = &candidates[idx]
+		}
+	}
+
+	return highestValueAtRiskOrder
+}
+
+// RejectNewestPolicy implements PlacementPolicy by never moving an Order that is
+// already on a shelf. The incoming Order goes to overflow when its shelves are full and
+// is rejected when overflow is full too. The Order with the least life left comes back from overflow.
+type RejectNewestPolicy struct{}
+
+func (p RejectNewestPolicy) ChooseForOverflow(incoming Order, candidates []ShelfOrder) *ShelfOrder {
+	return nil
+}
+
+func (p RejectNewestPolicy) ChooseEviction(incoming Order, overflowOrders []ShelfOrder) *ShelfOrder {
+	return nil
+}
+
+func (p RejectNewestPolicy) ChooseFromOverflow(candidates []ShelfOrder) *ShelfOrder {
+	return shortestLivingOrder(candidates)
+}
+
+// CreatePlacementPolicy returns the PlacementPolicy with the given label
+func CreatePlacementPolicy(label string) (PlacementPolicy, error) {
+	switch label {
+	case HIGHEST_HEALTH_TO_OVERFLOW_POLICY_LABEL:
+		return HighestHealthToOverflowPolicy{}, nil
+	case EARLIEST_PICKUP_FIRST_POLICY_LABEL:
+		return EarliestPickupFirstPolicy{}, nil
+	case LOWEST_VALUE_AT_RISK_FIRST_POLICY_LABEL:
+		return LowestValueAtRiskFirstPolicy{}, nil
+	case REJECT_NEWEST_POLICY_LABEL:
+		return RejectNewestPolicy{}, nil
+	default:
+		return nil, fmt.Errorf(PlacementPolicyNotFoundErr, label)
+	}
+}
+
+func shortestLivingOrder(candidates []ShelfOrder) *ShelfOrder {
+	var shortestLivingOrder *ShelfOrder
+	var shortestHealth float32
+	for idx := range candidates {
+		if health := candidates[idx].Snapshot().Health; shortestLivingOrder == nil || health < shortestHealth {
+			shortestLivingOrder = &candidates[idx]
+			shortestHealth = health
+		}
+	}
+
+	return shortestLivingOrder
+}
+
+// latestPickupOrder returns the candidate picked up last, or
+// nil if none of them are picked up later than the incoming Order
+func latestPickupOrder(incoming Order, candidates []ShelfOrder) *ShelfOrder {
+	var latestPickupOrder *ShelfOrder
+	latestPickupTime := pickupTime(ShelfOrder{Order: incoming})
+	for idx := range candidates {
+		if candidateTime := pickupTime(candidates[idx]); candidateTime.After(latestPickupTime) {
+			latestPickupOrder = &candidates[idx]
+			latestPickupTime = candidateTime
+		}
+	}
+
+	return latestPickupOrder
+}
+
+// pickupTime is when the Order is expected to be picked up, where
+// Orders without a driver are picked up at the end of time
+func pickupTime(shelfOrder ShelfOrder) time.Time {
+	expectedPickupTime := shelfOrder.Snapshot().ExpectedPickupTime
+	if expectedPickupTime.IsZero() {
+		return time.Unix(1<<62, 0)
+	}
+
+	return expectedPickupTime
+}
+
+// estimatedPickupOrder is an incoming Order that doesn't have a driver yet,
+// with when it's expected to be picked up standing in for its pickup time
+type estimatedPickupOrder struct {
+	Order
+	pickupAt time.Time
+}
+
+func (o estimatedPickupOrder) GetExpectedPickupTime() time.Time {
+	return o.pickupAt
+}
+
+func (o estimatedPickupOrder) Snapshot() OrderSnapshot {
+	snapshot := o.Order.Snapshot()
+	snapshot.ExpectedPickupTime = o.pickupAt
+
+	return snapshot
+}
+
+// lowestValueAtRiskOrder returns the candidate with the lowest value at
+// risk, or nil if none of them are lower than the incoming Order
+func lowestValueAtRiskOrder(incoming Order, candidates []ShelfOrder) *ShelfOrder {
+	var lowestValueAtRiskOrder *ShelfOrder
+	lowestValueAtRisk := valueAtRisk(ShelfOrder{Order: incoming})
+	for idx := range candidates {
+		if candidateValueAtRisk := valueAtRisk(candidates[idx]); candidateValueAtRisk < lowestValueAtRisk {
+			lowestValueAtRiskOrder = &candidates[idx]
+			lowestValueAtRisk = candidateValueAtRisk
+		}
+	}
+
+	return lowestValueAtRiskOrder
+}
+
+func valueAtRisk(shelfOrder ShelfOrder) float32 {
+	snapshot := shelfOrder.Snapshot()
+	return snapshot.NormalizedHealth() * snapshot.OriginalDecayRate
+}
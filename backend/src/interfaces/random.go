@@ -0,0 +1,44 @@
+package interfaces
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// LockedRand wraps a seeded rand.Rand so a single source of random
+// draws can be shared between goroutines. Sharing one source is what
+// makes two runs with the same seed draw the same numbers.
+type LockedRand struct {
+	mu     sync.Mutex
+	random *rand.Rand
+}
+
+func CreateLockedRand(seed int64) *LockedRand {
+	return &LockedRand{
+		random: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Intn returns a number in [0, n)
+func (l *LockedRand) Intn(n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.random.Intn(n)
+}
+
+// ExpFloat64 returns an exponentially distributed number with a rate of 1
+func (l *LockedRand) ExpFloat64() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.random.ExpFloat64()
+}
+
+// NormFloat64 returns a normally distributed number with a mean of 0 and a standard deviation of 1
+func (l *LockedRand) NormFloat64() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.random.NormFloat64()
+}
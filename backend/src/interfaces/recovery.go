@@ -0,0 +1,257 @@
+package interfaces
+
+import (
+	"fmt"
+	"time"
+)
+
+// recovery replays the Events in an EventLog to work
+// out where every Order was when the log ends
+type recovery struct {
+	darkKitchen *DarkKitchen
+	shelfSet    *ShelfSet
+	orders      map[string]*recoveredOrder
+	orderIDs    []string
+	counts      map[string]int
+}
+
+// recoveredOrder is what the EventLog says about one Order
+type recoveredOrder struct {
+	order *FoodOrder
+	// the space the Order is in, while it is on the shelves
+	shelf string
+	slot  int
+	// when the Order was first placed, which is when it started
+	// decaying, and when it left the shelves
+	placed   bool
+	placedAt time.Time
+	leftAt   time.Time
+	// whether a driver has been sent for the Order, and
+	// whether they are still on their way to pick it up
+	dispatched     bool
+	driverOnTheWay bool
+}
+
+// RecoverDarkKitchen rebuilds a DarkKitchen from the Events in the log, as of
+// the last reset in it. Every Order it received is restored with its history,
+// Orders go back in the same shelf spaces, aged by the ticks since they were
+// placed, and start decaying again. Drivers that were on their way are sent
+// again to arrive at the pickup time they were given, and the wasted and
+// cancelled counts pick up where they left off. Orders that hadn't made it to
+// the shelves yet go through the rest of the OrderHandlers.
+//
+// The DarkKitchen publishes to events, or its own EventStream if events is
+// nil, and every Event it publishes is appended to the log
+func RecoverDarkKitchen(simulationConfig *SimulationConfig, events *EventStream, log *EventLog) (*DarkKitchen, error) {
+	darkKitchen := CreateDarkKitchen(simulationConfig)
+	if events != nil {
+		darkKitchen.Events = events
+	}
+
+	shelfSet, ok := darkKitchen.CarrierFacility.(*ShelfSet)
+	if !ok {
+		return nil, fmt.Errorf(CarrierFacilityNotRecoverableErr)
+	}
+
+	r := &recovery{
+		darkKitchen: darkKitchen,
+		shelfSet:    shelfSet,
+		orders:      map[string]*recoveredOrder{},
+		counts:      map[string]int{},
+	}
+
+	logged := log.Events()
+	// a reset starts the simulation over, so only what came after the last one matters
+	start := 0
+	for idx, event := range logged {
+		if event.Type == SIMULATION_RESET_EVENT_TYPE {
+			start = idx + 1
+		}
+	}
+
+	for _, event := range logged[start:] {
+		if err := r.replay(event); err != nil {
+			return nil, fmt.Errorf(EventLogRecoveryErr, event.Seq, err.Error())
+		}
+	}
+
+	if err := r.restoreShelves(); err != nil {
+		return nil, err
+	}
+
+	var lastSeq uint64
+	if len(logged) > 0 {
+		lastSeq = logged[len(logged)-1].Seq
+	}
+	darkKitchen.Events.attachLog(log, lastSeq)
+
+	// anything from here on is new, so it is published and logged
+	r.resume()
+
+	return darkKitchen, nil
+}
+
+// replay applies a single Event to the Orders
+func (r *recovery) replay(event Event) error {
+	if event.Type == ORDER_RECEIVED_EVENT_TYPE {
+		if event.Order == nil {
+			return fmt.Errorf(OrderNotFoundErr, event.OrderID)
+		}
+
+		order := restoreFoodOrder(*event.Order, event.At, r.darkKitchen)
+		// the Kitchen starts cooking an Order as soon as it is received
+		if err := order.transitionAt(COOKING_ORDER_STATE, event.At); err != nil {
+			return err
+		}
+
+		r.orders[order.GetID()] = &recoveredOrder{order: order}
+		r.orderIDs = append(r.orderIDs, order.GetID())
+		return nil
+	}
+
+	recovered, ok := r.orders[event.OrderID]
+	if !ok {
+		return fmt.Errorf(OrderNotFoundErr, event.OrderID)
+	}
+	order := recovered.order
+
+	switch event.Type {
+	case ORDER_DECAYED_EVENT_TYPE, ORDER_REJECTED_NO_SPACE_EVENT_TYPE, ORDER_CANCELLED_EVENT_TYPE, ORDER_PICKED_UP_EVENT_TYPE:
+		if order.GetState().OnShelves() {
+			// the Order is coming off the shelves, and stops decaying here
+			recovered.leftAt = event.At
+		}
+	}
+
+	// the Dispatcher hands Orders straight on to the shelves, so
+	// it took them on when they were placed or found no space
+	if order.GetState() == COOKING_ORDER_STATE && (event.Type == ORDER_PLACED_EVENT_TYPE || event.Type == ORDER_REJECTED_NO_SPACE_EVENT_TYPE) {
+		if err := order.transitionAt(DISPATCHING_ORDER_STATE, event.At); err != nil {
+			return err
+		}
+	}
+
+	switch event.Type {
+	case ORDER_PLACED_EVENT_TYPE:
+		recovered.placed = true
+		recovered.placedAt = event.At
+		return r.moveTo(recovered, event)
+	case ORDER_MOVED_TO_OVERFLOW_EVENT_TYPE, ORDER_RESCUED_FROM_OVERFLOW_EVENT_TYPE:
+		return r.moveTo(recovered, event)
+	case ORDER_DECAYED_EVENT_TYPE:
+		r.counts[SHELFSET_WASTED_ORDERS_DECAY_LABEL]++
+		return order.transitionAt(WASTED_DECAY_ORDER_STATE, event.At)
+	case ORDER_REJECTED_NO_SPACE_EVENT_TYPE:
+		r.counts[SHELFSET_WASTED_ORDERS_NOSPACE_LABEL]++
+		return order.transitionAt(REJECTED_NO_SPACE_ORDER_STATE, event.At)
+	case ORDER_CANCELLED_EVENT_TYPE:
+		r.counts[SHELFSET_CANCELLED_ORDERS_LABEL]++
+		// the driver isn't coming for the Order anymore, even if they
+		// carry on for the rest of their batch without being recalled
+		recovered.driverOnTheWay = false
+		return order.transitionAt(CANCELLED_ORDER_STATE, event.At)
+	case DRIVER_DISPATCHED_EVENT_TYPE:
+		recovered.dispatched = true
+		recovered.driverOnTheWay = true
+		if event.PickupAt != nil {
+			order.SetExpectedPickupTime(*event.PickupAt)
+		}
+	case DRIVER_ARRIVED_EVENT_TYPE, DRIVER_RECALLED_EVENT_TYPE:
+		recovered.driverOnTheWay = false
+	case ORDER_PICKED_UP_EVENT_TYPE:
+		return order.transitionAt(PICKED_UP_ORDER_STATE, event.At)
+	case ORDER_DELIVERED_EVENT_TYPE:
+		return order.transitionAt(DELIVERED_ORDER_STATE, event.At)
+	}
+
+	return nil
+}
+
+// moveTo moves the Order into the shelf space the Event names
+func (r *recovery) moveTo(recovered *recoveredOrder, event Event) error {
+	if event.Slot == nil {
+		return fmt.Errorf(ShelfSpaceNotFreeErr, -1, event.Shelf)
+	}
+
+	recovered.shelf = event.Shelf
+	recovered.slot = *event.Slot
+
+	state := ON_SHELF_ORDER_STATE
+	if r.shelfSet.isOverflow(event.Shelf) {
+		state = IN_OVERFLOW_ORDER_STATE
+	}
+
+	return recovered.order.transitionAt(state, event.At)
+}
+
+// restoreShelves hands every Order to the DarkKitchen and puts
+// the ones that are still on the shelves back where they were
+func (r *recovery) restoreShelves() error {
+	r.darkKitchen.ordersMu.Lock()
+	for _, orderID := range r.orderIDs {
+		r.darkKitchen.orders[orderID] = r.orders[orderID].order
+		r.darkKitchen.orderIDs = append(r.darkKitchen.orderIDs, orderID)
+	}
+	r.darkKitchen.ordersMu.Unlock()
+
+	r.shelfSet.restoreCounts(r.counts)
+
+	now := r.darkKitchen.now()
+	sleepTime := r.darkKitchen.simulationConfig.SleepTime
+	for _, orderID := range r.orderIDs {
+		recovered := r.orders[orderID]
+		if !recovered.placed {
+			// the Order never made it to the shelves, so it never decayed
+			continue
+		}
+
+		if !recovered.order.GetState().OnShelves() {
+			r.shelfSet.restoreAge(recovered.order, recovered.shelf, ticksBetween(recovered.placedAt, recovered.leftAt, sleepTime))
+			continue
+		}
+
+		// Orders kept decaying while the backend was down
+		age := ticksBetween(recovered.placedAt, now, sleepTime)
+		if err := r.shelfSet.restoreOrder(recovered.order, recovered.shelf, recovered.slot, age); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ticksBetween is the number of whole ticks from one time to the other
+func ticksBetween(from time.Time, to time.Time, sleepTime time.Duration) float32 {
+	if ticks := int(to.Sub(from) / sleepTime); ticks > 0 {
+		return float32(ticks)
+	}
+
+	return 0
+}
+
+// resume sends the drivers that were on their way out again, sends drivers for
+// the Orders on the shelves that don't have one yet and finishes handling the
+// Orders that were still on their way to the shelves
+func (r *recovery) resume() {
+	for _, orderID := range r.orderIDs {
+		recovered := r.orders[orderID]
+		order := recovered.order
+
+		switch state := order.GetState(); {
+		case recovered.driverOnTheWay || (state.OnShelves() && recovered.dispatched):
+			// drivers for Orders that have since left the shelves
+			// still turn up, the same as they would have
+			r.darkKitchen.Dispatcher.resumeDriver(order)
+		case state.OnShelves():
+			r.darkKitchen.Dispatcher.dispatchDriver(order)
+		case state == PICKED_UP_ORDER_STATE:
+			// the driver already had the Order in hand
+			if order.TransitionTo(DELIVERED_ORDER_STATE) == nil {
+				r.darkKitchen.publishEvent(Event{Type: ORDER_DELIVERED_EVENT_TYPE, OrderID: orderID})
+			}
+		case state == COOKING_ORDER_STATE:
+			// Orders that can't be placed are recorded as rejected
+			r.darkKitchen.Dispatcher.HandleOrder(order)
+		}
+	}
+}
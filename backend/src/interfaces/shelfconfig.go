@@ -0,0 +1,98 @@
+package interfaces
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// ShelfConfig describes a single shelf in the ShelfSet. A kitchen's
+// layout is the list of its ShelfConfigs e.g.
+// [{ "label": "hot", "capacity": 15, "temperatures": ["hot"], "decayMultiplier": 1 }, ...]
+type ShelfConfig struct {
+	Label    string `json:"label"`
+	Capacity int    `json:"capacity"`
+	// Temperatures are the Order temperatures that can be placed on the shelf.
+	// An overflow shelf with no temperatures accepts every temperature
+	Temperatures []string `json:"temperatures"`
+	// DecayMultiplier is applied to an Order's decay rate while it sits on the shelf
+	DecayMultiplier float32 `json:"decayMultiplier"`
+	// Overflow shelves only take Orders when every shelf for
+	// their temperature is full
+	Overflow bool `json:"overflow"`
+}
+
+// Accepts returns whether an Order with the temperature can be placed on the shelf
+func (c ShelfConfig) Accepts(temperature string) bool {
+	if c.Overflow && len(c.Temperatures) == 0 {
+		return true
+	}
+
+	for _, shelfTemperature := range c.Temperatures {
+		if shelfTemperature == temperature {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CreateDefaultShelfConfigs returns the original layout of the kitchen: a hot, cold
+// and frozen shelf of 15 spaces each, plus an overflow shelf of 20 spaces
+// where Orders decay OVERFLOW_PREMIUM times as fast
+func CreateDefaultShelfConfigs() []ShelfConfig {
+	return []ShelfConfig{
+		{Label: HOT_TEMPERATURE_LABEL, Capacity: DEFAULT_TEMPERATURE_SHELF_SIZE, Temperatures: []string{HOT_TEMPERATURE_LABEL}, DecayMultiplier: 1},
+		{Label: COLD_TEMPERATURE_LABEL, Capacity: DEFAULT_TEMPERATURE_SHELF_SIZE, Temperatures: []string{COLD_TEMPERATURE_LABEL}, DecayMultiplier: 1},
+		{Label: FROZEN_TEMPERATURE_LABEL, Capacity: DEFAULT_TEMPERATURE_SHELF_SIZE, Temperatures: []string{FROZEN_TEMPERATURE_LABEL}, DecayMultiplier: 1},
+		{Label: OVERFLOW_LABEL, Capacity: DEFAULT_OVERFLOW_SHELF_SIZE, DecayMultiplier: OVERFLOW_PREMIUM, Overflow: true},
+	}
+}
+
+// LoadShelfConfigs reads a kitchen layout from a JSON file
+func LoadShelfConfigs(path string) ([]ShelfConfig, error) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	shelfConfigs := []ShelfConfig{}
+	if err := json.Unmarshal(body, &shelfConfigs); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateShelfConfigs(shelfConfigs); err != nil {
+		return nil, err
+	}
+
+	return shelfConfigs, nil
+}
+
+// ValidateShelfConfigs checks that a kitchen layout can be used to create a ShelfSet
+func ValidateShelfConfigs(shelfConfigs []ShelfConfig) error {
+	if len(shelfConfigs) == 0 {
+		return fmt.Errorf(NoShelvesErr)
+	}
+
+	labels := map[string]bool{}
+	for _, shelfConfig := range shelfConfigs {
+		if shelfConfig.Label == "" || labels[shelfConfig.Label] {
+			return fmt.Errorf(InvalidShelfLabelErr, shelfConfig.Label)
+		}
+		labels[shelfConfig.Label] = true
+
+		if shelfConfig.Capacity <= 0 {
+			return fmt.Errorf(InvalidShelfCapacityErr, shelfConfig.Label)
+		}
+
+		if shelfConfig.DecayMultiplier < 0 {
+			return fmt.Errorf(InvalidShelfDecayMultiplierErr, shelfConfig.Label)
+		}
+
+		if !shelfConfig.Overflow && len(shelfConfig.Temperatures) == 0 {
+			return fmt.Errorf(NoShelfTemperaturesErr, shelfConfig.Label)
+		}
+	}
+
+	return nil
+}
@@ -2,23 +2,39 @@ package interfaces
 
 import (
 	"fmt"
-	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
-var OVERFLOW_SHELF_SIZE = 20
-
 // ShelfSet implements CarrierFacility. It contains the functionality
 // and representation of the shelves within our DarkKitchen.
+// Orders are added from the HTTP handlers, picked up from the driver
+// goroutines and thrown away from the decay monitor, so every exported
+// method and the monitor take mu before touching the shelves or the counters.
 type ShelfSet struct {
+	mu      sync.Mutex
 	shelves map[string][]Order
+	// the layout of the shelves, in the order
+	// they are considered when placing an Order
+	shelfConfigs        []ShelfConfig
+	shelfConfigsByLabel map[string]ShelfConfig
+	placementPolicy     PlacementPolicy
 	BaseOrderHandler
-	countNoSpace int
-	countDecay   int
+	countNoSpace   int
+	countDecay     int
+	countCancelled int
+	// when each Order on the shelves was put in the space it's in
+	enteredAt map[string]time.Time
 	// this channel receives UUIDs that match
 	// orders within the ShelfSet
 	orderDeathNotifications chan Order
-	shutdownMonitor         chan bool
-	darkKitchen             *DarkKitchen
+	// used by Sync to wait for the monitor to catch up
+	syncRequests    chan chan bool
+	shutdownMonitor chan bool
+	// closed once the monitor has shut down, so Sync has nothing to wait for
+	monitorStopped chan bool
+	darkKitchen    *DarkKitchen
 }
 
 // Used for referencing an order in a particular shelf
@@ -29,22 +45,39 @@ type ShelfOrder struct {
 }
 
 func CreateShelfSet(darkKitchen *DarkKitchen) *ShelfSet {
-	hotOrders := make([]Order, 15)
-	coldOrders := make([]Order, 15)
-	frozenOrders := make([]Order, 15)
-	overflowOrders := make([]Order, OVERFLOW_SHELF_SIZE)
+	shelfConfigs := CreateDefaultShelfConfigs()
+	var placementPolicy PlacementPolicy = HighestHealthToOverflowPolicy{}
+	if darkKitchen.simulationConfig != nil {
+		if len(darkKitchen.simulationConfig.Shelves) > 0 {
+			shelfConfigs = darkKitchen.simulationConfig.Shelves
+		}
+
+		if darkKitchen.simulationConfig.PlacementPolicy != nil {
+			placementPolicy = darkKitchen.simulationConfig.PlacementPolicy
+		}
+	}
+
+	shelves := map[string][]Order{}
+	shelfConfigsByLabel := map[string]ShelfConfig{}
+	for _, shelfConfig := range shelfConfigs {
+		shelves[shelfConfig.Label] = make([]Order, shelfConfig.Capacity)
+		shelfConfigsByLabel[shelfConfig.Label] = shelfConfig
+	}
+
 	orderDeathNotifications := make(chan Order, ORDER_DEATH_NOTIFICATIONS_SIZE)
+	syncRequests := make(chan chan bool)
 	shutdownMonitor := make(chan bool, 1)
 
 	s := &ShelfSet{
-		shelves: map[string][]Order{
-			HOT_TEMPERATURE_LABEL:    hotOrders,
-			COLD_TEMPERATURE_LABEL:   coldOrders,
-			FROZEN_TEMPERATURE_LABEL: frozenOrders,
-			OVERFLOW_LABEL:           overflowOrders,
-		},
+		shelves:                 shelves,
+		shelfConfigs:            shelfConfigs,
+		shelfConfigsByLabel:     shelfConfigsByLabel,
+		placementPolicy:         placementPolicy,
+		enteredAt:               map[string]time.Time{},
 		orderDeathNotifications: orderDeathNotifications,
+		syncRequests:            syncRequests,
 		shutdownMonitor:         shutdownMonitor,
+		monitorStopped:          make(chan bool),
 		darkKitchen:             darkKitchen,
 	}
 
@@ -54,49 +87,148 @@ func CreateShelfSet(darkKitchen *DarkKitchen) *ShelfSet {
 // GetState packages the shelf state into a parsable output
 // like { "hot": [{ orderObj, ... }], }
 func (s *ShelfSet) GetState() interface{} {
-	shelfState := map[string]interface{}{}
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	type ViewableOrder struct {
-		ID               string  `json:"id"`
-		Name             string  `json:"name"`
-		NormalizedHealth float32 `json:"normalizedHealth"`
-		Temperature      string  `json:"temp"`
-		PickedUp         bool    `json:"pickedUp"`
-	}
+	shelfState := map[string]interface{}{}
 
 	for label := range s.shelves {
 		shelfState[label] = []ViewableOrder{}
 		for _, order := range s.shelves[label] {
 			if order != nil {
-				shelfState[label] = append(shelfState[label].([]ViewableOrder), ViewableOrder{
-					ID:               order.GetID(),
-					Name:             order.GetName(),
-					NormalizedHealth: order.GetHealth() / order.GetShelfLife(),
-					Temperature:      order.GetTemperature(),
-					PickedUp:         order.GetPickedUp(),
-				})
+				shelfState[label] = append(shelfState[label].([]ViewableOrder), viewOrder(order))
 			}
 		}
 	}
 
 	shelfState[SHELFSET_WASTED_ORDERS_DECAY_LABEL] = s.countDecay
 	shelfState[SHELFSET_WASTED_ORDERS_NOSPACE_LABEL] = s.countNoSpace
+	shelfState[SHELFSET_CANCELLED_ORDERS_LABEL] = s.countCancelled
+	if s.darkKitchen.Dispatcher != nil {
+		shelfState[SHELFSET_FLEET_LABEL] = s.darkKitchen.Dispatcher.Fleet.GetState()
+		shelfState[SHELFSET_DISPATCH_LABEL] = s.darkKitchen.Dispatcher.GetWaitStats()
+	}
 
 	return shelfState
 }
 
+// GetVersionedState returns every space on the shelves, empty or not,
+// along with the sequence number of the last Event it reflects
+func (s *ShelfSet) GetVersionedState() ShelfSetState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := ShelfSetState{
+		Type:    SNAPSHOT_MESSAGE_TYPE,
+		Shelves: map[string][]*ViewableOrder{},
+		Counts: map[string]int{
+			SHELFSET_WASTED_ORDERS_DECAY_LABEL:   s.countDecay,
+			SHELFSET_WASTED_ORDERS_NOSPACE_LABEL: s.countNoSpace,
+			SHELFSET_CANCELLED_ORDERS_LABEL:      s.countCancelled,
+		},
+	}
+
+	// shelf Events are published while holding s.mu, so
+	// none can slip in between the version and the shelves
+	if s.darkKitchen.Events != nil {
+		state.Version = s.darkKitchen.Events.LastSeq()
+	}
+
+	for label, shelf := range s.shelves {
+		state.Shelves[label] = make([]*ViewableOrder, len(shelf))
+		for idx, order := range shelf {
+			if order != nil {
+				view := viewOrder(order)
+				state.Shelves[label][idx] = &view
+			}
+		}
+	}
+
+	return state
+}
+
+// GetSnapshot returns every space on the shelves with the Orders on them in
+// full, along with the time and the sequence number of the last Event it reflects
+func (s *ShelfSet) GetSnapshot() ShelfSetSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := ShelfSetSnapshot{
+		At:      s.darkKitchen.now(),
+		Shelves: map[string][]*OrderSnapshot{},
+		Counts: map[string]int{
+			SHELFSET_WASTED_ORDERS_DECAY_LABEL:   s.countDecay,
+			SHELFSET_WASTED_ORDERS_NOSPACE_LABEL: s.countNoSpace,
+			SHELFSET_CANCELLED_ORDERS_LABEL:      s.countCancelled,
+		},
+	}
+
+	if s.darkKitchen.Events != nil {
+		snapshot.Version = s.darkKitchen.Events.LastSeq()
+	}
+
+	for label, shelf := range s.shelves {
+		snapshot.Shelves[label] = make([]*OrderSnapshot, len(shelf))
+		for idx, order := range shelf {
+			if order != nil {
+				orderSnapshot := order.Snapshot()
+				snapshot.Shelves[label][idx] = &orderSnapshot
+			}
+		}
+	}
+
+	return snapshot
+}
+
 func (s *ShelfSet) HandleOrder(order Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	// add order to shelf and start a goroutine for that Order
 	// which runs the decay process
-	err := s.AddOrderToShelf(order)
+	err := s.addOrderToShelf(order)
 	if err != nil {
-		s.countNoSpace++
+		// an order that was cancelled while it was on its way
+		// to the shelves isn't wasted for lack of space
+		if order.TransitionTo(REJECTED_NO_SPACE_ORDER_STATE) == nil {
+			s.countNoSpace++
+			s.darkKitchen.metrics().orderWasted(NO_SPACE_WASTE_REASON)
+			s.darkKitchen.publishEvent(Event{Type: ORDER_REJECTED_NO_SPACE_EVENT_TYPE, OrderID: order.GetID()})
+		}
 		return err
 	}
 
 	return nil
 }
 
+// CancelOrder takes the order off of the shelves and stops it from
+// decaying. The space it leaves is filled from overflow, the same as
+// when an order is picked up. Orders that have already left the shelves
+// can't be cancelled
+func (s *ShelfSet) CancelOrder(order Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := order.TransitionTo(CANCELLED_ORDER_STATE); err != nil {
+		return fmt.Errorf(OrderNotCancellableErr, order.GetID(), order.GetState())
+	}
+	s.countCancelled++
+
+	shelfOrder := s.findOrder(order.GetID())
+	if shelfOrder == nil {
+		// the order hasn't made it to the shelves yet
+		s.darkKitchen.publishEvent(Event{Type: ORDER_CANCELLED_EVENT_TYPE, OrderID: order.GetID()})
+		return nil
+	}
+
+	s.removeOrder(shelfOrder.ShelfLabel, shelfOrder.ShelfIndex)
+	s.darkKitchen.publishShelfEvent(ORDER_CANCELLED_EVENT_TYPE, order, shelfOrder.ShelfLabel, shelfOrder.ShelfIndex)
+	s.darkKitchen.Engine.StopDecay(order)
+	s.refillFromOverflow(shelfOrder.ShelfLabel, shelfOrder.ShelfIndex)
+
+	return nil
+}
+
 // Run as goroutine for shelf-set to monitor
 // when orders go to waste. This way, we can fill in
 // the empty space thereafter with an order from the overflow
@@ -105,48 +237,96 @@ func (s *ShelfSet) MonitorOrderDecayNotifications() {
 	for {
 		select {
 		case wastedOrder := <-s.orderDeathNotifications:
-			// find wastedOrder in our shelves
-			orderTemp := wastedOrder.GetTemperature()
-
-			orderFound := false
-			if s.shelves[orderTemp] != nil {
-				for idx, order := range s.shelves[orderTemp] {
-					if order != nil && order.GetID() == wastedOrder.GetID() {
-						// orderFound = true
-						// remove order off of shelf
-						s.removeOrder(orderTemp, idx)
-						s.countDecay++
-						orderFound = true
-
-						// Check if we can add an Order from the overflow shelf
-						overflowOrder, err := s.GetShortestLivingOrderFromOverflowShelf(orderTemp)
-						if err == nil {
-							// assign order to empty space and remove from overflow shelf
-							s.addOrder(overflowOrder.Order, orderTemp, idx)
-							s.removeOrder(OVERFLOW_LABEL, overflowOrder.ShelfIndex)
-						}
-					}
-				}
-			}
+			s.removeWastedOrder(wastedOrder)
 
-			// check overflow shelf if order not found on temperature shelf
-			if !orderFound {
-				for idx, order := range s.shelves[OVERFLOW_LABEL] {
-					if order != nil && order.GetID() == wastedOrder.GetID() {
-						// remove order off of shelf
-						orderFound = true
-						s.removeOrder(OVERFLOW_LABEL, idx)
-						s.countDecay++
-					}
-				}
+		case done := <-s.syncRequests:
+			// handle every notification that was sent before the sync request
+			// so the caller sees all of them applied to the shelves
+			for len(s.orderDeathNotifications) > 0 {
+				s.removeWastedOrder(<-s.orderDeathNotifications)
 			}
+			done <- true
 
 		case _ = <-s.shutdownMonitor:
-			break
+			close(s.monitorStopped)
+			return
 		}
 	}
 }
 
+// removeWastedOrder takes an order that has decayed off of the shelves
+// and fills its space with an order from the overflow shelf, if possible
+func (s *ShelfSet) removeWastedOrder(wastedOrder Order) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// find wastedOrder in our shelves
+	shelfOrder := s.findOrder(wastedOrder.GetID())
+	if shelfOrder == nil {
+		return
+	}
+
+	// orders on the shelves can always be wasted, but one that
+	// can't be is left where it is rather than lost track of
+	if err := shelfOrder.TransitionTo(WASTED_DECAY_ORDER_STATE); err != nil {
+		return
+	}
+
+	// remove order off of shelf
+	s.removeOrder(shelfOrder.ShelfLabel, shelfOrder.ShelfIndex)
+	s.countDecay++
+	s.darkKitchen.metrics().orderWasted(DECAY_WASTE_REASON)
+	s.darkKitchen.publishShelfEvent(ORDER_DECAYED_EVENT_TYPE, shelfOrder.Order, shelfOrder.ShelfLabel, shelfOrder.ShelfIndex)
+
+	// Check if we can add an Order from the overflow shelf
+	s.refillFromOverflow(shelfOrder.ShelfLabel, shelfOrder.ShelfIndex)
+}
+
+// findOrder returns where the order with the input orderID
+// sits on the shelves, or nil if it isn't on any shelf.
+// must be called while holding s.mu
+func (s *ShelfSet) findOrder(orderID string) *ShelfOrder {
+	for _, shelfConfig := range s.shelfConfigs {
+		for shelfIndex, order := range s.shelves[shelfConfig.Label] {
+			if order != nil && order.GetID() == orderID {
+				return &ShelfOrder{
+					ShelfLabel: shelfConfig.Label,
+					ShelfIndex: shelfIndex,
+					Order:      order,
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// refillFromOverflow fills an empty space on a temperature
+// shelf with an order from the overflow shelves, if possible
+func (s *ShelfSet) refillFromOverflow(shelfLabel string, shelfIndex int) {
+	if s.shelfConfigsByLabel[shelfLabel].Overflow {
+		return
+	}
+
+	overflowOrder := s.placementPolicy.ChooseFromOverflow(s.getOverflowOrders(s.shelfConfigsByLabel[shelfLabel]))
+	if overflowOrder != nil {
+		// an order that can't be moved is left on the overflow shelf
+		s.moveOrder(*overflowOrder, shelfLabel, shelfIndex)
+	}
+}
+
+// Sync blocks until every decay notification sent
+// so far has been handled by the monitor
+func (s *ShelfSet) Sync() {
+	done := make(chan bool)
+	select {
+	case s.syncRequests <- done:
+		<-done
+	case <-s.monitorStopped:
+		// the shelves have shut down, so there's nothing left to catch up on
+	}
+}
+
 func (s *ShelfSet) Start() {
 	go s.MonitorOrderDecayNotifications()
 }
@@ -155,26 +335,141 @@ func (s *ShelfSet) Shutdown() {
 	s.shutdownMonitor <- true
 }
 
+// startDecay runs the decay process for an order
+// that has just been placed on the shelves
+func (s *ShelfSet) startDecay(order Order) {
+	s.darkKitchen.Engine.StartDecay(order, s.orderDeathNotifications, getShelfDecayValue)
+}
+
 func (s *ShelfSet) removeOrder(label string, idx int) {
+	order := s.shelves[label][idx]
+	if order == nil {
+		return
+	}
+
 	s.shelves[label][idx] = nil
-	s.darkKitchen.CarrierFacilityHasBeenUpdated()
+	s.darkKitchen.metrics().shelfLeft(label, s.darkKitchen.now().Sub(s.enteredAt[order.GetID()]))
+	delete(s.enteredAt, order.GetID())
 }
 
-func (s *ShelfSet) addOrder(order Order, label string, idx int) {
+// fillSpace puts the order in the given space as far as the shelves are concerned
+func (s *ShelfSet) fillSpace(order Order, label string, idx int) {
 	s.shelves[label][idx] = order
+	s.enteredAt[order.GetID()] = s.darkKitchen.now()
+	s.darkKitchen.metrics().shelfEntered(label)
+}
 
-	if label == OVERFLOW_LABEL {
-		order.SetCurrentDecayRate(float32(OVERFLOW_PREMIUM) * order.GetOriginalDecayRate())
-	} else {
-		order.SetCurrentDecayRate(order.GetOriginalDecayRate())
+// placeOrder puts an order that has just come out of the kitchen in the given space
+func (s *ShelfSet) placeOrder(order Order, label string, idx int) error {
+	if err := order.TransitionTo(s.shelfState(label)); err != nil {
+		return err
+	}
+
+	s.addOrder(order, label, idx)
+	s.darkKitchen.metrics().orderPlaced(label)
+	s.darkKitchen.publishShelfEvent(ORDER_PLACED_EVENT_TYPE, order, label, idx)
+	return nil
+}
+
+// moveOrder moves an order that is already on the shelves to the given
+// space, either from a temperature shelf to overflow or the other way around
+func (s *ShelfSet) moveOrder(shelfOrder ShelfOrder, label string, idx int) error {
+	if err := shelfOrder.TransitionTo(s.shelfState(label)); err != nil {
+		return err
+	}
+
+	s.removeOrder(shelfOrder.ShelfLabel, shelfOrder.ShelfIndex)
+	s.addOrder(shelfOrder.Order, label, idx)
+
+	eventType := ORDER_RESCUED_FROM_OVERFLOW_EVENT_TYPE
+	if s.shelfConfigsByLabel[label].Overflow {
+		eventType = ORDER_MOVED_TO_OVERFLOW_EVENT_TYPE
+	}
+	s.darkKitchen.metrics().orderMoved(s.shelfConfigsByLabel[label].Overflow)
+
+	s.darkKitchen.publishEvent(Event{
+		Type:      eventType,
+		OrderID:   shelfOrder.GetID(),
+		Shelf:     label,
+		Slot:      &idx,
+		FromShelf: shelfOrder.ShelfLabel,
+		FromSlot:  &shelfOrder.ShelfIndex,
+	})
+	return nil
+}
+
+// shelfState is the state an order is in while it's on the shelf with the given label
+func (s *ShelfSet) shelfState(label string) OrderState {
+	if s.shelfConfigsByLabel[label].Overflow {
+		return IN_OVERFLOW_ORDER_STATE
+	}
+
+	return ON_SHELF_ORDER_STATE
+}
+
+// addOrder puts the order in the given space. It must already
+// have moved into the state for the shelf it's going on
+func (s *ShelfSet) addOrder(order Order, label string, idx int) {
+	s.fillSpace(order, label, idx)
+	order.SetCurrentDecayRate(s.shelfConfigsByLabel[label].DecayMultiplier * order.GetOriginalDecayRate())
+	s.darkKitchen.Engine.DecayRateChanged(order)
+}
+
+// restoreOrder puts an Order that was on the shelves when the DarkKitchen was
+// recovered back in its space, ages it by the ticks it has spent on the shelves
+// and starts decaying it again. The Order must already be in its shelf's state
+func (s *ShelfSet) restoreOrder(order Order, label string, idx int, age float32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shelf, ok := s.shelves[label]
+	if !ok {
+		return fmt.Errorf(ShelfWithLabelNotFoundErr, label)
+	}
+
+	if idx < 0 || idx >= len(shelf) || shelf[idx] != nil {
+		return fmt.Errorf(ShelfSpaceNotFreeErr, idx, label)
 	}
 
-	// send notification to DarkKitchen there's been an update to the shelf
-	s.darkKitchen.CarrierFacilityHasBeenUpdated()
+	s.fillSpace(order, label, idx)
+	s.restoreAge(order, label, age)
+	s.startDecay(order)
+
+	return nil
+}
+
+// restoreAge ages an Order that was recovered by the ticks it spent
+// on the shelves, at the decay rate of the last shelf it was on
+func (s *ShelfSet) restoreAge(order Order, label string, age float32) {
+	order.SetCurrentDecayRate(s.shelfConfigsByLabel[label].DecayMultiplier * order.GetOriginalDecayRate())
+	order.AgeBy(age, getShelfDecayValue)
+}
+
+// restoreCounts sets the wasted and cancelled
+// counts to what they were before a recovery
+func (s *ShelfSet) restoreCounts(counts map[string]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.countDecay = counts[SHELFSET_WASTED_ORDERS_DECAY_LABEL]
+	s.countNoSpace = counts[SHELFSET_WASTED_ORDERS_NOSPACE_LABEL]
+	s.countCancelled = counts[SHELFSET_CANCELLED_ORDERS_LABEL]
+}
+
+// isOverflow reports whether the shelf with the given label is an overflow shelf
+func (s *ShelfSet) isOverflow(label string) bool {
+	return s.shelfConfigsByLabel[label].Overflow
 }
 
 // Finds the first available empty space from the particular shelf of the ShelfSet
 func (s *ShelfSet) GetEmptySpaceFromShelf(shelfLabel string) (*int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.getEmptySpaceFromShelf(shelfLabel)
+}
+
+func (s *ShelfSet) getEmptySpaceFromShelf(shelfLabel string) (*int, error) {
 	outIdx := 0
 	for idx, shelfOrder := range s.shelves[shelfLabel] {
 		if shelfOrder == nil {
@@ -186,192 +481,272 @@ func (s *ShelfSet) GetEmptySpaceFromShelf(shelfLabel string) (*int, error) {
 	return nil, fmt.Errorf(NoSpaceLeftOnShelfErr)
 }
 
-// Finds the Order with the highest health in the particular shelf
-func (s *ShelfSet) GetHighestHealthOrderFromShelf(shelfLabel string) *ShelfOrder {
-	var highestHealthOrder *ShelfOrder
-	for idx, shelfOrder := range s.shelves[shelfLabel] {
-		// if shelf is full, let's find the order with the highest health to insert into
-		// the overflow shelf if that's possible
-		if highestHealthOrder == nil || (shelfOrder != nil && shelfOrder.GetHealth() < highestHealthOrder.GetHealth()) {
-			highestHealthOrder = &ShelfOrder{
-				ShelfIndex: idx,
-				ShelfLabel: shelfLabel,
-				Order:      shelfOrder,
-			}
-		}
-	}
-
-	return highestHealthOrder
-}
-
 // AddOrderToShelf looks for the appropriate shelf
 // to append the order to and adds it to that shelf
-// if possible
+// if possible. When the shelves are full, the ShelfSet's
+// PlacementPolicy decides what goes to overflow
 func (s *ShelfSet) AddOrderToShelf(order Order) error {
-	emptySpaceFound := false
-	var highestHealthOrder *ShelfOrder
-
-	switch order.GetTemperature() {
-	// The code structure for all cases is the same with the difference being
-	// the label that is used and the requested order to be added to the shelf set.
-	// Since we are mutating the state of the shelves, we want to show the
-	// explicit nature of the addition rather than hiding
-	// it within a function and reducing the number of code replication
-	case HOT_TEMPERATURE_LABEL:
-		emptySpaceIdx, err := s.GetEmptySpaceFromShelf(HOT_TEMPERATURE_LABEL)
-		if err != nil {
-			// find highest health order to place in overflow shelf
-			highestHealthOrder = s.GetHighestHealthOrderFromShelf(HOT_TEMPERATURE_LABEL)
-		} else {
-			emptySpaceFound = true
-			s.addOrder(order, HOT_TEMPERATURE_LABEL, *emptySpaceIdx)
-
-			s.darkKitchen.WG.Add(1)
-			go order.Decay(s.orderDeathNotifications, getShelfDecayValue)
-		}
-	case COLD_TEMPERATURE_LABEL:
-		emptySpaceIdx, err := s.GetEmptySpaceFromShelf(COLD_TEMPERATURE_LABEL)
-		if err != nil {
-			highestHealthOrder = s.GetHighestHealthOrderFromShelf(COLD_TEMPERATURE_LABEL)
-		} else {
-			emptySpaceFound = true
-			s.addOrder(order, COLD_TEMPERATURE_LABEL, *emptySpaceIdx)
-
-			s.darkKitchen.WG.Add(1)
-			go order.Decay(s.orderDeathNotifications, getShelfDecayValue)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addOrderToShelf(order)
+}
+
+// addOrderToShelf must be called while holding s.mu
+func (s *ShelfSet) addOrderToShelf(order Order) error {
+	// only orders the Dispatcher has taken on can be placed
+	if state := order.GetState(); !CanTransition(state, ON_SHELF_ORDER_STATE) || !CanTransition(state, IN_OVERFLOW_ORDER_STATE) {
+		return fmt.Errorf(InvalidOrderTransitionErr, order.GetID(), state, ON_SHELF_ORDER_STATE)
+	}
+
+	// go through every temperature shelf that takes the order, in the order they
+	// are laid out, and place the order in the first empty space we find
+	temperatureShelfOrders := []ShelfOrder{}
+	temperatureShelfFound := false
+	for _, shelfConfig := range s.shelfConfigs {
+		if shelfConfig.Overflow || !shelfConfig.Accepts(order.GetTemperature()) {
+			continue
 		}
-	case FROZEN_TEMPERATURE_LABEL:
-		emptySpaceIdx, err := s.GetEmptySpaceFromShelf(FROZEN_TEMPERATURE_LABEL)
-		if err != nil {
-			highestHealthOrder = s.GetHighestHealthOrderFromShelf(FROZEN_TEMPERATURE_LABEL)
-		} else {
-			emptySpaceFound = true
-			s.addOrder(order, FROZEN_TEMPERATURE_LABEL, *emptySpaceIdx)
-
-			s.darkKitchen.WG.Add(1)
-			go order.Decay(s.orderDeathNotifications, getShelfDecayValue)
+		temperatureShelfFound = true
+
+		emptySpaceIdx, err := s.getEmptySpaceFromShelf(shelfConfig.Label)
+		if err == nil {
+			if err := s.placeOrder(order, shelfConfig.Label, *emptySpaceIdx); err != nil {
+				return err
+			}
+			s.startDecay(order)
+			return nil
 		}
-	default:
+
+		temperatureShelfOrders = append(temperatureShelfOrders, s.getShelfOrders(shelfConfig.Label)...)
+	}
+
+	if !temperatureShelfFound {
 		return fmt.Errorf(ShelfWithLabelNotFoundErr, order.GetTemperature())
 	}
 
-	// if all temperature shelves are empty
-	if !emptySpaceFound {
-		// check for an empty space in the overflow shelf
-		for idx, shelfOrder := range s.shelves[OVERFLOW_LABEL] {
-			if shelfOrder == nil {
-				emptySpaceFound = true
-
-				// if the highestHealthOrder has a health gt the input order,
-				// move that to overflow. otherwise, insert the input order into overflow
-				if highestHealthOrder.Order.GetHealth() > order.GetHealth() {
-					s.removeOrder(highestHealthOrder.ShelfLabel, highestHealthOrder.ShelfIndex)
-					// add highesthealth order into overflow shelf
-					s.addOrder(highestHealthOrder.Order, OVERFLOW_LABEL, idx)
-
-					// add input order into temperature shelf now that there is space
-					s.addOrder(order, highestHealthOrder.ShelfLabel, highestHealthOrder.ShelfIndex)
-				} else {
-					// add input order into overflow
-					s.addOrder(order, OVERFLOW_LABEL, idx)
-				}
+	// if all temperature shelves are full, either the input order or
+	// one of the orders on its shelves has to go to overflow
+	incoming := s.estimatePickup(order)
+	overflowOrder := s.placementPolicy.ChooseForOverflow(incoming, temperatureShelfOrders)
+	movingOrder := order
+	if overflowOrder != nil {
+		movingOrder = overflowOrder.Order
+	}
 
-				s.darkKitchen.WG.Add(1)
-				go order.Decay(s.orderDeathNotifications, getShelfDecayValue)
+	overflowLabel, overflowIdx, err := s.getOverflowSpace(incoming, movingOrder)
+	if err != nil {
+		return err
+	}
 
-				break
-			}
+	if overflowOrder != nil {
+		// move the chosen order into overflow shelf
+		if err := s.moveOrder(*overflowOrder, overflowLabel, overflowIdx); err != nil {
+			return err
 		}
 
-		if !emptySpaceFound {
-			return fmt.Errorf(NoSpaceLeftErr)
-		}
+		// add input order into temperature shelf now that there is space
+		err = s.placeOrder(order, overflowOrder.ShelfLabel, overflowOrder.ShelfIndex)
+	} else {
+		// add input order into overflow
+		err = s.placeOrder(order, overflowLabel, overflowIdx)
+	}
+	if err != nil {
+		return err
 	}
 
+	s.startDecay(order)
 	return nil
 }
 
-// GetShortestLivingOrderFromOverflowShelf returns the
-// order with least life left from the specified
-// temperature classification, if exists
-func (s *ShelfSet) GetShortestLivingOrderFromOverflowShelf(temp string) (*ShelfOrder, error) {
-	sortedOrders := []ShelfOrder{}
-	for idx, order := range s.shelves[OVERFLOW_LABEL] {
-		if order != nil && order.GetTemperature() == temp {
-			sortedOrders = append(sortedOrders, ShelfOrder{
-				ShelfLabel: OVERFLOW_LABEL,
+// estimatePickup stands in for when an incoming Order will be picked up if it doesn't
+// have a driver yet, since the Dispatcher only sends one once the Order is on the shelves
+func (s *ShelfSet) estimatePickup(order Order) Order {
+	simulationConfig := s.darkKitchen.simulationConfig
+	if simulationConfig == nil || !order.GetExpectedPickupTime().IsZero() {
+		return order
+	}
+
+	ticks := simulationConfig.travelTime().ExpectedTicks()
+	return estimatedPickupOrder{
+		Order:    order,
+		pickupAt: s.darkKitchen.now().Add(time.Duration(ticks) * simulationConfig.SleepTime),
+	}
+}
+
+// getOverflowSpace finds an empty space for movingOrder on the overflow shelves. If they
+// are full, the PlacementPolicy may throw away one of the overflow orders to make room
+func (s *ShelfSet) getOverflowSpace(incoming Order, movingOrder Order) (string, int, error) {
+	for _, shelfConfig := range s.shelfConfigs {
+		if !shelfConfig.Overflow || !shelfConfig.Accepts(movingOrder.GetTemperature()) {
+			continue
+		}
+
+		emptySpaceIdx, err := s.getEmptySpaceFromShelf(shelfConfig.Label)
+		if err == nil {
+			return shelfConfig.Label, *emptySpaceIdx, nil
+		}
+	}
+
+	overflowOrders := []ShelfOrder{}
+	for _, shelfConfig := range s.shelfConfigs {
+		if shelfConfig.Overflow && shelfConfig.Accepts(movingOrder.GetTemperature()) {
+			overflowOrders = append(overflowOrders, s.getShelfOrders(shelfConfig.Label)...)
+		}
+	}
+
+	evictedOrder := s.placementPolicy.ChooseEviction(incoming, overflowOrders)
+	if evictedOrder == nil {
+		return "", 0, fmt.Errorf(NoSpaceLeftErr)
+	}
+
+	// the evicted order is wasted the same way as an order that can't fit on the shelves
+	if err := evictedOrder.TransitionTo(REJECTED_NO_SPACE_ORDER_STATE); err != nil {
+		return "", 0, err
+	}
+	s.removeOrder(evictedOrder.ShelfLabel, evictedOrder.ShelfIndex)
+	s.darkKitchen.Engine.StopDecay(evictedOrder.Order)
+	s.countNoSpace++
+	s.darkKitchen.metrics().orderWasted(NO_SPACE_WASTE_REASON)
+	s.darkKitchen.publishShelfEvent(ORDER_REJECTED_NO_SPACE_EVENT_TYPE, evictedOrder.Order, evictedOrder.ShelfLabel, evictedOrder.ShelfIndex)
+
+	return evictedOrder.ShelfLabel, evictedOrder.ShelfIndex, nil
+}
+
+// getShelfOrders returns every order on the shelf with the given label
+func (s *ShelfSet) getShelfOrders(shelfLabel string) []ShelfOrder {
+	shelfOrders := []ShelfOrder{}
+	for idx, order := range s.shelves[shelfLabel] {
+		if order != nil {
+			shelfOrders = append(shelfOrders, ShelfOrder{
+				ShelfLabel: shelfLabel,
 				ShelfIndex: idx,
 				Order:      order,
 			})
 		}
 	}
 
-	if len(sortedOrders) > 0 {
-		// sort Orders by health
-		sort.Sort(byHealth(sortedOrders))
-		return &sortedOrders[len(sortedOrders)-1], nil
-	} else {
-		return nil, fmt.Errorf("No orders with temp %s found", temp)
+	return shelfOrders
+}
+
+// getOverflowOrders returns every order on the overflow
+// shelves that can be placed on the given shelf
+func (s *ShelfSet) getOverflowOrders(shelfConfig ShelfConfig) []ShelfOrder {
+	overflowOrders := []ShelfOrder{}
+	for _, overflowConfig := range s.shelfConfigs {
+		if !overflowConfig.Overflow {
+			continue
+		}
+
+		for _, overflowOrder := range s.getShelfOrders(overflowConfig.Label) {
+			if shelfConfig.Accepts(overflowOrder.GetTemperature()) {
+				overflowOrders = append(overflowOrders, overflowOrder)
+			}
+		}
 	}
+
+	return overflowOrders
 }
 
 // GiveOrder finds the order with the input orderID
 // and returns that back, if exists
 func (s *ShelfSet) GiveOrder(orderID string) (Order, error) {
-	var foundOrder Order
+	orders, _, err := s.GiveOrders([]string{orderID})
+	if err != nil {
+		return nil, fmt.Errorf(OrderNotFoundErr, orderID)
+	}
 
-	for shelfLabel := range s.shelves {
-		for shelfIndex, order := range s.shelves[shelfLabel] {
-			if order != nil && order.GetID() == orderID {
-				// empty out shelf space
-				foundOrder = order
-				s.removeOrder(shelfLabel, shelfIndex)
-
-				// Check if we can add an Order from the overflow shelf
-				if shelfLabel != OVERFLOW_LABEL {
-					overflowOrder, err := s.GetShortestLivingOrderFromOverflowShelf(shelfLabel)
-					if err == nil {
-						// assign order to empty space and
-						// remove from overflow shelf
-						s.addOrder(overflowOrder.Order, shelfLabel, shelfIndex)
-						s.removeOrder(OVERFLOW_LABEL, overflowOrder.ShelfIndex)
-					}
-				}
+	return orders[0], nil
+}
 
-				break
-			}
+// GiveOrders hands over every order with the input orderIDs at once. If any
+// of them aren't on the shelves, none are given and the missing ids are returned.
+// None are given either if an id is asked for more than once
+func (s *ShelfSet) GiveOrders(orderIDs []string) ([]Order, []string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shelfOrders := []*ShelfOrder{}
+	missing := []string{}
+	duplicates := []string{}
+	seen := map[string]bool{}
+	for _, orderID := range orderIDs {
+		if seen[orderID] {
+			duplicates = append(duplicates, orderID)
+			continue
+		}
+		seen[orderID] = true
+
+		shelfOrder := s.findOrder(orderID)
+		if shelfOrder == nil {
+			missing = append(missing, orderID)
+			continue
+		}
+		if state := shelfOrder.GetState(); !CanTransition(state, PICKED_UP_ORDER_STATE) {
+			return nil, nil, fmt.Errorf(InvalidOrderTransitionErr, orderID, state, PICKED_UP_ORDER_STATE)
 		}
+		shelfOrders = append(shelfOrders, shelfOrder)
 	}
 
-	if foundOrder != nil {
-		foundOrder.SetPickedUp(true)
-		return foundOrder, nil
-	} else {
-		return nil, fmt.Errorf("No order found for id: %s", orderID)
+	// an order can only be handed over once
+	if len(duplicates) > 0 {
+		return nil, nil, fmt.Errorf(DuplicateOrderIDsErr, strings.Join(duplicates, ", "))
+	}
+	if len(missing) > 0 {
+		return nil, missing, fmt.Errorf(OrdersNotFoundErr, strings.Join(missing, ", "))
 	}
-}
 
-func getShelfDecayValue(shelfLife float32, orderAge float32, decayRate float32) float32 {
-	return (shelfLife - orderAge) - (decayRate * orderAge)
+	// every order was checked above while holding s.mu,
+	// so none of them can have moved on since
+	orders := []Order{}
+	for _, shelfOrder := range shelfOrders {
+		if err := shelfOrder.TransitionTo(PICKED_UP_ORDER_STATE); err != nil {
+			return nil, nil, err
+		}
+
+		// empty out shelf space
+		s.removeOrder(shelfOrder.ShelfLabel, shelfOrder.ShelfIndex)
+		s.darkKitchen.metrics().orderPickedUp(shelfOrder.Snapshot())
+		s.darkKitchen.Engine.StopDecay(shelfOrder.Order)
+		s.darkKitchen.publishShelfEvent(ORDER_PICKED_UP_EVENT_TYPE, shelfOrder.Order, shelfOrder.ShelfLabel, shelfOrder.ShelfIndex)
+		orders = append(orders, shelfOrder.Order)
+	}
+
+	// Check if we can add Orders from the overflow shelf, once the whole batch is off the shelves
+	for _, shelfOrder := range shelfOrders {
+		s.refillFromOverflow(shelfOrder.ShelfLabel, shelfOrder.ShelfIndex)
+	}
+
+	return orders, nil, nil
 }
 
-// Implement Sort interface to use byHealth as a custom sorting function - https://golang.org/pkg/sort/#Interface
-type byHealth []ShelfOrder
+// GetOrders returns every order on the shelves and where it is
+func (s *ShelfSet) GetOrders() []ShelfOrder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shelfOrders := []ShelfOrder{}
+	for _, shelfConfig := range s.shelfConfigs {
+		shelfOrders = append(shelfOrders, s.getShelfOrders(shelfConfig.Label)...)
+	}
 
-func (s byHealth) Len() int {
-	return len(s)
+	return shelfOrders
 }
 
-// ascending where Orders with most life
-// are in the beginning
-func (s byHealth) Less(i, j int) bool {
-	if s[i].GetHealth() > s[j].GetHealth() {
-		return true
-	} else {
-		return false
+// GetOrderShelf returns the label of the shelf the order with the
+// input orderID is sitting on, or an empty string if it isn't on the shelves
+func (s *ShelfSet) GetOrderShelf(orderID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shelfOrder := s.findOrder(orderID)
+	if shelfOrder == nil {
+		return ""
 	}
+
+	return shelfOrder.ShelfLabel
 }
 
-func (s byHealth) Swap(i, j int) {
-	s[i], s[j] = s[j], s[i]
+func getShelfDecayValue(shelfLife float32, orderAge float32, decayRate float32) float32 {
+	return (shelfLife - orderAge) - (decayRate * orderAge)
 }
@@ -0,0 +1,96 @@
+package interfaces
+
+// ViewableOrder is what clients are shown about an Order on the shelves
+type ViewableOrder struct {
+	ID               string     `json:"id"`
+	Name             string     `json:"name"`
+	NormalizedHealth float32    `json:"normalizedHealth"`
+	Temperature      string     `json:"temp"`
+	PickedUp         bool       `json:"pickedUp"`
+	State            OrderState `json:"state"`
+}
+
+func viewOrder(order Order) ViewableOrder {
+	snapshot := order.Snapshot()
+	return ViewableOrder{
+		ID:               snapshot.ID,
+		Name:             snapshot.Name,
+		NormalizedHealth: snapshot.NormalizedHealth(),
+		Temperature:      snapshot.Temperature,
+		PickedUp:         snapshot.PickedUp,
+		State:            snapshot.State,
+	}
+}
+
+// ShelfSetState is every space on the shelves, empty ones included, as of
+// Version, the sequence number of the last Event it reflects. Clients that
+// keep their own copy of the shelves start from it and apply ShelfSetDiffs
+type ShelfSetState struct {
+	Type    string                      `json:"type"`
+	Version uint64                      `json:"version"`
+	Shelves map[string][]*ViewableOrder `json:"shelves"`
+	// the wasted and cancelled order counts, by their GetState labels
+	Counts map[string]int `json:"counts"`
+}
+
+// ShelfSetDiff is what changed on the shelves with the Event numbered Version
+type ShelfSetDiff struct {
+	Type    string       `json:"type"`
+	Version uint64       `json:"version"`
+	Slots   []SlotChange `json:"slots,omitempty"`
+	// added to the counts of the same label
+	Counts map[string]int `json:"counts,omitempty"`
+}
+
+// SlotChange is the new content of a shelf space. Order is nil when it was emptied
+type SlotChange struct {
+	Shelf string         `json:"shelf"`
+	Slot  int            `json:"slot"`
+	Order *ViewableOrder `json:"order"`
+}
+
+// DiffFromEvent turns an Event published by the DarkKitchen into the change
+// it made to the shelves. It returns false for Events that don't change them
+func (ck *DarkKitchen) DiffFromEvent(event Event) (ShelfSetDiff, bool) {
+	diff := ShelfSetDiff{
+		Type:    DIFF_MESSAGE_TYPE,
+		Version: event.Seq,
+	}
+
+	if event.FromSlot != nil {
+		diff.Slots = append(diff.Slots, SlotChange{Shelf: event.FromShelf, Slot: *event.FromSlot})
+	}
+
+	if event.Slot != nil {
+		change := SlotChange{Shelf: event.Shelf, Slot: *event.Slot}
+		switch event.Type {
+		case ORDER_PLACED_EVENT_TYPE, ORDER_MOVED_TO_OVERFLOW_EVENT_TYPE, ORDER_RESCUED_FROM_OVERFLOW_EVENT_TYPE:
+			// the order is shown as it is now, rather than when the event happened
+			if order, err := ck.GetOrder(event.OrderID); err == nil {
+				view := viewOrder(order)
+				change.Order = &view
+			}
+		}
+		diff.Slots = append(diff.Slots, change)
+	}
+
+	if label, ok := countLabel(event.Type); ok {
+		diff.Counts = map[string]int{label: 1}
+	}
+
+	return diff, len(diff.Slots) > 0 || len(diff.Counts) > 0
+}
+
+// countLabel returns the label of the count an Event of the given type adds to, if any
+func countLabel(eventType EventType) (string, bool) {
+	switch eventType {
+	case ORDER_DECAYED_EVENT_TYPE:
+		return SHELFSET_WASTED_ORDERS_DECAY_LABEL, true
+	case ORDER_REJECTED_NO_SPACE_EVENT_TYPE:
+		return SHELFSET_WASTED_ORDERS_NOSPACE_LABEL, true
+	case ORDER_CANCELLED_EVENT_TYPE:
+		return SHELFSET_CANCELLED_ORDERS_LABEL, true
+	}
+
+	return "", false
+}
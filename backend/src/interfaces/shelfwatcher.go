@@ -0,0 +1,134 @@
+package interfaces
+
+// ShelfWatcher keeps a client's copy of a Simulation's shelves up to date, whatever
+// the client is connected over. It tracks the version of the shelves the client
+// has, so the client can be caught up on what it missed when it reconnects, and
+// is sent a new snapshot when it can't be, when it falls behind and Events are
+// dropped, or when the Simulation is reset
+type ShelfWatcher struct {
+	simulation   *Simulation
+	subscription *Subscription
+	filter       EventFilter
+	send         func(ShelfUpdate) error
+	// the version the client's copy of the shelves is at
+	version uint64
+	dropped int
+}
+
+// ShelfUpdate is what a ShelfWatcher sends the client, either a Snapshot
+// of the shelves or an Event along with the Diff it made to them
+type ShelfUpdate struct {
+	Snapshot *ShelfSetState
+	Event    *Event
+	// nil for Events that don't change the shelves
+	Diff *ShelfSetDiff
+}
+
+// WatchShelves subscribes to the Simulation's Events and keeps it from being
+// collected until the ShelfWatcher is closed. The client is caught up from since
+// if it can be, or else sent a snapshot. Only the Events and shelves that get
+// through the filter are sent
+func (s *Simulation) WatchShelves(bufferSize int, filter EventFilter, since *uint64, send func(ShelfUpdate) error) (*ShelfWatcher, error) {
+	watcher := &ShelfWatcher{
+		simulation: s,
+		filter:     filter,
+		send:       send,
+	}
+
+	var backlog []Event
+	caughtUp := false
+	var err error
+	// every Event counts, so a dropped one means the client needs a new snapshot
+	if since == nil {
+		watcher.subscription, err = s.Events().Subscribe(bufferSize, DROP_SUBSCRIPTION_POLICY)
+	} else {
+		watcher.subscription, backlog, caughtUp, err = s.Events().SubscribeSince(*since, bufferSize, DROP_SUBSCRIPTION_POLICY)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.Attach()
+
+	if caughtUp {
+		watcher.version = *since
+		err = watcher.sendEvents(backlog)
+	} else {
+		err = watcher.sendSnapshot()
+	}
+
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	return watcher, nil
+}
+
+// Ready is signalled when there are Events for Update to send
+func (w *ShelfWatcher) Ready() <-chan struct{} {
+	return w.subscription.Ready()
+}
+
+// Update sends the Events that have piled up, or a snapshot if some were dropped
+func (w *ShelfWatcher) Update() error {
+	messages := w.subscription.Drain()
+
+	if dropped := w.subscription.Dropped(); dropped != w.dropped {
+		w.dropped = dropped
+		return w.sendSnapshot()
+	}
+
+	events := make([]Event, 0, len(messages))
+	for _, message := range messages {
+		events = append(events, message.(Event))
+	}
+
+	return w.sendEvents(events)
+}
+
+// Close stops watching the Simulation
+func (w *ShelfWatcher) Close() {
+	w.subscription.Close()
+	w.simulation.Detach()
+}
+
+// sendEvents sends every Event past the client's version that gets through the filter
+func (w *ShelfWatcher) sendEvents(events []Event) error {
+	for _, event := range events {
+		if event.Seq <= w.version {
+			// already part of the last snapshot
+			continue
+		}
+
+		if event.Type == SIMULATION_RESET_EVENT_TYPE {
+			if err := w.sendSnapshot(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		w.version = event.Seq
+		if !w.filter.Matches(event) {
+			continue
+		}
+
+		update := ShelfUpdate{Event: &event}
+		if diff, ok := w.simulation.DarkKitchen().DiffFromEvent(event); ok {
+			update.Diff = &diff
+		}
+
+		if err := w.send(update); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sendSnapshot sends the filter's shelves and the version they are at
+func (w *ShelfWatcher) sendSnapshot() error {
+	state := w.filter.FilterState(w.simulation.DarkKitchen().CarrierFacility.GetVersionedState())
+	w.version = state.Version
+
+	return w.send(ShelfUpdate{Snapshot: &state})
+}
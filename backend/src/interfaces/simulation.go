@@ -0,0 +1,544 @@
+package interfaces
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// SimulationRequest holds the parameters a Simulation is started with.
+// Anything left out falls back to the defaults the backend starts with
+type SimulationRequest struct {
+	// average number of Orders fed into the kitchen every tick
+	PoissonRateParameter float32 `json:"poissonRateParam"`
+	DriverMinDelay       int     `json:"driverMinDelay"`
+	DriverMaxDelay       int     `json:"driverMaxDelay"`
+	// TravelTime, if set, is drawn from for drivers' travel times in place of the
+	// driver delays. Left out, it's the backend's -travel-time, if there is one
+	TravelTime *TravelTimeDistribution `json:"travelTime,omitempty"`
+	// the length of a tick in milliseconds
+	TimeUnits int `json:"timeUnits"`
+	// Seed makes a run reproducible. A new seed is drawn when it's left out
+	Seed *int64 `json:"seed,omitempty"`
+	// how many drivers the kitchen has. Left out, it's the backend's -fleet-size
+	FleetSize int `json:"fleetSize,omitempty"`
+	// the most Orders a driver picks up at once, and how many ticks away their
+	// pickup can be for an Order to join them. Left out, it's the backend's -batch-size and -batch-window
+	BatchSize   int `json:"batchSize,omitempty"`
+	BatchWindow int `json:"batchWindow,omitempty"`
+	// which Orders drivers pick up, one of the DispatchStrategy labels.
+	// Left out, it's the backend's -dispatch-strategy
+	DispatchStrategy string `json:"dispatchStrategy,omitempty"`
+	// Orders, if any, are fed into the kitchen by the Simulation itself at
+	// PoissonRateParameter Orders per tick. Otherwise Orders come in over HTTP
+	Orders []FoodOrderInput `json:"orders,omitempty"`
+}
+
+func (r SimulationRequest) withDefaults() SimulationRequest {
+	if r.PoissonRateParameter == 0 {
+		r.PoissonRateParameter = DEFAULT_ORDERS_PER_TICK
+	}
+
+	if r.DriverMinDelay == 0 && r.DriverMaxDelay == 0 {
+		r.DriverMinDelay = DEFAULT_DRIVER_MIN_DELAY
+		r.DriverMaxDelay = DEFAULT_DRIVER_MAX_DELAY
+	}
+
+	if r.TimeUnits == 0 {
+		r.TimeUnits = int(DEFAULT_SLEEP_TIME / time.Millisecond)
+	}
+
+	return r
+}
+
+func (r SimulationRequest) validate() error {
+	if r.PoissonRateParameter < 0 {
+		return fmt.Errorf(InvalidSimulationRequestErr, "poissonRateParam can't be negative")
+	}
+
+	if r.DriverMinDelay < 1 || r.DriverMaxDelay < r.DriverMinDelay {
+		return fmt.Errorf(InvalidSimulationRequestErr, "driver delays need 1 <= driverMinDelay <= driverMaxDelay")
+	}
+
+	if r.TravelTime != nil {
+		if err := r.TravelTime.Validate(); err != nil {
+			return fmt.Errorf(InvalidSimulationRequestErr, err.Error())
+		}
+	}
+
+	if r.FleetSize < 0 {
+		return fmt.Errorf(InvalidSimulationRequestErr, "fleetSize can't be negative")
+	}
+
+	if r.BatchSize < 0 || r.BatchWindow < 0 {
+		return fmt.Errorf(InvalidSimulationRequestErr, "batchSize and batchWindow can't be negative")
+	}
+
+	if r.DispatchStrategy != "" {
+		if _, err := CreateDispatchStrategy(r.DispatchStrategy); err != nil {
+			return fmt.Errorf(InvalidSimulationRequestErr, err.Error())
+		}
+	}
+
+	if r.TimeUnits < 1 {
+		return fmt.Errorf(InvalidSimulationRequestErr, "timeUnits has to be at least 1")
+	}
+
+	return nil
+}
+
+// Simulation is a session that runs a DarkKitchen started from a SimulationRequest.
+// It can be stopped, and reset to a fresh DarkKitchen with the same parameters
+type Simulation struct {
+	ID      string
+	Request SimulationRequest
+
+	// the layout, placement policy, clock and metrics every DarkKitchen of the simulation is created with
+	baseConfig *SimulationConfig
+	// every DarkKitchen the simulation runs publishes its Events here, so
+	// whoever is watching the simulation keeps watching through a reset
+	events *EventStream
+	// if set, the simulation's first DarkKitchen is recovered from
+	// it and every Event the simulation publishes is appended to it
+	eventLog *EventLog
+
+	mu          sync.RWMutex
+	darkKitchen *DarkKitchen
+	config      *SimulationConfig
+	startedAt   time.Time
+	stoppedAt   time.Time
+	resets      int
+	// used to tell when the simulation has gone idle
+	lastActive  time.Time
+	connections int
+}
+
+// SimulationStatus is what a Simulation reports about itself
+type SimulationStatus struct {
+	ID      string            `json:"id"`
+	Request SimulationRequest `json:"request"`
+	State   string            `json:"state"`
+	Seed    int64             `json:"seed"`
+	// number of times the simulation has been reset
+	Resets         int                `json:"resets"`
+	StartedAt      time.Time          `json:"startedAt"`
+	StoppedAt      *time.Time         `json:"stoppedAt,omitempty"`
+	OrdersReceived int                `json:"ordersReceived"`
+	OrdersByState  map[OrderState]int `json:"ordersByState"`
+}
+
+// CreateSimulation validates the request and starts a DarkKitchen with it. The
+// shelves, placement policy and clock are taken from baseConfig
+func CreateSimulation(request SimulationRequest, baseConfig *SimulationConfig) (*Simulation, error) {
+	return createSimulation(request, baseConfig, nil)
+}
+
+// CreateLoggedSimulation is CreateSimulation for a simulation that picks up where
+// eventLog left off, see RecoverDarkKitchen, and appends every Event to it
+func CreateLoggedSimulation(request SimulationRequest, baseConfig *SimulationConfig, eventLog *EventLog) (*Simulation, error) {
+	return createSimulation(request, baseConfig, eventLog)
+}
+
+func createSimulation(request SimulationRequest, baseConfig *SimulationConfig, eventLog *EventLog) (*Simulation, error) {
+	request = request.withDefaults()
+	if err := request.validate(); err != nil {
+		return nil, err
+	}
+
+	simulation := &Simulation{
+		ID:         uuid.NewV4().String(),
+		Request:    request,
+		baseConfig: baseConfig,
+		events:     CreateEventStream(),
+		eventLog:   eventLog,
+		lastActive: baseConfig.Clock.Now(),
+	}
+	if err := simulation.start(); err != nil {
+		return nil, err
+	}
+
+	return simulation, nil
+}
+
+// start creates a fresh DarkKitchen and starts feeding it Orders. It can only
+// fail for a logged simulation's first DarkKitchen, which is recovered from the log.
+// must be called while holding s.mu, or before s is shared
+func (s *Simulation) start() error {
+	config := CreateSimulationConfig(s.Request.DriverMinDelay, s.Request.DriverMaxDelay, time.Duration(s.Request.TimeUnits)*time.Millisecond)
+	config.Clock = s.baseConfig.Clock
+	config.Engine = s.baseConfig.Engine
+	config.Shelves = s.baseConfig.Shelves
+	config.PlacementPolicy = s.baseConfig.PlacementPolicy
+	config.DispatchStrategy = s.baseConfig.DispatchStrategy
+	if s.Request.DispatchStrategy != "" {
+		// validate has already made sure the strategy exists
+		config.DispatchStrategy, _ = CreateDispatchStrategy(s.Request.DispatchStrategy)
+	}
+	config.Metrics = s.baseConfig.Metrics
+	config.CourierProvider = s.baseConfig.CourierProvider
+	config.TravelTime = s.baseConfig.TravelTime
+	if s.Request.TravelTime != nil {
+		config.TravelTime = s.Request.TravelTime
+	}
+	config.FleetSize = s.baseConfig.FleetSize
+	if s.Request.FleetSize > 0 {
+		config.FleetSize = s.Request.FleetSize
+	}
+	config.BatchSize = s.baseConfig.BatchSize
+	if s.Request.BatchSize > 0 {
+		config.BatchSize = s.Request.BatchSize
+	}
+	config.BatchWindow = s.baseConfig.BatchWindow
+	if s.Request.BatchWindow > 0 {
+		config.BatchWindow = s.Request.BatchWindow
+	}
+	if s.Request.Seed != nil {
+		config.Seed = *s.Request.Seed
+	} else if s.config != nil {
+		// the seed drawn when the simulation was first started is kept
+		// through a reset, so the simulation plays out the same again
+		config.Seed = s.config.Seed
+	}
+
+	if s.eventLog != nil && s.resets == 0 {
+		darkKitchen, err := RecoverDarkKitchen(config, s.events, s.eventLog)
+		if err != nil {
+			return err
+		}
+		s.darkKitchen = darkKitchen
+	} else {
+		s.darkKitchen = CreateDarkKitchen(config)
+		s.darkKitchen.Events = s.events
+	}
+
+	s.config = config
+	s.startedAt = config.Clock.Now()
+	s.stoppedAt = time.Time{}
+
+	if len(s.Request.Orders) > 0 {
+		darkKitchen := s.darkKitchen
+		darkKitchen.WG.Add(1)
+		config.Clock.Go(func() {
+			defer darkKitchen.WG.Done()
+			s.feedOrders(darkKitchen, config)
+		})
+	}
+
+	return nil
+}
+
+// feedOrders sends the request's Orders to the DarkKitchen with exponentially
+// distributed gaps between them, until they run out or the kitchen is stopped
+func (s *Simulation) feedOrders(darkKitchen *DarkKitchen, config *SimulationConfig) {
+	for _, input := range s.Request.Orders {
+		ticks := darkKitchen.random.ExpFloat64() / float64(s.Request.PoissonRateParameter)
+		config.Clock.Sleep(time.Duration(ticks * float64(config.SleepTime)))
+		if darkKitchen.IsStopped() {
+			return
+		}
+
+		order := CreateFoodOrder(input.Name, input.DecayRate, input.ShelfLife, input.Temperature, darkKitchen)
+		// orders that are turned away are still recorded
+		// with their state, so the error can be dropped here
+		darkKitchen.ReceiveOrder(&order)
+	}
+}
+
+// DarkKitchen returns the kitchen the simulation is currently running
+func (s *Simulation) DarkKitchen() *DarkKitchen {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.darkKitchen
+}
+
+// Events receives the Events of whichever DarkKitchen the simulation
+// is running at the time. Sequence numbers carry on through a reset
+func (s *Simulation) Events() *EventStream {
+	return s.events
+}
+
+// EventLog returns the log the simulation appends to, or nil if it isn't logged
+func (s *Simulation) EventLog() *EventLog {
+	return s.eventLog
+}
+
+// touch marks the simulation as active
+func (s *Simulation) touch() {
+	now := s.baseConfig.Clock.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastActive = now
+}
+
+// Attach marks the simulation as being watched, e.g. over a websocket.
+// A simulation isn't idle while anyone is watching it
+func (s *Simulation) Attach() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.connections++
+}
+
+// Detach undoes Attach
+func (s *Simulation) Detach() {
+	now := s.baseConfig.Clock.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.connections--
+	s.lastActive = now
+}
+
+// idleSince reports when the simulation was last used, and
+// false if it is still being watched
+func (s *Simulation) idleSince() (time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.lastActive, s.connections == 0
+}
+
+// Stop stops the simulation's DarkKitchen from taking any more Orders.
+// Stopping a simulation that has already been stopped does nothing
+func (s *Simulation) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stop()
+}
+
+// must be called while holding s.mu
+func (s *Simulation) stop() {
+	if s.darkKitchen.IsStopped() {
+		return
+	}
+
+	s.darkKitchen.Stop()
+	s.stoppedAt = s.config.Clock.Now()
+}
+
+// Reset stops the simulation and starts it again with
+// a fresh DarkKitchen, empty shelves and the same parameters
+func (s *Simulation) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stop()
+	// the orders still playing out in the old kitchen
+	// aren't on the shelves anyone is watching anymore
+	s.darkKitchen.silence()
+	s.resets++
+	// only the first DarkKitchen is recovered, so this can't fail
+	s.start()
+
+	// anyone keeping a copy of the shelves has to start over
+	s.darkKitchen.publishEvent(Event{Type: SIMULATION_RESET_EVENT_TYPE})
+}
+
+// GetStatus reports the simulation's parameters and how its Orders are doing
+func (s *Simulation) GetStatus() SimulationStatus {
+	s.mu.RLock()
+	darkKitchen := s.darkKitchen
+	status := SimulationStatus{
+		ID:        s.ID,
+		Request:   s.Request,
+		State:     SIMULATION_RUNNING_STATE,
+		Seed:      s.config.Seed,
+		Resets:    s.resets,
+		StartedAt: s.startedAt,
+	}
+	if darkKitchen.IsStopped() {
+		stoppedAt := s.stoppedAt
+		status.State = SIMULATION_STOPPED_STATE
+		status.StoppedAt = &stoppedAt
+	}
+	s.mu.RUnlock()
+
+	// the orders to feed can be long, and are already known to the caller
+	status.Request.Orders = nil
+
+	status.OrdersByState = map[OrderState]int{}
+	for _, orderStatus := range darkKitchen.ListOrderStatuses(OrderFilter{}) {
+		status.OrdersReceived++
+		status.OrdersByState[orderStatus.State]++
+	}
+
+	return status
+}
+
+// SimulationRegistry keeps track of every Simulation session that has been
+// started. Sessions run side by side without touching each other, and every
+// request names the Simulation it is for
+type SimulationRegistry struct {
+	baseConfig *SimulationConfig
+
+	mu            sync.RWMutex
+	simulations   map[string]*Simulation
+	simulationIDs []string
+	// Simulations that are never collected
+	kept map[string]bool
+	// the Simulation each Order that has been looked up by ID alone
+	// was received in, so a partner's webhooks about an Order only
+	// have to look through every Simulation the first time
+	orderSimulations map[string]*Simulation
+}
+
+// CreateSimulationRegistry creates a registry whose Simulations take their
+// shelves, placement policy and clock from baseConfig
+func CreateSimulationRegistry(baseConfig *SimulationConfig) *SimulationRegistry {
+	return &SimulationRegistry{
+		baseConfig:       baseConfig,
+		simulations:      map[string]*Simulation{},
+		kept:             map[string]bool{},
+		orderSimulations: map[string]*Simulation{},
+	}
+}
+
+// Start starts a new Simulation
+func (r *SimulationRegistry) Start(request SimulationRequest) (*Simulation, error) {
+	simulation, err := CreateSimulation(request, r.baseConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	r.add(simulation)
+	return simulation, nil
+}
+
+// Recover starts a Simulation that picks up where the EventLog left off and
+// appends to it. See CreateLoggedSimulation
+func (r *SimulationRegistry) Recover(request SimulationRequest, eventLog *EventLog) (*Simulation, error) {
+	simulation, err := CreateLoggedSimulation(request, r.baseConfig, eventLog)
+	if err != nil {
+		return nil, err
+	}
+
+	r.add(simulation)
+	return simulation, nil
+}
+
+func (r *SimulationRegistry) add(simulation *Simulation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.simulations[simulation.ID] = simulation
+	r.simulationIDs = append(r.simulationIDs, simulation.ID)
+}
+
+// Keep stops the Simulation with the given ID from ever being collected, e.g.
+// the one the backend starts with, which the event log and -replay are tied to
+func (r *SimulationRegistry) Keep(simulationID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.kept[simulationID] = true
+}
+
+// Get returns the Simulation with the given ID and marks it as active
+func (r *SimulationRegistry) Get(simulationID string) (*Simulation, error) {
+	r.mu.RLock()
+	simulation, ok := r.simulations[simulationID]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf(SimulationNotFoundErr, simulationID)
+	}
+
+	simulation.touch()
+	return simulation, nil
+}
+
+// List returns every Simulation in the order they were started
+func (r *SimulationRegistry) List() []*Simulation {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	simulations := make([]*Simulation, 0, len(r.simulationIDs))
+	for _, simulationID := range r.simulationIDs {
+		simulations = append(simulations, r.simulations[simulationID])
+	}
+
+	return simulations
+}
+
+// FindOrder returns the Simulation whose DarkKitchen received the Order with the given ID
+func (r *SimulationRegistry) FindOrder(orderID string) (*Simulation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if simulation, ok := r.orderSimulations[orderID]; ok {
+		return simulation, nil
+	}
+
+	for _, simulationID := range r.simulationIDs {
+		simulation := r.simulations[simulationID]
+		if _, err := simulation.DarkKitchen().GetOrder(orderID); err == nil {
+			r.orderSimulations[orderID] = simulation
+			return simulation, nil
+		}
+	}
+
+	return nil, fmt.Errorf(OrderNotFoundErr, orderID)
+}
+
+// forgetOrders drops the Orders of the Simulation from the ones FindOrder
+// has looked up, once its DarkKitchen is gone. must be called while holding r.mu
+func (r *SimulationRegistry) forgetOrders(simulation *Simulation) {
+	for orderID, orderSimulation := range r.orderSimulations {
+		if orderSimulation == simulation {
+			delete(r.orderSimulations, orderID)
+		}
+	}
+}
+
+// Reset resets the Simulation with the given ID
+func (r *SimulationRegistry) Reset(simulationID string) (*Simulation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	simulation, ok := r.simulations[simulationID]
+	if !ok {
+		return nil, fmt.Errorf(SimulationNotFoundErr, simulationID)
+	}
+
+	simulation.touch()
+	simulation.Reset()
+	r.forgetOrders(simulation)
+
+	return simulation, nil
+}
+
+// CollectIdle stops and forgets every Simulation that nobody is watching
+// and that hasn't been used for maxIdle, except for the ones passed to Keep.
+// It returns the IDs of the Simulations that were collected
+func (r *SimulationRegistry) CollectIdle(maxIdle time.Duration) []string {
+	now := r.baseConfig.Clock.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	collected := []string{}
+	simulationIDs := []string{}
+	for _, simulationID := range r.simulationIDs {
+		simulation := r.simulations[simulationID]
+		lastActive, idle := simulation.idleSince()
+		if r.kept[simulationID] || !idle || now.Sub(lastActive) < maxIdle {
+			simulationIDs = append(simulationIDs, simulationID)
+			continue
+		}
+
+		simulation.Stop()
+		delete(r.simulations, simulationID)
+		r.forgetOrders(simulation)
+		collected = append(collected, simulationID)
+	}
+	r.simulationIDs = simulationIDs
+
+	return collected
+}
@@ -3,9 +3,38 @@ package interfaces
 import "time"
 
 type SimulationConfig struct {
+	// drivers take from DriverMinDelay to DriverMaxDelay ticks to get to
+	// the kitchen, unless there's a TravelTime distribution to draw from
 	DriverMinDelay int
 	DriverMaxDelay int
+	TravelTime     *TravelTimeDistribution
 	SleepTime      time.Duration
+	// Clock is used for every tick of the simulation. Defaults to
+	// the wall clock, but tests can swap in a FakeClock
+	Clock Clock
+	// Seed is used for every random draw in the simulation e.g. driver
+	// delays, so two runs with the same seed and the same orders match
+	Seed int64
+	// Engine is the label of the Engine that runs the simulation, either
+	// GOROUTINE_ENGINE_LABEL or EVENT_ENGINE_LABEL. Defaults to goroutines
+	Engine string
+	// Shelves is the layout of the kitchen's ShelfSet
+	Shelves []ShelfConfig
+	// PlacementPolicy decides what happens when shelves are full
+	PlacementPolicy PlacementPolicy
+	// DispatchStrategy decides which Orders drivers pick up
+	DispatchStrategy DispatchStrategy
+	// CourierProvider, if set, finds couriers for Orders in place of the simulated drivers
+	CourierProvider CourierProvider
+	// Metrics is where the shelves and drivers report to, if set
+	Metrics *Metrics
+	// FleetSize is how many drivers the kitchen has. 0 sends a new driver for every Order
+	FleetSize int
+	// BatchSize is the most Orders a driver picks up at once. 1 or less sends
+	// a driver for every Order. Orders join the batch of a driver who is due
+	// to pick up within BatchWindow ticks
+	BatchSize   int
+	BatchWindow int
 }
 
 // CreateSimulationConfig initializes
@@ -13,8 +42,23 @@ type SimulationConfig struct {
 // for the dark kitchen simulation
 func CreateSimulationConfig(driverMinDelay int, driverMaxDelay int, sleepTime time.Duration) *SimulationConfig {
 	return &SimulationConfig{
-		DriverMaxDelay: driverMinDelay,
-		DriverMinDelay: driverMaxDelay,
-		SleepTime:      sleepTime,
+		DriverMinDelay:   driverMinDelay,
+		DriverMaxDelay:   driverMaxDelay,
+		SleepTime:        sleepTime,
+		Clock:            CreateRealClock(),
+		Seed:             time.Now().UnixNano(),
+		Engine:           GOROUTINE_ENGINE_LABEL,
+		Shelves:          CreateDefaultShelfConfigs(),
+		PlacementPolicy:  HighestHealthToOverflowPolicy{},
+		DispatchStrategy: MatchedDispatchStrategy{},
 	}
 }
+
+// travelTime is the distribution drivers' travel times are drawn from
+func (c *SimulationConfig) travelTime() TravelTimeDistribution {
+	if c.TravelTime != nil {
+		return *c.TravelTime
+	}
+
+	return CreateUniformTravelTime(c.DriverMinDelay, c.DriverMaxDelay)
+}
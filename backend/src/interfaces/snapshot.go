@@ -0,0 +1,150 @@
+package interfaces
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ShelfSetSnapshot is every space on the shelves at a point in time, with
+// the Orders on them in full, e.g. their age and health. Version is the
+// sequence number of the last Event it reflects
+type ShelfSetSnapshot struct {
+	At      time.Time                   `json:"at"`
+	Version uint64                      `json:"version"`
+	Shelves map[string][]*OrderSnapshot `json:"shelves"`
+	// the wasted and cancelled order counts, by their GetState labels
+	Counts map[string]int `json:"counts"`
+
+	// where in the event log to carry on from the snapshot, at or before the
+	// Event after Version, and what the Events before it said about the Orders
+	// that hadn't come off the shelves yet. See DarkKitchen.TakeSnapshot
+	LogOffset int64                    `json:"logOffset,omitempty"`
+	Received  map[string]OrderSnapshot `json:"received,omitempty"`
+	PlacedAt  map[string]time.Time     `json:"placedAt,omitempty"`
+}
+
+// SnapshotStore is an append-only file of ShelfSetSnapshots, one JSON object per
+// line, taken at regular intervals. Only where each snapshot starts is kept in
+// memory, and snapshots are read back from the file when they are needed
+type SnapshotStore struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	// where each snapshot starts in the file, oldest first
+	index []snapshotIndex
+	end   int64
+}
+
+type snapshotIndex struct {
+	at     time.Time
+	offset int64
+}
+
+// CreateSnapshotStore opens the store at path, creating it if it doesn't exist.
+// A snapshot that was only partly written when the backend went down is cut off
+func CreateSnapshotStore(path string) (*SnapshotStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &SnapshotStore{
+		path: path,
+		file: file,
+	}
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		var snapshot ShelfSetSnapshot
+		if err := json.Unmarshal(line, &snapshot); err != nil {
+			file.Close()
+			return nil, fmt.Errorf(CorruptSnapshotErr, len(store.index)+1, err.Error())
+		}
+
+		store.index = append(store.index, snapshotIndex{at: snapshot.At, offset: store.end})
+		store.end += int64(len(line))
+	}
+
+	if err := file.Truncate(store.end); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Save appends the snapshot to the file and waits for it to reach the disk.
+// Snapshots have to be saved in the order they were taken
+func (s *SnapshotStore) Save(snapshot ShelfSetSnapshot) error {
+	line, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.WriteAt(line, s.end); err != nil {
+		return err
+	}
+
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+
+	s.index = append(s.index, snapshotIndex{at: snapshot.At, offset: s.end})
+	s.end += int64(len(line))
+
+	return nil
+}
+
+// Latest returns the last snapshot taken at or before the given
+// time, and false if there isn't one
+func (s *SnapshotStore) Latest(at time.Time) (ShelfSetSnapshot, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := len(s.index) - 1
+	for idx >= 0 && s.index[idx].at.After(at) {
+		idx--
+	}
+	if idx < 0 {
+		return ShelfSetSnapshot{}, false, nil
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(s.file, s.index[idx].offset, s.end-s.index[idx].offset))
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return ShelfSetSnapshot{}, false, err
+	}
+
+	var snapshot ShelfSetSnapshot
+	if err := json.Unmarshal(line, &snapshot); err != nil {
+		return ShelfSetSnapshot{}, false, err
+	}
+
+	return snapshot, true, nil
+}
+
+// Close closes the file
+func (s *SnapshotStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
@@ -0,0 +1,142 @@
+package interfaces
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// RecordedOrder is an Order as it came in, along with when
+// it arrived and the Simulation it was sent to
+type RecordedOrder struct {
+	At           time.Time `json:"at"`
+	SimulationID string    `json:"simulationId,omitempty"`
+	FoodOrderInput
+}
+
+// TrafficRecorder appends every Order it is given to a file, one
+// RecordedOrder per line, so the traffic can be replayed later
+type TrafficRecorder struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// CreateTrafficRecorder opens the recording at path, adding
+// to the end of it if it already exists
+func CreateTrafficRecorder(path string) (*TrafficRecorder, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TrafficRecorder{file: file}, nil
+}
+
+// Record appends the Order that arrived for the Simulation at the given time
+func (r *TrafficRecorder) Record(at time.Time, simulationID string, input FoodOrderInput) error {
+	line, err := json.Marshal(RecordedOrder{At: at, SimulationID: simulationID, FoodOrderInput: input})
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, err = r.file.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the file
+func (r *TrafficRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.file.Close()
+}
+
+// LoadRecordedOrders reads a recording made by a TrafficRecorder. A last
+// line that was cut off while it was being written is left out
+func LoadRecordedOrders(path string) ([]RecordedOrder, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	recorded := []RecordedOrder{}
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return recorded, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var order RecordedOrder
+		if err := json.Unmarshal(line, &order); err != nil {
+			return nil, fmt.Errorf(CorruptRecordingErr, len(recorded)+1, err.Error())
+		}
+		recorded = append(recorded, order)
+	}
+}
+
+// RecordedOrdersFor returns the recorded Orders that were sent to
+// the Simulation, so one session's traffic can be replayed on its own
+func RecordedOrdersFor(recorded []RecordedOrder, simulationID string) []RecordedOrder {
+	orders := []RecordedOrder{}
+	for _, order := range recorded {
+		if order.SimulationID == simulationID {
+			orders = append(orders, order)
+		}
+	}
+
+	return orders
+}
+
+// ReplayOrders feeds the recorded Orders to the DarkKitchen with the same gaps
+// between them as when they were recorded, divided by speed, e.g. a speed of 2
+// replays an hour of traffic in half an hour. The first Order is received
+// straight away. It returns once the replay has started, and the replay
+// stops early if the DarkKitchen is stopped
+func (ck *DarkKitchen) ReplayOrders(recorded []RecordedOrder, speed float64) error {
+	if ck.simulationConfig == nil {
+		return fmt.Errorf(NoSimulationConfigErr)
+	}
+
+	if speed <= 0 {
+		return fmt.Errorf(InvalidReplaySpeedErr, speed)
+	}
+
+	if len(recorded) == 0 {
+		return nil
+	}
+
+	clock := ck.simulationConfig.Clock
+	ck.WG.Add(1)
+	clock.Go(func() {
+		defer ck.WG.Done()
+
+		// every Order is timed from the start of the replay, so the gaps don't add up rounding errors
+		start := clock.Now()
+		for _, order := range recorded {
+			offset := time.Duration(float64(order.At.Sub(recorded[0].At)) / speed)
+			clock.Sleep(start.Add(offset).Sub(clock.Now()))
+			if ck.IsStopped() {
+				return
+			}
+
+			newOrder := CreateFoodOrder(order.Name, order.DecayRate, order.ShelfLife, order.Temperature, ck)
+			// orders that are turned away are still recorded
+			// with their state, so the error can be dropped here
+			ck.ReceiveOrder(&newOrder)
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package interfaces
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+)
+
+// TravelTimeDistribution describes how many ticks drivers take to get to the
+// kitchen, so the simulation can match observed courier data e.g.
+// { "type": "lognormal", "mu": 1.5, "sigma": 0.4, "min": 2, "max": 15 }
+type TravelTimeDistribution struct {
+	// Type is one of the *_TRAVEL_TIME labels. Defaults to uniform
+	Type string `json:"type"`
+	// every draw is rounded to whole ticks and clamped to [Min, Max]
+	Min int `json:"min"`
+	Max int `json:"max"`
+	// Mean and StdDev of a normal distribution, or the Mean of an exponential one
+	Mean   float64 `json:"mean,omitempty"`
+	StdDev float64 `json:"stdDev,omitempty"`
+	// Mu and Sigma of the log of a log-normal distribution
+	Mu    float64 `json:"mu,omitempty"`
+	Sigma float64 `json:"sigma,omitempty"`
+	// Histogram of observed travel times for an empirical distribution
+	Histogram []TravelTimeBucket `json:"histogram,omitempty"`
+}
+
+// TravelTimeBucket is how many drivers were observed taking the given number of ticks
+type TravelTimeBucket struct {
+	Ticks int `json:"ticks"`
+	Count int `json:"count"`
+}
+
+// CreateUniformTravelTime returns a distribution where every
+// travel time from min to max ticks is as likely as the others
+func CreateUniformTravelTime(min int, max int) TravelTimeDistribution {
+	return TravelTimeDistribution{
+		Type: UNIFORM_TRAVEL_TIME,
+		Min:  min,
+		Max:  max,
+	}
+}
+
+// LoadTravelTimeDistribution reads a distribution, e.g. a
+// histogram of observed travel times, from a JSON file
+func LoadTravelTimeDistribution(path string) (*TravelTimeDistribution, error) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	distribution := &TravelTimeDistribution{}
+	if err := json.Unmarshal(body, distribution); err != nil {
+		return nil, err
+	}
+
+	if err := distribution.Validate(); err != nil {
+		return nil, err
+	}
+
+	return distribution, nil
+}
+
+// Validate checks that travel times can be drawn from the distribution
+func (t TravelTimeDistribution) Validate() error {
+	if t.Min < 1 || t.Max < t.Min {
+		return fmt.Errorf(InvalidTravelTimeErr, "it needs 1 <= min <= max")
+	}
+
+	switch t.Type {
+	case "", UNIFORM_TRAVEL_TIME:
+	case NORMAL_TRAVEL_TIME:
+		if t.StdDev < 0 {
+			return fmt.Errorf(InvalidTravelTimeErr, "stdDev can't be negative")
+		}
+	case LOG_NORMAL_TRAVEL_TIME:
+		if t.Sigma < 0 {
+			return fmt.Errorf(InvalidTravelTimeErr, "sigma can't be negative")
+		}
+	case EXPONENTIAL_TRAVEL_TIME:
+		if t.Mean <= 0 {
+			return fmt.Errorf(InvalidTravelTimeErr, "mean has to be more than 0")
+		}
+	case EMPIRICAL_TRAVEL_TIME:
+		total := 0
+		for _, bucket := range t.Histogram {
+			if bucket.Count < 0 {
+				return fmt.Errorf(InvalidTravelTimeErr, "histogram counts can't be negative")
+			}
+			total += bucket.Count
+		}
+		if total == 0 {
+			return fmt.Errorf(InvalidTravelTimeErr, "histogram needs at least one observation")
+		}
+	default:
+		return fmt.Errorf(InvalidTravelTimeErr, "unknown type "+t.Type)
+	}
+
+	return nil
+}
+
+// Draw picks how many ticks a driver takes to get to the kitchen
+func (t TravelTimeDistribution) Draw(random *LockedRand) int {
+	var ticks float64
+	switch t.Type {
+	case NORMAL_TRAVEL_TIME:
+		ticks = t.Mean + random.NormFloat64()*t.StdDev
+	case LOG_NORMAL_TRAVEL_TIME:
+		ticks = math.Exp(t.Mu + random.NormFloat64()*t.Sigma)
+	case EXPONENTIAL_TRAVEL_TIME:
+		ticks = random.ExpFloat64() * t.Mean
+	case EMPIRICAL_TRAVEL_TIME:
+		ticks = float64(t.drawFromHistogram(random))
+	default:
+		return t.Min + random.Intn(t.Max-t.Min+1)
+	}
+
+	return t.clamp(ticks)
+}
+
+// ExpectedTicks is roughly how many ticks a driver takes on average, e.g. to
+// guess when an Order whose driver hasn't been sent yet will be picked up
+func (t TravelTimeDistribution) ExpectedTicks() int {
+	var ticks float64
+	switch t.Type {
+	case NORMAL_TRAVEL_TIME, EXPONENTIAL_TRAVEL_TIME:
+		ticks = t.Mean
+	case LOG_NORMAL_TRAVEL_TIME:
+		ticks = math.Exp(t.Mu + t.Sigma*t.Sigma/2)
+	case EMPIRICAL_TRAVEL_TIME:
+		total, sum := 0, 0
+		for _, bucket := range t.Histogram {
+			total += bucket.Count
+			sum += bucket.Count * bucket.Ticks
+		}
+		if total > 0 {
+			ticks = float64(sum) / float64(total)
+		}
+	default:
+		ticks = float64(t.Min+t.Max) / 2
+	}
+
+	return t.clamp(ticks)
+}
+
+// drawFromHistogram picks one of the observed travel times,
+// weighted by how many times it was observed
+func (t TravelTimeDistribution) drawFromHistogram(random *LockedRand) int {
+	total := 0
+	for _, bucket := range t.Histogram {
+		total += bucket.Count
+	}
+
+	draw := random.Intn(total)
+	for _, bucket := range t.Histogram {
+		if draw < bucket.Count {
+			return bucket.Ticks
+		}
+		draw -= bucket.Count
+	}
+
+	return t.Max
+}
+
+// clamp rounds the draw to whole ticks in [Min, Max]
+func (t TravelTimeDistribution) clamp(ticks float64) int {
+	// NaN and infinite draws are clamped too
+	if math.IsNaN(ticks) || ticks < float64(t.Min) {
+		return t.Min
+	}
+	if ticks > float64(t.Max) {
+		return t.Max
+	}
+
+	return int(math.Round(ticks))
+}
@@ -2,43 +2,341 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/drshrey/darkkitchen/backend/src/interfaces"
 	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	simulateOrdersPath = flag.String("simulate", "", "run the orders in the given JSON file through the event engine and exit instead of serving requests")
+	ordersPerTick      = flag.Float64("rate", interfaces.DEFAULT_ORDERS_PER_TICK, "average number of orders that arrive every tick when simulating")
+	placementPolicy    = flag.String("placement-policy", interfaces.HIGHEST_HEALTH_TO_OVERFLOW_POLICY_LABEL, "how the shelves decide what goes to overflow, one of "+
+		interfaces.HIGHEST_HEALTH_TO_OVERFLOW_POLICY_LABEL+", "+interfaces.EARLIEST_PICKUP_FIRST_POLICY_LABEL+", "+
+		interfaces.LOWEST_VALUE_AT_RISK_FIRST_POLICY_LABEL+" or "+interfaces.REJECT_NEWEST_POLICY_LABEL)
+	dispatchStrategy = flag.String("dispatch-strategy", interfaces.MATCHED_DISPATCH_STRATEGY_LABEL, "which orders drivers pick up, one of "+
+		interfaces.MATCHED_DISPATCH_STRATEGY_LABEL+", "+interfaces.FIFO_DISPATCH_STRATEGY_LABEL+" or "+interfaces.HEALTH_FIRST_DISPATCH_STRATEGY_LABEL+
+		". -simulate also takes "+interfaces.ALL_DISPATCH_STRATEGIES_LABEL+" to run the orders with each of them")
+	shelvesPath           = flag.String("shelves", "", "JSON file with the layout of the kitchen's shelves. Defaults to hot, cold, frozen and overflow shelves")
+	eventLogPath          = flag.String("event-log", "", "file to log every change to the kitchen's shelves to. The backend picks up where the log left off when it starts again")
+	snapshotsPath         = flag.String("snapshots", "", "file to snapshot the kitchen's shelves to, for GET /state?at=. Defaults to the event log's path with .snapshots on the end")
+	snapshotInterval      = flag.Duration("snapshot-interval", interfaces.DEFAULT_SNAPSHOT_INTERVAL, "how often the kitchen's shelves are snapshotted when there's an event log")
+	recordPath            = flag.String("record", "", "file to record every order POSTed to a simulation's orders to, with when it arrived")
+	replayPath            = flag.String("replay", "", "file of recorded orders to feed into the kitchen with the gaps they arrived with")
+	replaySpeed           = flag.Float64("replay-speed", 1, "how many times faster than they were recorded the orders are replayed")
+	replaySimulation      = flag.String("replay-simulation", "", "ID of the recorded simulation whose orders are replayed. Every recorded order is replayed when it's left out")
+	travelTimePath        = flag.String("travel-time", "", "JSON file with the distribution drivers' travel times are drawn from, e.g. a histogram of observed travel times. Defaults to uniform between the driver delays")
+	courierEndpoint       = flag.String("courier-endpoint", "", "base URL of a delivery partner's courier API to request couriers from, in place of the simulated drivers")
+	courierCallback       = flag.String("courier-callback", "http://localhost:8080/couriers/webhook", "URL the delivery partner POSTs courier updates to")
+	courierSecret         = flag.String("courier-secret", "", "secret shared with the delivery partner, which signs its courier updates with it. Needed with -courier-endpoint and -courier-stub")
+	courierStubAddr       = flag.String("courier-stub", "", "serve a stub delivery partner on the given address, e.g. :8081, instead of the kitchen")
+	fleetSize             = flag.Int("fleet-size", 0, "how many drivers the kitchen has. Orders wait for a free driver when they are all busy. 0 sends a new driver for every order")
+	batchSize             = flag.Int("batch-size", 1, "the most orders a driver picks up at once. 1 sends a driver for every order")
+	batchWindow           = flag.Int("batch-window", 0, "how many ticks away a driver's pickup can be for an order to join their batch")
+	seed                  = flag.Int64("seed", 0, "seed for the simulation the backend starts with or the -simulate runs, e.g. to reproduce a recorded run. A new seed is drawn when it's left out or 0")
+	simulationIdleTimeout = flag.Duration("simulation-idle-timeout", interfaces.DEFAULT_SIMULATION_IDLE_TIMEOUT, "how long a simulation can go unused before it is stopped and forgotten")
 )
 
 func main() {
+	flag.Parse()
+
 	// Initialize DarkKitchen with simulation config variables for driver delays
 	simulationConfig := interfaces.CreateSimulationConfig(interfaces.DEFAULT_DRIVER_MIN_DELAY, interfaces.DEFAULT_DRIVER_MAX_DELAY, interfaces.DEFAULT_SLEEP_TIME)
-	darkKitchen := interfaces.CreateDarkKitchen(simulationConfig)
+	if *seed != 0 {
+		simulationConfig.Seed = *seed
+	}
+	if *shelvesPath != "" {
+		shelfConfigs, err := interfaces.LoadShelfConfigs(*shelvesPath)
+		if err != nil {
+			logrus.Fatal(err.Error())
+		}
+		simulationConfig.Shelves = shelfConfigs
+	}
+
+	policy, err := interfaces.CreatePlacementPolicy(*placementPolicy)
+	if err != nil {
+		logrus.Fatal(err.Error())
+	}
+	simulationConfig.PlacementPolicy = policy
+	if *travelTimePath != "" {
+		if simulationConfig.TravelTime, err = interfaces.LoadTravelTimeDistribution(*travelTimePath); err != nil {
+			logrus.Fatal(err.Error())
+		}
+	}
+	if *fleetSize < 0 {
+		logrus.Fatal("-fleet-size can't be negative")
+	}
+	simulationConfig.FleetSize = *fleetSize
+	if *batchSize < 0 || *batchWindow < 0 {
+		logrus.Fatal("-batch-size and -batch-window can't be negative")
+	}
+	simulationConfig.BatchSize = *batchSize
+	simulationConfig.BatchWindow = *batchWindow
+
+	if (*courierStubAddr != "" || *courierEndpoint != "") && *courierSecret == "" {
+		logrus.Fatal("-courier-secret is needed to tell the delivery partner's courier updates from forged ones")
+	}
+
+	if *courierStubAddr != "" {
+		// couriers are assigned after a second, and take a few more to arrive and pick up
+		stub := interfaces.CreateStubCourierService(time.Second, 5*time.Second, time.Second, *courierSecret)
+		logrus.Infof("Stub delivery partner listening on %s", *courierStubAddr)
+		logrus.Fatal(http.ListenAndServe(*courierStubAddr, stub))
+	}
+
+	if *simulateOrdersPath != "" {
+		strategies := []string{*dispatchStrategy}
+		if *dispatchStrategy == interfaces.ALL_DISPATCH_STRATEGIES_LABEL {
+			strategies = []string{interfaces.MATCHED_DISPATCH_STRATEGY_LABEL, interfaces.FIFO_DISPATCH_STRATEGY_LABEL, interfaces.HEALTH_FIRST_DISPATCH_STRATEGY_LABEL}
+		}
+
+		for _, strategy := range strategies {
+			// every run starts from the same config, so they all draw the same seed
+			runConfig := *simulationConfig
+			if runConfig.DispatchStrategy, err = interfaces.CreateDispatchStrategy(strategy); err != nil {
+				logrus.Fatal(err.Error())
+			}
+			if err := RunEventSimulationFile(*simulateOrdersPath, *ordersPerTick, &runConfig); err != nil {
+				logrus.Fatal(err.Error())
+			}
+		}
+		return
+	}
+
+	strategy, err := interfaces.CreateDispatchStrategy(*dispatchStrategy)
+	if err != nil {
+		logrus.Fatal(err.Error())
+	}
+	simulationConfig.DispatchStrategy = strategy
+	if *courierEndpoint != "" {
+		simulationConfig.CourierProvider = interfaces.CreateHTTPCourierProvider(*courierEndpoint, *courierCallback)
+	}
+
+	// every simulation reports to the same metrics, served on /metrics
+	if simulationConfig.Metrics, err = interfaces.CreateMetrics(prometheus.DefaultRegisterer); err != nil {
+		logrus.Fatal(err.Error())
+	}
+
+	// every simulation started over HTTP gets its own DarkKitchen with this
+	// layout and placement policy. The backend starts with one on the defaults
+	simulations := interfaces.CreateSimulationRegistry(simulationConfig)
+	var eventLog *interfaces.EventLog
+	var snapshots *interfaces.SnapshotStore
+	var simulation *interfaces.Simulation
+	request := interfaces.SimulationRequest{}
+	if *seed != 0 {
+		request.Seed = seed
+	}
+	if *eventLogPath != "" {
+		// the simulation the backend starts with is the one that is logged
+		if eventLog, err = interfaces.CreateEventLog(*eventLogPath); err != nil {
+			logrus.Fatal(err.Error())
+		}
+
+		if *snapshotsPath == "" {
+			*snapshotsPath = *eventLogPath + ".snapshots"
+		}
+		if snapshots, err = interfaces.CreateSnapshotStore(*snapshotsPath); err != nil {
+			logrus.Fatal(err.Error())
+		}
+
+		simulation, err = simulations.Recover(request, eventLog)
+		logrus.Infof("Recovered %d events from %s", len(eventLog.Events()), *eventLogPath)
+	} else {
+		simulation, err = simulations.Start(request)
+	}
+	if err != nil {
+		logrus.Fatal(err.Error())
+	}
+	// log the seed so a run can be reproduced from a bug report
+	logrus.Infof("Simulation %s seed: %d", simulation.ID, simulation.GetStatus().Seed)
+	// the event log, its snapshots, -replay and the routes that don't
+	// name a simulation are all tied to this simulation
+	simulations.Keep(simulation.ID)
 
-	// used for handling client order requests
+	var recorder *interfaces.TrafficRecorder
+	if *recordPath != "" {
+		if recorder, err = interfaces.CreateTrafficRecorder(*recordPath); err != nil {
+			logrus.Fatal(err.Error())
+		}
+	}
+
+	// replayed orders go to the simulation the backend starts with,
+	// alongside anything that is POSTed while the replay is running
+	if *replayPath != "" {
+		recorded, err := interfaces.LoadRecordedOrders(*replayPath)
+		if err != nil {
+			logrus.Fatal(err.Error())
+		}
+		if *replaySimulation != "" {
+			recorded = interfaces.RecordedOrdersFor(recorded, *replaySimulation)
+		}
+
+		if err := simulation.DarkKitchen().ReplayOrders(recorded, *replaySpeed); err != nil {
+			logrus.Fatal(err.Error())
+		}
+		logrus.Infof("Replaying %d orders from %s at %vx speed", len(recorded), *replayPath, *replaySpeed)
+	}
+
+	// stop and forget simulations nobody is using anymore
+	go func() {
+		for range time.Tick(interfaces.SIMULATION_GC_INTERVAL) {
+			for _, simulationID := range simulations.CollectIdle(*simulationIdleTimeout) {
+				logrus.Infof("Simulation %s was idle and has been collected", simulationID)
+			}
+		}
+	}()
+
+	// a log that can't be written to can't be recovered from either,
+	// so stop before anything else is acknowledged
+	if eventLog != nil {
+		go func() {
+			<-eventLog.Failed()
+			logrus.Fatal(eventLog.Err().Error())
+		}()
+	}
+
+	// snapshots only save replaying the whole log, so one that fails isn't fatal.
+	// they are of the logged simulation, which is kept, so it's always there
+	if snapshots != nil {
+		go func() {
+			for range time.Tick(*snapshotInterval) {
+				if err := snapshots.Save(simulation.DarkKitchen().TakeSnapshot(eventLog)); err != nil {
+					logrus.Error(err.Error())
+				}
+			}
+		}()
+	}
+
+	// POST starts a new simulation, GET lists every simulation
+	http.HandleFunc("/simulations", func(w http.ResponseWriter, r *http.Request) {
+		HandleSimulationsRequest(w, r, simulations)
+	})
+
+	// GET /simulations/{id} looks up a simulation, and POST /simulations/{id}/stop
+	// and /simulations/{id}/reset stop or reset it. /simulations/{id}/orders,
+	// /ws, /events and /state are the order, streaming and state routes of that simulation
+	http.HandleFunc("/simulations/", func(w http.ResponseWriter, r *http.Request) {
+		HandleSimulationRequest(w, r, simulations, recorder, snapshots)
+	})
+
+	// the routes below are kept around for clients written before there were
+	// several simulations. They always go to the simulation the backend started
+	// with, which is kept, so a simulation started later can't take them over.
+	// /orders/new is kept around for clients that were written against it
 	http.HandleFunc("/orders/new", func(w http.ResponseWriter, r *http.Request) {
-		HandleOrderRequest(w, r, darkKitchen)
+		HandleOrderRequest(w, r, simulation, recorder)
+	})
+
+	// POST creates an order, GET lists orders
+	http.HandleFunc("/orders", func(w http.ResponseWriter, r *http.Request) {
+		HandleOrdersRequest(w, r, simulation, recorder)
+	})
+
+	// GET looks up a single order by its ID, DELETE cancels it
+	http.HandleFunc("/orders/", func(w http.ResponseWriter, r *http.Request) {
+		HandleOrderStatusRequest(w, r, simulation, recorder, strings.TrimPrefix(r.URL.Path, "/orders/"))
 	})
 
 	// sends the state of the dark kitchen back to the client
 	// through a websocket connection
 	http.HandleFunc("/ws/darkKitchenState", func(w http.ResponseWriter, r *http.Request) {
-		WSDarkKitchenState(w, r, darkKitchen)
+		WSDarkKitchenState(w, r, simulation)
+	})
+
+	// streams the events of the dark kitchen as server-sent events
+	http.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		SSEDarkKitchenEvents(w, r, simulation)
+	})
+
+	// GET /state is the logged kitchen's shelves now, or at a past time with ?at=
+	http.HandleFunc("/state", func(w http.ResponseWriter, r *http.Request) {
+		HandleStateRequest(w, r, simulation, snapshots)
 	})
 
+	// delivery partners POST what their couriers are up to here
+	http.HandleFunc("/couriers/webhook", func(w http.ResponseWriter, r *http.Request) {
+		HandleCourierWebhookRequest(w, r, simulations, *courierSecret)
+	})
+
+	http.Handle("/metrics", promhttp.Handler())
+
 	if err := http.ListenAndServe(":8080", nil); err != nil {
 		panic(err)
 	}
 }
 
-func HandleOrderRequest(w http.ResponseWriter, r *http.Request, darkKitchen *interfaces.DarkKitchen) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Headers", "*")
+// RunEventSimulationFile replays the orders in the JSON file at ordersPath through a DarkKitchen
+// driven by the EventEngine, which runs as fast as possible rather than in real time
+func RunEventSimulationFile(ordersPath string, ordersPerTick float64, simulationConfig *interfaces.SimulationConfig) error {
+	body, err := ioutil.ReadFile(ordersPath)
+	if err != nil {
+		return err
+	}
+
+	inputs := []interfaces.FoodOrderInput{}
+	if err := json.Unmarshal(body, &inputs); err != nil {
+		return err
+	}
+
+	result := interfaces.RunEventSimulation(inputs, ordersPerTick, simulationConfig)
+	waits := result.Waits
+	logrus.Infof("Simulated %d orders over %d ticks with seed %d, placement policy %s and dispatch strategy %s: %d picked up, %d wasted by decay, %d wasted for lack of space. "+
+		"Food waited %.2f ticks on average and %.2f at most, drivers waited %.2f ticks on average",
+		result.Orders, result.Ticks, result.Seed, *placementPolicy, waits.Strategy, result.PickedUp, result.WastedDecay, result.WastedNoSpace,
+		waits.AverageFoodWait, waits.LongestFoodWait, waits.AverageDriverWait)
+
+	return nil
+}
+
+// HandleOrdersRequest serves /orders and /simulations/{id}/orders. POST creates an order
+// the same way as /orders/new, and GET lists orders filtered by the state, temp and shelf query params
+func HandleOrdersRequest(w http.ResponseWriter, r *http.Request, simulation *interfaces.Simulation, recorder *interfaces.TrafficRecorder) {
+	switch r.Method {
+	case http.MethodPost:
+		HandleOrderRequest(w, r, simulation, recorder)
+	case http.MethodGet:
+		HandleListOrdersRequest(w, r, simulation.DarkKitchen())
+	case http.MethodOptions:
+		setCORSHeaders(w)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, r.Method+" is not supported")
+	}
+}
+
+// OrderResponse is returned when an order is created. Error
+// is set when the DarkKitchen didn't have room for the order
+type OrderResponse struct {
+	interfaces.OrderStatus
+	Error string `json:"error,omitempty"`
+}
+
+// HandleOrderRequest creates an order in the simulation and responds with its ID, shelf and state.
+// If recorder isn't nil the order is recorded under the simulation's ID, so its traffic can be replayed
+func HandleOrderRequest(w http.ResponseWriter, r *http.Request, simulation *interfaces.Simulation, recorder *interfaces.TrafficRecorder) {
+	setCORSHeaders(w)
+
+	darkKitchen := simulation.DarkKitchen()
 
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		logrus.Error(err.Error())
-		w.Write([]byte(err.Error()))
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if darkKitchen.IsStopped() {
+		writeJSONError(w, http.StatusConflict, interfaces.DarkKitchenStoppedErr)
 		return
 	}
 
@@ -46,16 +344,360 @@ func HandleOrderRequest(w http.ResponseWriter, r *http.Request, darkKitchen *int
 	err = json.Unmarshal(body, &requestParams)
 	if err != nil {
 		logrus.Error(err.Error())
-		w.Write([]byte(err.Error()))
-		w.WriteHeader(400)
+		writeJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
+	if recorder != nil {
+		if err := recorder.Record(time.Now(), simulation.ID, requestParams); err != nil {
+			logrus.Error(err.Error())
+		}
+	}
+
 	newOrder := interfaces.CreateFoodOrder(requestParams.Name, requestParams.DecayRate, requestParams.ShelfLife, requestParams.Temperature, darkKitchen)
-	darkKitchen.ReceiveOrder(&newOrder)
+	receiveErr := darkKitchen.ReceiveOrder(&newOrder)
+
+	orderStatus, err := darkKitchen.GetOrderStatus(newOrder.GetID())
+	if err != nil {
+		logrus.Error(err.Error())
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// the order is created either way so it can be looked up
+	// later, but let the client know it was turned away
+	response := OrderResponse{OrderStatus: orderStatus}
+	statusCode := http.StatusCreated
+	if receiveErr != nil {
+		response.Error = receiveErr.Error()
+		statusCode = http.StatusUnprocessableEntity
+	}
+
+	// orders are looked up under the path they were created
+	// at, either /orders or /simulations/{id}/orders
+	ordersPath := strings.TrimSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/new")
+	w.Header().Set("Location", ordersPath+"/"+newOrder.GetID())
+	writeJSON(w, statusCode, response)
+}
+
+// HandleListOrdersRequest lists every order that matches the
+// state, temp and shelf query params, in the order they were received
+func HandleListOrdersRequest(w http.ResponseWriter, r *http.Request, darkKitchen *interfaces.DarkKitchen) {
+	setCORSHeaders(w)
+
+	query := r.URL.Query()
+	filter := interfaces.OrderFilter{
+		State:       interfaces.OrderState(query.Get("state")),
+		Temperature: query.Get("temp"),
+		Shelf:       query.Get("shelf"),
+	}
+
+	writeJSON(w, http.StatusOK, darkKitchen.ListOrderStatuses(filter))
+}
+
+// HandleOrderStatusRequest serves GET and DELETE /orders/{id} and /simulations/{id}/orders/{orderID}
+func HandleOrderStatusRequest(w http.ResponseWriter, r *http.Request, simulation *interfaces.Simulation, recorder *interfaces.TrafficRecorder, orderID string) {
+	setCORSHeaders(w)
+
+	if orderID == "" {
+		HandleOrdersRequest(w, r, simulation, recorder)
+		return
+	}
+
+	darkKitchen := simulation.DarkKitchen()
+
+	switch r.Method {
+	case http.MethodGet:
+		orderStatus, err := darkKitchen.GetOrderStatus(orderID)
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, orderStatus)
+	case http.MethodDelete:
+		HandleCancelOrderRequest(w, r, darkKitchen, orderID)
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, r.Method+" is not supported")
+	}
+}
+
+// HandleStateRequest serves GET /state and /simulations/{id}/state. ?at= takes an RFC 3339 time and
+// rebuilds the shelves as they were then from the event log and the latest snapshot before it,
+// for the logged simulation
+func HandleStateRequest(w http.ResponseWriter, r *http.Request, simulation *interfaces.Simulation, snapshots *interfaces.SnapshotStore) {
+	setCORSHeaders(w)
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, r.Method+" is not supported")
+		return
+	}
+
+	darkKitchen := simulation.DarkKitchen()
+	query := r.URL.Query().Get("at")
+	if query == "" {
+		writeJSON(w, http.StatusOK, darkKitchen.CarrierFacility.GetSnapshot())
+		return
+	}
+
+	at, err := time.Parse(time.RFC3339Nano, query)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	eventLog := simulation.EventLog()
+	if eventLog == nil {
+		writeJSONError(w, http.StatusNotFound, "Past states need the backend to be started with -event-log, and are only kept for the simulation it starts with")
+		return
+	}
+
+	state, err := darkKitchen.StateAt(at, eventLog, snapshots)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, state)
+}
+
+// HandleCancelOrderRequest cancels the order and responds with its status.
+// Orders that have already been picked up, wasted or cancelled are a conflict
+func HandleCancelOrderRequest(w http.ResponseWriter, r *http.Request, darkKitchen *interfaces.DarkKitchen, orderID string) {
+	if _, err := darkKitchen.GetOrderStatus(orderID); err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if err := darkKitchen.CancelOrder(orderID); err != nil {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	orderStatus, err := darkKitchen.GetOrderStatus(orderID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, orderStatus)
+}
+
+func setCORSHeaders(w http.ResponseWriter) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+}
+
+// HandleCourierWebhookRequest serves POST /couriers/webhook, where a delivery partner
+// tells the kitchen that the courier for an order was assigned, is arriving or picked it up.
+// Only webhooks signed with the secret the kitchen shares with the partner are let through
+func HandleCourierWebhookRequest(w http.ResponseWriter, r *http.Request, simulations *interfaces.SimulationRegistry, secret string) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, r.Method+" is not supported")
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !interfaces.VerifyCourierWebhook(secret, body, r.Header.Get(interfaces.COURIER_SIGNATURE_HEADER)) {
+		writeJSONError(w, http.StatusUnauthorized, interfaces.InvalidCourierSignatureErr)
+		return
+	}
+
+	webhook := interfaces.CourierWebhook{}
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	simulation, err := simulations.FindOrder(webhook.OrderID)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if err := simulation.DarkKitchen().HandleCourierWebhook(webhook); err != nil {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		logrus.Error(err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
+func writeJSONError(w http.ResponseWriter, statusCode int, msg string) {
+	writeJSON(w, statusCode, map[string]string{"error": msg})
+}
+
+// HandleSimulationsRequest serves /simulations. POST starts a new simulation
+// from a SimulationRequest, GET lists every simulation
+func HandleSimulationsRequest(w http.ResponseWriter, r *http.Request, simulations *interfaces.SimulationRegistry) {
+	setCORSHeaders(w)
+
+	switch r.Method {
+	case http.MethodPost:
+		HandleStartSimulationRequest(w, r, simulations)
+	case http.MethodGet:
+		statuses := []interfaces.SimulationStatus{}
+		for _, simulation := range simulations.List() {
+			statuses = append(statuses, simulation.GetStatus())
+		}
+
+		writeJSON(w, http.StatusOK, statuses)
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, r.Method+" is not supported")
+	}
+}
+
+// HandleStartSimulationRequest starts a fresh DarkKitchen with the parameters
+// in the SimulationRequest. Parameters that are left out use the defaults
+func HandleStartSimulationRequest(w http.ResponseWriter, r *http.Request, simulations *interfaces.SimulationRegistry) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logrus.Error(err.Error())
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	request := interfaces.SimulationRequest{}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &request); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	simulation, err := simulations.Start(request)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	status := simulation.GetStatus()
+	logrus.Infof("Simulation %s seed: %d", simulation.ID, status.Seed)
+
+	w.Header().Set("Location", "/simulations/"+simulation.ID)
+	writeJSON(w, http.StatusCreated, status)
 }
 
-func WSDarkKitchenState(w http.ResponseWriter, r *http.Request, darkKitchen *interfaces.DarkKitchen) {
+// HandleSimulationRequest serves GET /simulations/{id}, POST /simulations/{id}/stop,
+// POST /simulations/{id}/reset and the order, streaming and state routes of the simulation
+func HandleSimulationRequest(w http.ResponseWriter, r *http.Request, simulations *interfaces.SimulationRegistry, recorder *interfaces.TrafficRecorder, snapshots *interfaces.SnapshotStore) {
+	setCORSHeaders(w)
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/simulations/"), "/", 2)
+	simulationID := parts[0]
+	if simulationID == "" {
+		HandleSimulationsRequest(w, r, simulations)
+		return
+	}
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	simulation, err := simulations.Get(simulationID)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	route := ""
+	if len(parts) > 1 {
+		route = strings.TrimSuffix(parts[1], "/")
+	}
+
+	switch {
+	case route == "orders" || route == "orders/new":
+		HandleOrdersRequest(w, r, simulation, recorder)
+		return
+	case strings.HasPrefix(route, "orders/"):
+		HandleOrderStatusRequest(w, r, simulation, recorder, strings.TrimPrefix(route, "orders/"))
+		return
+	case route == "ws":
+		WSDarkKitchenState(w, r, simulation)
+		return
+	case route == "events":
+		SSEDarkKitchenEvents(w, r, simulation)
+		return
+	case route == "state":
+		HandleStateRequest(w, r, simulation, snapshots)
+		return
+	case route == "" && r.Method == http.MethodGet:
+	case route == "stop" && r.Method == http.MethodPost:
+		simulation.Stop()
+	case route == "reset" && r.Method == http.MethodPost:
+		simulation, err = simulations.Reset(simulationID)
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+	case route == "" || route == "stop" || route == "reset":
+		writeJSONError(w, http.StatusMethodNotAllowed, r.Method+" is not supported")
+		return
+	default:
+		writeJSONError(w, http.StatusNotFound, "Unknown simulation route: "+route)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, simulation.GetStatus())
+}
+
+// WSDarkKitchenState streams the shelves of the simulation. A client that wants
+// to watch another simulation opens a new connection to that one's route.
+//
+// ?protocol=full (the default) sends the whole GetState every time the shelves
+// change. ?protocol=diff sends a versioned snapshot of every shelf space and then
+// only the spaces that changed. A client that reconnects with ?since={version}
+// is sent the changes it missed, or a fresh snapshot if they are too old
+func WSDarkKitchenState(w http.ResponseWriter, r *http.Request, simulation *interfaces.Simulation) {
+	query := r.URL.Query()
+	protocol := query.Get("protocol")
+	if protocol == "" {
+		protocol = interfaces.FULL_STATE_PROTOCOL
+	}
+	if protocol != interfaces.FULL_STATE_PROTOCOL && protocol != interfaces.DIFF_STATE_PROTOCOL {
+		writeJSONError(w, http.StatusBadRequest, "Unknown protocol: "+protocol)
+		return
+	}
+
+	var since *uint64
+	if query.Get("since") != "" {
+		version, err := strconv.ParseUint(query.Get("since"), 10, 64)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		since = &version
+	}
+
 	// initialize the websocket connection with Gorilla's Upgrader - http://www.gorillatoolkit.org/pkg/websocket#Upgrader.Upgrade
 	upgrader := websocket.Upgrader{
 		ReadBufferSize:  1024,
@@ -74,28 +716,206 @@ func WSDarkKitchenState(w http.ResponseWriter, r *http.Request, darkKitchen *int
 	}
 
 	defer conn.Close()
+
+	// the client never sends anything, but reading is how a closed
+	// connection is noticed while there are no updates to write
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	if protocol == interfaces.FULL_STATE_PROTOCOL {
+		writeFullStates(conn, simulation, closed)
+		return
+	}
+
+	watcher, err := simulation.WatchShelves(interfaces.WEBSOCKET_BUFFER_SIZE, interfaces.EventFilter{}, since, func(update interfaces.ShelfUpdate) error {
+		if update.Snapshot != nil {
+			return writeWSJSON(conn, update.Snapshot)
+		}
+		if update.Diff != nil {
+			return writeWSJSON(conn, update.Diff)
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.Error(err.Error())
+		return
+	}
+	defer watcher.Close()
+
 	for {
 		select {
-		case component := <-darkKitchen.UpdatedStateNotifications:
-			if component == interfaces.CARRIER_FACILITY_LABEL {
-				// get updated shelf state and send it to the client
-				cfState := darkKitchen.CarrierFacility.GetState()
-				jsonCfState, err := json.Marshal(cfState)
-				if err != nil {
-					logrus.Error(err.Error())
-				} else {
-					if err := conn.WriteMessage(websocket.TextMessage, jsonCfState); err != nil {
-						return
-					}
-				}
+		case <-watcher.Ready():
+			if err := watcher.Update(); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// writeFullStates sends the whole shelf state every time the shelves change,
+// until the connection is closed. It keeps the simulation from being collected meanwhile
+func writeFullStates(conn *websocket.Conn, simulation *interfaces.Simulation, closed <-chan struct{}) {
+	// pending events are coalesced away when the client is slow,
+	// which is fine since any event means the whole state is sent
+	subscription, err := simulation.Events().Subscribe(interfaces.WEBSOCKET_BUFFER_SIZE, interfaces.COALESCE_SUBSCRIPTION_POLICY)
+	if err != nil {
+		logrus.Error(err.Error())
+		return
+	}
+	defer subscription.Close()
+	simulation.Attach()
+	defer simulation.Detach()
+
+	for {
+		select {
+		case <-subscription.Ready():
+			// one write covers however many events there were
+			subscription.Drain()
+			if err := writeWSJSON(conn, simulation.DarkKitchen().CarrierFacility.GetState()); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+func writeWSJSON(conn *websocket.Conn, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		logrus.Error(err.Error())
+		return nil
+	}
+
+	return conn.WriteMessage(websocket.TextMessage, body)
+}
+
+// EventUpdate is an Event along with what it changed on the shelves
+type EventUpdate struct {
+	interfaces.Event
+	Slots  []interfaces.SlotChange `json:"slots,omitempty"`
+	Counts map[string]int          `json:"counts,omitempty"`
+}
+
+// SSEDarkKitchenEvents streams the events of the simulation as text/event-stream,
+// for clients that can't use the websocket. It starts with a snapshot of every
+// shelf space, then sends every event with what it changed on the shelves.
+//
+// Every message's id is the version of the shelves it brings the client to, so
+// a client that reconnects with a Last-Event-ID header (or ?lastEventId=) is sent
+// the events it missed, or a fresh snapshot if they are too old. ?type= and
+// ?shelf= take comma separated lists of the event types and shelves to send
+func SSEDarkKitchenEvents(w http.ResponseWriter, r *http.Request, simulation *interfaces.Simulation) {
+	setCORSHeaders(w)
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, r.Method+" is not supported")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	query := r.URL.Query()
+	filter, err := interfaces.CreateEventFilter(splitQueryList(query["type"]), splitQueryList(query["shelf"]))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = query.Get("lastEventId")
+	}
+
+	var since *uint64
+	if lastEventID != "" {
+		version, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		since = &version
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	watcher, err := simulation.WatchShelves(interfaces.SSE_BUFFER_SIZE, filter, since, func(update interfaces.ShelfUpdate) error {
+		if update.Snapshot != nil {
+			return writeSSE(w, flusher, update.Snapshot.Version, update.Snapshot.Type, update.Snapshot)
+		}
+
+		eventUpdate := EventUpdate{Event: *update.Event}
+		if update.Diff != nil {
+			eventUpdate.Slots = update.Diff.Slots
+			eventUpdate.Counts = update.Diff.Counts
+		}
+		return writeSSE(w, flusher, update.Event.Seq, string(update.Event.Type), eventUpdate)
+	})
+	if err != nil {
+		logrus.Error(err.Error())
+		return
+	}
+	defer watcher.Close()
+
+	for {
+		select {
+		case <-watcher.Ready():
+			if err := watcher.Update(); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// splitQueryList splits every comma separated value of a query parameter
+func splitQueryList(values []string) []string {
+	list := []string{}
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
 			}
 		}
 	}
+
+	return list
 }
 
-type SimulationRequest struct {
-	PoissonRateParameter float32 `json:"poissonRateParam"`
-	DriverMinDelay       int     `json:"driverMinDelay"`
-	DriverMaxDelay       int     `json:"driverMaxDelay"`
-	TimeUnits            int     `json:"timeUnits"`
+func writeSSE(w http.ResponseWriter, flusher http.Flusher, id uint64, event string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		logrus.Error(err.Error())
+		return nil
+	}
+
+	if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, event, body); err != nil {
+		return err
+	}
+	flusher.Flush()
+
+	return nil
 }
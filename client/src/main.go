@@ -21,6 +21,7 @@ type FoodOrderInput struct {
 }
 
 const DEFAULT_POISSON_RATE_PARAM = 3.25
+const BACKEND_URL = "http://host.docker.internal:8080"
 
 // this is a simple client implementation using a poisson scale of DEFAULT deliveries per second
 // to benchmark our DarkKitchen implementation
@@ -39,6 +40,14 @@ func main() {
 	var orders []FoodOrderInput
 	json.Unmarshal(byteValue, &orders)
 
+	// orders go to the simulation named by SIMULATION_ID, e.g. one the
+	// frontend started, or else the one the backend started with
+	ordersURL := BACKEND_URL + "/orders/new"
+	if simulationID := os.Getenv("SIMULATION_ID"); simulationID != "" {
+		logrus.Infof("Sending orders to simulation %s", simulationID)
+		ordersURL = BACKEND_URL + "/simulations/" + simulationID + "/orders"
+	}
+
 	poissonDistribution := rng.NewPoissonGenerator(int64(len(orders)))
 
 	numOrdersInSecond := poissonDistribution.Poisson(DEFAULT_POISSON_RATE_PARAM)
@@ -59,7 +68,7 @@ func main() {
 
 				logrus.Infof("Processing %s", orders[orderIdx].Name)
 
-				req, err := http.NewRequest("POST", "http://host.docker.internal:8080/orders/new", bytes.NewBuffer(jsonOrderString))
+				req, err := http.NewRequest("POST", ordersURL, bytes.NewBuffer(jsonOrderString))
 				req.Header.Set("Content-Type", "application/json")
 
 				client := &http.Client{}
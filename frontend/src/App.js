@@ -5,7 +5,10 @@ class App extends Component {
   constructor(props){
     super(props)
     const WS_BACKEND_URL = process.env.REACT_APP_WS_BACKEND_URL
-    this.socket = new WebSocket(`${WS_BACKEND_URL}/ws/darkKitchenState`);    
+    // the API is served by the same backend as the websocket
+    this.wsBackendURL = WS_BACKEND_URL
+    this.backendURL = `${WS_BACKEND_URL}`.replace(/^ws/, "http")
+    this.socket = null
 
     this.state = {
       shelves: {
@@ -16,6 +19,9 @@ class App extends Component {
       },
       wastedOrdersDecay: 0,
       wastedOrdersNoSpace: 0,
+      cancelledOrders: 0,
+      fleet: null,
+      dispatch: null,
       output: "Not Connected",
       minDriverDelay: "2",
       maxDriverDelay: "8",
@@ -26,13 +32,27 @@ class App extends Component {
 
     this.renderShelf.bind(this)
     this.renderOrder.bind(this)
+    this.cleanSimulationEnvironment = this.cleanSimulationEnvironment.bind(this)
 
-    this.openSockets()    
+    // ?simulation={id} watches a simulation that is already running, e.g. one
+    // the client sends orders to. Otherwise the page watches the one the backend started with
+    this.openSockets(new URLSearchParams(window.location.search).get("simulation"))
   }
 
-  openSockets() {
+  // watches the shelves of the simulation, or the one the backend started
+  // with if there's no ID, closing the socket to the one watched before
+  openSockets(simulationID) {
+    if (this.socket) {
+      this.socket.close()
+    }
+    if (simulationID) {
+      this.socket = new WebSocket(`${this.wsBackendURL}/simulations/${simulationID}/ws`);
+    } else {
+      this.socket = new WebSocket(`${this.wsBackendURL}/ws/darkKitchenState`);
+    }
+
     this.socket.onopen = () => {
-      this.setState({ output: "Connected\n" })
+      this.setState({ output: simulationID ? `Connected to simulation ${simulationID}` : "Connected\n" })
     };
   
     this.socket.onmessage = (e) => {
@@ -43,10 +63,40 @@ class App extends Component {
       let wastedOrdersNoSpace = jsonData["wastedOrdersNoSpace"]
       delete jsonData["wastedOrdersNoSpace"]      
 
-      this.setState({ shelves: jsonData, wastedOrdersDecay: wastedOrdersDecay, wastedOrdersNoSpace: wastedOrdersNoSpace  })
+      let cancelledOrders = jsonData["cancelledOrders"]
+      delete jsonData["cancelledOrders"]
+
+      let fleet = jsonData["fleet"]
+      delete jsonData["fleet"]
+
+      let dispatch = jsonData["dispatch"]
+      delete jsonData["dispatch"]
+
+      this.setState({ shelves: jsonData, wastedOrdersDecay: wastedOrdersDecay, wastedOrdersNoSpace: wastedOrdersNoSpace, cancelledOrders: cancelledOrders, fleet: fleet, dispatch: dispatch })
     };        
   }
 
+  // starts a fresh simulation with empty shelves and watches it instead
+  cleanSimulationEnvironment() {
+    fetch(`${this.backendURL}/simulations`, {
+      method: "POST",
+      body: JSON.stringify({
+        driverMinDelay: parseInt(this.state.minDriverDelay, 10),
+        driverMaxDelay: parseInt(this.state.maxDriverDelay, 10),
+        timeUnits: parseInt(this.state.timeUnits, 10),
+        poissonRateParam: parseFloat(this.state.poissionRateParam),
+      }),
+    })
+      .then((res) => res.json())
+      .then((simulation) => {
+        if (simulation.error) {
+          this.setState({ output: simulation.error })
+          return
+        }
+        this.openSockets(simulation.id)
+      })
+  }
+
   renderOrder(order, idx) {
     let tempColors = {
       "hot": "red",
@@ -86,10 +136,18 @@ class App extends Component {
         <h1> Dark Kitchen Shelf State</h1>
         {/* The status of the websocket connection to the server */}
         <h4> Status: {this.state.output} </h4>
+        <button onClick={this.cleanSimulationEnvironment}>Clean Simulation Environment</button>
         <div>
           <div style={{ display: "inline-block"}}>
               <p> Wasted Orders b/c of decay : {this.state.wastedOrdersDecay} </p>
               <p> Wasted Orders b/c no space left: {this.state.wastedOrdersNoSpace} </p>
+              <p> Cancelled Orders: {this.state.cancelledOrders} </p>
+              {this.state.fleet && this.state.fleet.size > 0 &&
+                <p> Drivers: {this.state.fleet.available} available, {this.state.fleet.enRoute} en route, {this.state.fleet.returning} returning, {this.state.fleet.queued} orders waiting ({Math.round(this.state.fleet.utilization * 100)}% busy) </p>
+              }
+              {this.state.dispatch &&
+                <p> Dispatch ({this.state.dispatch.strategy}): food waited {this.state.dispatch.averageFoodWait.toFixed(2)} ticks (at most {this.state.dispatch.longestFoodWait.toFixed(2)}), drivers waited {this.state.dispatch.averageDriverWait.toFixed(2)} ticks on average </p>
+              }
               <h4> Shelves</h4>              
               <div style={{ background: "white", borderRadius: 4, color: "black" }}>
                 {Object.keys(this.state.shelves).map((shelf) => {